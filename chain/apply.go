@@ -0,0 +1,191 @@
+package chain
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ArchivasNetwork/archivas/ledger"
+)
+
+// Block state transition
+//
+// Block production, peer block import and initial block download all apply
+// blocks through ApplyBlock, so every node derives the same world state from
+// the same chain. The parent state is never modified: the result is an
+// overlay holding copies of the accounts the block changes, which callers
+// commit into the parent once the rest of the block is accepted. Blocks
+// below the strict transaction activation (see consensus.Upgrades) are
+// applied the way nodes applied them before: transfers that overspend or
+// reuse a nonce are skipped instead of failing the block. Signatures are
+// verified in every block.
+
+// CoinbaseSender is the From address of reward payouts
+const CoinbaseSender = "coinbase"
+
+// ErrCoinbaseOrder is returned when a coinbase payout follows a transfer
+var ErrCoinbaseOrder = errors.New("coinbase payout after a transfer")
+
+// Block is the part of a block the state transition depends on
+type Block struct {
+	Height uint64
+	Txs    []ledger.Transaction // Coinbase payouts first, then transfers
+}
+
+// Receipt records the effect of one transaction of a block
+type Receipt struct {
+	Index    int      // Position of the transaction in the block
+	Coinbase bool     // Reward payout rather than a transfer
+	Skipped  bool     // Transfer failed and was skipped by a lenient block
+	Fee      int64    // Fee paid (and burned) by a transfer
+	Accounts []string // Accounts whose state the transaction changed
+}
+
+// ApplyOptions relax ApplyBlock for blocks whose validity is already vouched for
+type ApplyOptions struct {
+	SkipSignatures bool // Block lies below an assume-valid checkpoint
+	Lenient        bool // Block predates strict transactions: transfers breaking balances or nonces are skipped
+}
+
+// Overlay is the state a block leaves behind: copies of the accounts the
+// block may change, layered over the parent state, which is shared rather
+// than copied. The parent must not change while the overlay is in use.
+type Overlay struct {
+	parent  *ledger.WorldState
+	changes *ledger.WorldState
+}
+
+// GetAccount returns an account as it is after the block (nil if it doesn't exist)
+func (o *Overlay) GetAccount(addr string) *ledger.AccountState {
+	if acct, ok := o.changes.Accounts[addr]; ok {
+		return acct
+	}
+	return o.parent.Accounts[addr]
+}
+
+// GetBalance returns the balance of an account after the block
+func (o *Overlay) GetBalance(addr string) int64 {
+	if acct := o.GetAccount(addr); acct != nil {
+		return acct.Balance
+	}
+	return 0
+}
+
+// State returns a copy of the whole state after the block
+func (o *Overlay) State() *ledger.WorldState {
+	state := o.parent.Clone()
+	for addr, acct := range o.changes.Accounts {
+		state.Accounts[addr] = &ledger.AccountState{Balance: acct.Balance, Nonce: acct.Nonce}
+	}
+	return state
+}
+
+// Commit writes the accounts the block changed into the parent state
+func (o *Overlay) Commit() {
+	for addr, acct := range o.changes.Accounts {
+		o.parent.Accounts[addr] = acct
+	}
+}
+
+// ApplyBlock applies block on top of parentState and returns the resulting
+// state with one receipt per transaction. Coinbase payouts are credited,
+// every transfer's signature is verified and the transfer applied. Any
+// invalid transaction fails the whole block. parentState is never modified.
+func ApplyBlock(parentState *ledger.WorldState, block *Block) (*Overlay, []Receipt, error) {
+	return ApplyBlockWithOptions(parentState, block, ApplyOptions{})
+}
+
+// ApplyBlockWithOptions is ApplyBlock with the checks opts relaxes skipped.
+// Balances and nonces are always enforced, though a lenient block skips the
+// transfers that break them. An invalid signature fails even a lenient block.
+func ApplyBlockWithOptions(parentState *ledger.WorldState, block *Block, opts ApplyOptions) (*Overlay, []Receipt, error) {
+	state := overlay(parentState, block.Txs)
+	receipts := make([]Receipt, 0, len(block.Txs))
+	transfers := false
+	for i, tx := range block.Txs {
+		if tx.From == CoinbaseSender {
+			if transfers && !opts.Lenient {
+				return nil, nil, fmt.Errorf("block %d tx %d: %w", block.Height, i, ErrCoinbaseOrder)
+			}
+			creditCoinbase(state, tx)
+			receipts = append(receipts, Receipt{Index: i, Coinbase: true, Accounts: []string{tx.To}})
+			continue
+		}
+		transfers = true
+		if !opts.SkipSignatures {
+			if err := ledger.VerifyTransaction(tx); err != nil {
+				return nil, nil, fmt.Errorf("block %d tx %d from %s with nonce %d: invalid signature: %w", block.Height, i, tx.From, tx.Nonce, err)
+			}
+		}
+		if err := state.ApplyTransaction(tx); err != nil {
+			if opts.Lenient {
+				receipts = append(receipts, Receipt{Index: i, Skipped: true})
+				continue
+			}
+			return nil, nil, fmt.Errorf("block %d tx %d from %s with nonce %d: %w", block.Height, i, tx.From, tx.Nonce, err)
+		}
+		receipts = append(receipts, Receipt{Index: i, Fee: tx.Fee, Accounts: []string{tx.From, tx.To}})
+	}
+	return &Overlay{parent: parentState, changes: state}, receipts, nil
+}
+
+// SelectTransactions returns, in order, the pending transfers that apply on
+// top of parentState and the coinbase payouts, along with the errors of
+// those skipped. A block of coinbase followed by the selected transfers
+// passes ApplyBlock. parentState is never modified.
+func SelectTransactions(parentState *ledger.WorldState, coinbase, pending []ledger.Transaction) ([]ledger.Transaction, []error) {
+	state := overlay(parentState, append(append([]ledger.Transaction(nil), coinbase...), pending...))
+	for _, tx := range coinbase {
+		creditCoinbase(state, tx)
+	}
+
+	var selected []ledger.Transaction
+	var skipped []error
+	for _, tx := range pending {
+		if tx.From == CoinbaseSender {
+			skipped = append(skipped, fmt.Errorf("pending tx to %s: %w", tx.To, ErrCoinbaseOrder))
+			continue
+		}
+		if err := applyTransfer(state, tx); err != nil {
+			skipped = append(skipped, fmt.Errorf("pending tx from %s with nonce %d: %w", tx.From, tx.Nonce, err))
+			continue
+		}
+		selected = append(selected, tx)
+	}
+	return selected, skipped
+}
+
+// overlay returns a state holding copies of the parent's accounts that txs
+// may change. Transactions only ever read and write their sender and
+// receiver, so they apply to it as they would to the whole parent state.
+func overlay(parent *ledger.WorldState, txs []ledger.Transaction) *ledger.WorldState {
+	state := &ledger.WorldState{Accounts: make(map[string]*ledger.AccountState, 2*len(txs))}
+	for _, tx := range txs {
+		for _, addr := range []string{tx.From, tx.To} {
+			if _, copied := state.Accounts[addr]; copied {
+				continue
+			}
+			if acct, ok := parent.Accounts[addr]; ok {
+				state.Accounts[addr] = &ledger.AccountState{Balance: acct.Balance, Nonce: acct.Nonce}
+			}
+		}
+	}
+	return state
+}
+
+// creditCoinbase pays a coinbase payout to its receiver
+func creditCoinbase(state *ledger.WorldState, tx ledger.Transaction) {
+	receiver, ok := state.Accounts[tx.To]
+	if !ok {
+		receiver = &ledger.AccountState{Balance: 0, Nonce: 0}
+		state.Accounts[tx.To] = receiver
+	}
+	receiver.Balance += tx.Amount
+}
+
+// applyTransfer verifies a transfer's signature and applies it
+func applyTransfer(state *ledger.WorldState, tx ledger.Transaction) error {
+	if err := ledger.VerifyTransaction(tx); err != nil {
+		return fmt.Errorf("invalid signature: %w", err)
+	}
+	return state.ApplyTransaction(tx)
+}
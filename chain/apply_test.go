@@ -0,0 +1,246 @@
+package chain
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/ArchivasNetwork/archivas/ledger"
+	pkgcrypto "github.com/ArchivasNetwork/archivas/pkg/crypto"
+	txv1 "github.com/ArchivasNetwork/archivas/pkg/tx/v1"
+)
+
+// testKey is a funded test account able to sign transfers
+type testKey struct {
+	addr string
+	priv ed25519.PrivateKey
+	pub  ed25519.PublicKey
+}
+
+func newTestKey(t *testing.T) testKey {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	addr, err := pkgcrypto.PubKeyToAddress(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testKey{addr: addr, priv: priv, pub: pub}
+}
+
+// transfer returns a signed transfer of amount from k to to
+func (k testKey) transfer(t *testing.T, to string, amount int64, nonce uint64) ledger.Transaction {
+	tx := &txv1.Transfer{Type: "transfer", From: k.addr, To: to, Amount: uint64(amount), Fee: 1, Nonce: nonce}
+	sig, _, _, err := txv1.Sign(k.priv, tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ledger.Transaction{From: k.addr, To: to, Amount: amount, Fee: 1, Nonce: nonce, SenderPubKey: k.pub, Signature: sig}
+}
+
+func coinbaseTo(addr string, amount int64) ledger.Transaction {
+	return ledger.Transaction{From: CoinbaseSender, To: addr, Amount: amount}
+}
+
+func TestApplyBlock(t *testing.T) {
+	alice, bob := newTestKey(t), newTestKey(t)
+	genesis := map[string]int64{alice.addr: 1000}
+
+	forged := alice.transfer(t, bob.addr, 100, 0)
+	forged.Amount = 900
+
+	tests := []struct {
+		name     string
+		coinbase []ledger.Transaction
+		pending  []ledger.Transaction
+		selected int     // Pending transfers production keeps
+		balances []int64 // Alice and bob after the block
+		badBlock []int   // Pending txs that make the block invalid when included
+	}{
+		{
+			name:     "coinbase only",
+			coinbase: []ledger.Transaction{coinbaseTo(bob.addr, 50)},
+			balances: []int64{1000, 50},
+		},
+		{
+			name:     "transfers in nonce order",
+			pending:  []ledger.Transaction{alice.transfer(t, bob.addr, 100, 0), alice.transfer(t, bob.addr, 200, 1)},
+			selected: 2,
+			balances: []int64{698, 300},
+		},
+		{
+			name:     "transfer funded by the same block's coinbase",
+			coinbase: []ledger.Transaction{coinbaseTo(bob.addr, 50)},
+			pending:  []ledger.Transaction{bob.transfer(t, alice.addr, 40, 0)},
+			selected: 1,
+			balances: []int64{1040, 9},
+		},
+		{
+			name:     "bad nonce skipped by production, rejected on import",
+			pending:  []ledger.Transaction{alice.transfer(t, bob.addr, 100, 5), alice.transfer(t, bob.addr, 100, 0)},
+			selected: 1,
+			balances: []int64{899, 100},
+			badBlock: []int{0, 1},
+		},
+		{
+			name:     "forged signature skipped by production, rejected on import",
+			pending:  []ledger.Transaction{forged},
+			balances: []int64{1000, 0},
+			badBlock: []int{0},
+		},
+		{
+			name:     "overspend skipped by production, rejected on import",
+			pending:  []ledger.Transaction{alice.transfer(t, bob.addr, 1000, 0)},
+			balances: []int64{1000, 0},
+			badBlock: []int{0},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			parent := ledger.NewWorldState(genesis)
+			before := parent.Clone()
+
+			// Production: select valid pending transfers and apply the block
+			selected, _ := SelectTransactions(parent, tc.coinbase, tc.pending)
+			if len(selected) != tc.selected {
+				t.Fatalf("expected %d selected transfers, got %d", tc.selected, len(selected))
+			}
+			produced := &Block{Height: 1, Txs: append(append([]ledger.Transaction(nil), tc.coinbase...), selected...)}
+			produceState, receipts, err := ApplyBlock(parent, produced)
+			if err != nil {
+				t.Fatalf("produced block rejected: %v", err)
+			}
+			if len(receipts) != len(produced.Txs) {
+				t.Fatalf("expected %d receipts, got %d", len(produced.Txs), len(receipts))
+			}
+			if got := []int64{produceState.GetBalance(alice.addr), produceState.GetBalance(bob.addr)}; !reflect.DeepEqual(got, tc.balances) {
+				t.Fatalf("expected balances %v, got %v", tc.balances, got)
+			}
+
+			// Import: the same block re-applied by a peer gives identical state
+			imported := &Block{Height: produced.Height, Txs: append([]ledger.Transaction(nil), produced.Txs...)}
+			importState, _, err := ApplyBlock(ledger.NewWorldState(genesis), imported)
+			if err != nil {
+				t.Fatalf("re-imported block rejected: %v", err)
+			}
+			if !reflect.DeepEqual(produceState.State().Accounts, importState.State().Accounts) {
+				t.Fatal("produced and re-imported states differ")
+			}
+
+			// A block carrying the invalid transfers is rejected
+			if len(tc.badBlock) > 0 {
+				bad := &Block{Height: 1, Txs: append([]ledger.Transaction(nil), tc.coinbase...)}
+				for _, i := range tc.badBlock {
+					bad.Txs = append(bad.Txs, tc.pending[i])
+				}
+				if _, _, err := ApplyBlock(parent, bad); err == nil {
+					t.Fatal("expected block with invalid transfer to be rejected")
+				}
+			}
+
+			if !reflect.DeepEqual(parent.Accounts, before.Accounts) {
+				t.Fatal("parent state was modified")
+			}
+
+			// Committing the produced state writes only the accounts it changed
+			produceState.Commit()
+			if !reflect.DeepEqual(parent.Accounts, importState.State().Accounts) {
+				t.Fatal("committed state differs from the block's state")
+			}
+		})
+	}
+}
+
+func TestApplyBlockOverlay(t *testing.T) {
+	alice, bob := newTestKey(t), newTestKey(t)
+	genesis := map[string]int64{alice.addr: 1000}
+	for i := 0; i < 100; i++ {
+		genesis[newTestKey(t).addr] = 1
+	}
+	parent := ledger.NewWorldState(genesis)
+
+	state, _, err := ApplyBlock(parent, &Block{Height: 1, Txs: []ledger.Transaction{alice.transfer(t, bob.addr, 100, 0)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.changes.Accounts) != 2 {
+		t.Fatalf("expected the overlay to hold the 2 accounts the block touches, got %d", len(state.changes.Accounts))
+	}
+	if state.GetAccount(alice.addr) == parent.Accounts[alice.addr] {
+		t.Fatal("overlay shares a changed account with its parent")
+	}
+	if got := state.State(); len(got.Accounts) != len(genesis)+1 || got.GetBalance(bob.addr) != 100 {
+		t.Fatal("overlay doesn't see through to the parent's accounts")
+	}
+}
+
+func TestApplyBlockLenient(t *testing.T) {
+	alice, bob := newTestKey(t), newTestKey(t)
+	parent := ledger.NewWorldState(map[string]int64{alice.addr: 1000})
+
+	// Blocks predating strict transactions skipped failing transfers and
+	// didn't check coinbase order
+	block := &Block{Height: 1, Txs: []ledger.Transaction{
+		alice.transfer(t, bob.addr, 5000, 0),
+		alice.transfer(t, bob.addr, 100, 0),
+		coinbaseTo(bob.addr, 50),
+	}}
+	if _, _, err := ApplyBlock(parent, block); err == nil {
+		t.Fatal("expected strict block to be rejected")
+	}
+	state, receipts, err := ApplyBlockWithOptions(parent, block, ApplyOptions{Lenient: true})
+	if err != nil {
+		t.Fatalf("expected lenient block to apply: %v", err)
+	}
+	if !receipts[0].Skipped || receipts[1].Skipped {
+		t.Fatalf("expected only the overspend skipped, got %+v", receipts)
+	}
+	if got := []int64{state.GetBalance(alice.addr), state.GetBalance(bob.addr)}; !reflect.DeepEqual(got, []int64{899, 150}) {
+		t.Fatalf("expected balances [899 150], got %v", got)
+	}
+
+	// but signatures are verified all the same
+	unsigned := alice.transfer(t, bob.addr, 100, 0)
+	unsigned.Signature = nil
+	block.Txs[1] = unsigned
+	if _, _, err := ApplyBlockWithOptions(parent, block, ApplyOptions{Lenient: true}); err == nil {
+		t.Fatal("expected unsigned transfer to fail a lenient block")
+	}
+}
+
+func TestApplyBlockCoinbaseOrder(t *testing.T) {
+	alice, bob := newTestKey(t), newTestKey(t)
+	parent := ledger.NewWorldState(map[string]int64{alice.addr: 1000})
+
+	block := &Block{Height: 1, Txs: []ledger.Transaction{alice.transfer(t, bob.addr, 100, 0), coinbaseTo(bob.addr, 50)}}
+	if _, _, err := ApplyBlock(parent, block); !errors.Is(err, ErrCoinbaseOrder) {
+		t.Fatalf("expected ErrCoinbaseOrder, got %v", err)
+	}
+}
+
+func TestApplyBlockSkipSignatures(t *testing.T) {
+	alice, bob := newTestKey(t), newTestKey(t)
+	parent := ledger.NewWorldState(map[string]int64{alice.addr: 1000})
+
+	unsigned := alice.transfer(t, bob.addr, 100, 0)
+	unsigned.Signature = nil
+	block := &Block{Height: 1, Txs: []ledger.Transaction{unsigned}}
+	if _, _, err := ApplyBlock(parent, block); err == nil {
+		t.Fatal("expected unsigned transfer to be rejected")
+	}
+
+	state, _, err := ApplyBlockWithOptions(parent, block, ApplyOptions{SkipSignatures: true})
+	if err != nil {
+		t.Fatalf("expected assumed-valid block to apply: %v", err)
+	}
+	if got := state.GetBalance(bob.addr); got != 100 {
+		t.Fatalf("expected bob to hold 100, got %d", got)
+	}
+
+	// Balances are still enforced below the checkpoint
+	unsigned.Amount = 5000
+	block.Txs[0] = unsigned
+	if _, _, err := ApplyBlockWithOptions(parent, block, ApplyOptions{SkipSignatures: true}); err == nil {
+		t.Fatal("expected overspend to be rejected")
+	}
+}
@@ -0,0 +1,70 @@
+package chain
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"maps"
+	"slices"
+
+	"github.com/ArchivasNetwork/archivas/ledger"
+)
+
+// Block roots
+//
+// From an activation height set in genesis, a block commits to its
+// transactions and to the state it leaves behind, and both roots are part of
+// the block hash. The tx root hashes the relay hashes (ledger.TxHash) of the
+// block's transactions in order. The state root chains the parent's state
+// root with every account the block touched, as it is after the block; the
+// first block carrying roots starts the chain from all accounts. By
+// induction the state root commits to every account while costing only the
+// accounts a block touches to compute.
+
+// TxRoot returns the root of a block's transactions
+func TxRoot(txs []ledger.Transaction) [32]byte {
+	h := sha256.New()
+	for _, tx := range txs {
+		hash := ledger.TxHash(tx)
+		h.Write(hash[:])
+	}
+	return [32]byte(h.Sum(nil))
+}
+
+// StateRoot returns the state root of state, reached from the state whose
+// root is parentRoot by a block touching the accounts in touched. A zero
+// parentRoot starts the chain from every account of state.
+func StateRoot(parentRoot [32]byte, state *ledger.WorldState, touched []string) [32]byte {
+	if parentRoot == ([32]byte{}) {
+		touched = slices.Collect(maps.Keys(state.Accounts))
+	} else {
+		touched = slices.Clone(touched)
+	}
+	slices.Sort(touched)
+	touched = slices.Compact(touched)
+
+	h := sha256.New()
+	h.Write(parentRoot[:])
+	for _, addr := range touched {
+		binary.Write(h, binary.BigEndian, uint32(len(addr)))
+		h.Write([]byte(addr))
+		acct, ok := state.Accounts[addr]
+		if !ok {
+			h.Write([]byte{0})
+			continue
+		}
+		h.Write([]byte{1})
+		binary.Write(h, binary.BigEndian, acct.Balance)
+		binary.Write(h, binary.BigEndian, acct.Nonce)
+	}
+	return [32]byte(h.Sum(nil))
+}
+
+// StateRoot returns the state root of the state after the block, as
+// StateRoot does. Only the first block carrying roots copies the whole state.
+func (o *Overlay) StateRoot(parentRoot [32]byte, touched []string) [32]byte {
+	if parentRoot == ([32]byte{}) {
+		return StateRoot(parentRoot, o.State(), nil)
+	}
+	// Every touched account the block doesn't hold is missing from the parent too
+	return StateRoot(parentRoot, o.changes, touched)
+}
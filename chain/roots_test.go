@@ -0,0 +1,58 @@
+package chain
+
+import (
+	"testing"
+
+	"github.com/ArchivasNetwork/archivas/ledger"
+)
+
+func TestBlockRoots(t *testing.T) {
+	alice, bob := newTestKey(t), newTestKey(t)
+	parent := ledger.NewWorldState(map[string]int64{alice.addr: 1000})
+	parentRoot := StateRoot([32]byte{}, parent, nil)
+
+	block := &Block{Height: 1, Txs: []ledger.Transaction{coinbaseTo(bob.addr, 50), alice.transfer(t, bob.addr, 100, 0)}}
+	state, receipts, err := ApplyBlock(parent, block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var touched []string
+	for _, r := range receipts {
+		touched = append(touched, r.Accounts...)
+	}
+
+	// The chained root matches whether the block is applied on top of the
+	// parent's root or the roots start at this block from the whole state
+	root := state.StateRoot(parentRoot, touched)
+	if root != StateRoot(parentRoot, state.State(), []string{bob.addr, alice.addr}) {
+		t.Fatal("state root depends on the order accounts were touched in")
+	}
+	if root == state.StateRoot([32]byte{}, nil) {
+		t.Fatal("chained root equals a root started from the same state")
+	}
+	if state.StateRoot([32]byte{}, nil) != StateRoot([32]byte{}, state.State(), nil) {
+		t.Fatal("overlay root started from its state differs from the state's")
+	}
+
+	// Any difference in the resulting state changes the root
+	tampered := state.State()
+	tampered.Accounts[bob.addr].Balance++
+	if StateRoot(parentRoot, tampered, touched) == root {
+		t.Fatal("state root ignores balances")
+	}
+	if state.StateRoot(StateRoot([32]byte{}, tampered, nil), touched) == root {
+		t.Fatal("state root ignores the parent root")
+	}
+
+	// Dropping, reordering or altering a transaction changes the tx root
+	txRoot := TxRoot(block.Txs)
+	for _, txs := range [][]ledger.Transaction{
+		block.Txs[:1],
+		{block.Txs[1], block.Txs[0]},
+		{block.Txs[0], alice.transfer(t, bob.addr, 99, 0)},
+	} {
+		if TxRoot(txs) == txRoot {
+			t.Fatal("tx root doesn't commit to the transactions")
+		}
+	}
+}
@@ -8,13 +8,16 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"math/rand"
 	"net/http"
 	"os"
 	"path/filepath"
+	"runtime"
 	"time"
 
 	"github.com/decred/dcrd/dcrec/secp256k1/v4"
 	"github.com/ArchivasNetwork/archivas/address"
+	"github.com/ArchivasNetwork/archivas/consensus"
 	"github.com/ArchivasNetwork/archivas/logging"
 	"github.com/ArchivasNetwork/archivas/metrics"
 	"github.com/ArchivasNetwork/archivas/pospace"
@@ -36,6 +39,8 @@ func main() {
 		cmdPlot()
 	case "farm":
 		cmdFarm()
+	case "check":
+		cmdCheck()
 	default:
 		fmt.Printf("Unknown command: %s\n\n", command)
 		printUsage()
@@ -49,16 +54,29 @@ func printUsage() {
 	fmt.Println("Usage:")
 	fmt.Println("  archivas-farmer plot [flags]   Generate a plot file")
 	fmt.Println("  archivas-farmer farm [flags]   Start farming")
+	fmt.Println("  archivas-farmer check [flags]  Check plot integrity and expected rewards")
 	fmt.Println()
 	fmt.Println("Plot flags:")
 	fmt.Println("  --path <dir>            Directory to store plot (default: ./plots)")
 	fmt.Println("  --size <k>              Plot size parameter k (2^k hashes, default: 20)")
 	fmt.Println("  --farmer-pubkey <hex>   Farmer public key (compressed, 33 bytes hex)")
+	fmt.Println("  --seed <hex>            Plot seed (32 bytes hex, default: random)")
+	fmt.Println("  --pool-pubkey <hex>     Pool public key to commit the plot to (compressed, 33 bytes hex)")
+	fmt.Println("  --pool-address <addr>   Pool payout/contract address (arcv1... or 0x...)")
+	fmt.Println("  --threads <n>           Plotting workers (default: number of CPUs)")
+	fmt.Println("  --resume                Resume unfinished plots in --path instead of starting a new one")
 	fmt.Println()
 	fmt.Println("Farm flags:")
 	fmt.Println("  --plots <dir>           Directory containing plots (default: ./plots)")
 	fmt.Println("  --node <url>            Node RPC URL (default: http://localhost:8080)")
 	fmt.Println("  --farmer-privkey <hex>  Farmer PRIVATE key (32 bytes hex) ⚠️ KEEP SECRET!")
+	fmt.Println()
+	fmt.Println("Check flags:")
+	fmt.Println("  --plots <dir>           Directory containing plots (default: ./plots)")
+	fmt.Println("  --samples <n>           Random entries to recompute per plot (default: 1000)")
+	fmt.Println("  --challenges <n>        Simulated challenges per plot (default: 100)")
+	fmt.Println("  --difficulty <n>        Difficulty target for simulation (default: initial difficulty)")
+	fmt.Println("  --node <url>            Take the current difficulty from this node instead")
 }
 
 func cmdPlot() {
@@ -66,12 +84,22 @@ func cmdPlot() {
 	plotPath := plotFlags.String("path", "./plots", "Plot directory")
 	kSize := plotFlags.Int("size", 20, "Plot size (k parameter)")
 	farmerPubKeyHex := plotFlags.String("farmer-pubkey", "", "Farmer public key (compressed, 33 bytes hex)")
+	plotSeedHex := plotFlags.String("seed", "", "Plot seed (32 bytes hex, default: random)")
+	poolPubKeyHex := plotFlags.String("pool-pubkey", "", "Pool public key (compressed, 33 bytes hex)")
+	poolAddrStr := plotFlags.String("pool-address", "", "Pool payout/contract address (arcv1... or 0x...)")
+	threads := plotFlags.Int("threads", runtime.NumCPU(), "Number of plotting workers")
+	resume := plotFlags.Bool("resume", false, "Resume unfinished plots in --path")
 
 	plotFlags.Parse(os.Args[2:])
 
+	if *resume {
+		resumePlots(*plotPath, *threads)
+		return
+	}
+
 	// Validate parameters
-	if *kSize < 10 || *kSize > 32 {
-		fmt.Println("Error: k size must be between 10 and 32")
+	if *kSize < consensus.MinPlotKSize || *kSize > pospace.MaxKSize {
+		fmt.Printf("Error: k size must be between %d and %d\n", consensus.MinPlotKSize, pospace.MaxKSize)
 		os.Exit(1)
 	}
 
@@ -104,29 +132,229 @@ func cmdPlot() {
 		}
 	}
 
+	// Parse or generate plot seed (makes every plot of this farmer unique)
+	var plotSeed [32]byte
+	if *plotSeedHex == "" {
+		var err error
+		plotSeed, err = pospace.NewPlotSeed()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	} else {
+		seedBytes, err := hex.DecodeString(*plotSeedHex)
+		if err != nil || len(seedBytes) != 32 {
+			fmt.Println("Error: --seed must be 32 bytes (64 hex chars)")
+			os.Exit(1)
+		}
+		copy(plotSeed[:], seedBytes)
+	}
+
+	// Resolve the pool the plot commits to (solo if none)
+	poolAddress, err := parsePoolAddress(*poolPubKeyHex, *poolAddrStr)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	plotID := pospace.ComputePlotID(farmerPubKey, poolAddress, plotSeed)
+
 	// Create plot directory
 	if err := os.MkdirAll(*plotPath, 0755); err != nil {
 		fmt.Fprintf(os.Stderr, "Error creating plot directory: %v\n", err)
 		os.Exit(1)
 	}
 
-	// Generate plot filename
-	plotFile := filepath.Join(*plotPath, fmt.Sprintf("plot-k%d.arcv", *kSize))
+	// Refuse to re-create a plot that already exists
+	existing, err := loadPlots(*plotPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading plot directory: %v\n", err)
+		os.Exit(1)
+	}
+	for _, p := range existing {
+		duplicate := p.Header.PlotID == plotID
+		p.Close()
+		if duplicate {
+			fmt.Printf("Error: plot %x already exists at %s\n", plotID[:8], p.Path)
+			os.Exit(1)
+		}
+	}
+	unfinished, err := pospace.FindUnfinishedPlots(*plotPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading plot directory: %v\n", err)
+		os.Exit(1)
+	}
+	for _, path := range unfinished {
+		if id, err := pospace.UnfinishedPlotID(path); err == nil && id == plotID {
+			fmt.Printf("Error: plot %x is already being created at %s (finish it with --resume)\n", plotID[:8], path)
+			os.Exit(1)
+		}
+	}
+
+	// Generate plot filename (unique per plot ID)
+	plotFile := filepath.Join(*plotPath, fmt.Sprintf("plot-k%d-%x.arcv", *kSize, plotID[:8]))
+	if _, err := os.Stat(plotFile); err == nil {
+		fmt.Printf("Error: %s already exists\n", plotFile)
+		os.Exit(1)
+	}
 
 	fmt.Printf("🌾 Generating plot with k=%d (%d hashes)\n", *kSize, uint64(1)<<*kSize)
 	fmt.Printf("📁 Output: %s\n", plotFile)
 	fmt.Printf("👨‍🌾 Farmer: %s\n", hex.EncodeToString(farmerPubKey))
+	fmt.Printf("🆔 Plot ID: %x (seed: %x)\n", plotID, plotSeed)
+	if poolAddress != ([20]byte{}) {
+		poolARCV, _ := address.EncodeARCVAddress(address.EVMAddress(poolAddress), "arcv")
+		fmt.Printf("🏊 Pool: %s\n", poolARCV)
+	} else {
+		fmt.Printf("🏊 Pool: none (solo plot)\n")
+	}
+	fmt.Println()
+
+	plotter, err := pospace.NewPlotter(plotFile, uint32(*kSize), farmerPubKey, poolAddress, plotSeed, *threads)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("🧵 Workers: %d (interrupted plots continue with --resume)\n", plotter.Threads)
 	fmt.Println()
 
+	runPlotter(plotter)
+}
+
+// resumePlots continues every unfinished plot found in dir
+func resumePlots(dir string, threads int) {
+	paths, err := pospace.FindUnfinishedPlots(dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading plot directory: %v\n", err)
+		os.Exit(1)
+	}
+	if len(paths) == 0 {
+		fmt.Printf("No unfinished plots in %s\n", dir)
+		return
+	}
+
+	for _, path := range paths {
+		plotter, err := pospace.ResumePlotter(path, threads)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error resuming %s: %v\n", path, err)
+			os.Exit(1)
+		}
+		fmt.Printf("🔁 Resuming %s (%d/%d tables done, %d workers)\n",
+			path, plotter.CompletedTables(), pospace.NumTables, plotter.Threads)
+		runPlotter(plotter)
+	}
+}
+
+// runPlotter runs a plotter to completion and reports the result
+func runPlotter(plotter *pospace.Plotter) {
+	plotter.Progress = func(table, entries int) {
+		fmt.Printf("Table %d/%d: %d entries\n", table, pospace.NumTables, entries)
+	}
 	start := time.Now()
-	if err := pospace.GeneratePlot(plotFile, uint32(*kSize), farmerPubKey); err != nil {
+	if err := plotter.Run(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error generating plot: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Progress is checkpointed; rerun with --resume to continue\n")
 		os.Exit(1)
 	}
 
 	duration := time.Since(start)
 	fmt.Printf("\n✅ Plot generated successfully in %v\n", duration)
-	fmt.Printf("📊 Plot size: ~%.2f MB\n", float64(uint64(1)<<*kSize*32)/(1024*1024))
+	if info, err := os.Stat(plotter.Path); err == nil {
+		fmt.Printf("📊 Plot size: ~%.2f MB\n", float64(info.Size())/(1024*1024))
+	}
+}
+
+func cmdCheck() {
+	checkFlags := flag.NewFlagSet("check", flag.ExitOnError)
+	plotsDir := checkFlags.String("plots", "./plots", "Plots directory")
+	samples := checkFlags.Int("samples", 1000, "Random entries to recompute per plot")
+	challenges := checkFlags.Int("challenges", 100, "Simulated challenges per plot")
+	difficulty := checkFlags.Uint64("difficulty", consensus.InitialDifficulty, "Difficulty target for simulation")
+	nodeURL := checkFlags.String("node", "", "Node RPC URL to take the current difficulty from")
+
+	checkFlags.Parse(os.Args[2:])
+
+	if *nodeURL != "" {
+		info, err := getChallenge(*nodeURL)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error getting difficulty from node: %v\n", err)
+			os.Exit(1)
+		}
+		*difficulty = info.Difficulty
+	}
+
+	files, err := os.ReadDir(*plotsDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading plots directory: %v\n", err)
+		os.Exit(1)
+	}
+
+	blocksPerDay := float64(24*time.Hour/time.Second) / float64(consensus.DefaultDifficultyParams().TargetBlockTime)
+	fmt.Printf("🔍 Checking plots in %s (difficulty %d, %d samples, %d challenges)\n",
+		*plotsDir, *difficulty, *samples, *challenges)
+
+	checked, corrupted := 0, 0
+	totalPerDay := 0.0
+	for _, f := range files {
+		if f.IsDir() || filepath.Ext(f.Name()) != ".arcv" {
+			continue
+		}
+		checked++
+
+		perDay, err := checkPlot(filepath.Join(*plotsDir, f.Name()), *samples, *challenges, *difficulty, blocksPerDay)
+		if err != nil {
+			fmt.Printf("❌ %s: %v\n", f.Name(), err)
+			corrupted++
+			continue
+		}
+		fmt.Printf("✅ %s: ~%.3f proofs/day\n", f.Name(), perDay)
+		totalPerDay += perDay
+	}
+
+	fmt.Println()
+	fmt.Printf("Checked %d plot(s): %d ok, %d corrupted\n", checked, checked-corrupted, corrupted)
+	fmt.Printf("Expected proofs/day (healthy plots): ~%.3f\n", totalPerDay)
+	if corrupted > 0 {
+		os.Exit(1)
+	}
+}
+
+// checkPlot validates one plot and returns its expected proofs per day
+func checkPlot(path string, samples, challenges int, difficulty uint64, blocksPerDay float64) (float64, error) {
+	plot, err := pospace.OpenPlot(path)
+	if err != nil {
+		return 0, err
+	}
+	defer plot.Close()
+
+	if err := plot.ValidateHeader(); err != nil {
+		return 0, fmt.Errorf("invalid header: %w", err)
+	}
+
+	fmt.Printf("   %s: v%d k=%d, %d entries, plot ID %x\n",
+		filepath.Base(path), plot.Header.Version, plot.Header.KSize, plot.Header.NumHashes, plot.Header.PlotID[:8])
+
+	bad := 0
+	for i := 0; i < samples; i++ {
+		idx := uint64(rand.Int63n(int64(plot.Header.NumHashes)))
+		if err := plot.VerifyEntry(idx); err != nil {
+			if bad < 5 {
+				fmt.Printf("   ⚠️  %v\n", err)
+			}
+			bad++
+		}
+	}
+	if bad > 0 {
+		return 0, fmt.Errorf("%d of %d sampled entries are corrupted", bad, samples)
+	}
+
+	if challenges <= 0 {
+		return 0, nil
+	}
+	wins, err := plot.SimulateChallenges(challenges, difficulty)
+	if err != nil {
+		return 0, err
+	}
+	return float64(wins) / float64(challenges) * blocksPerDay, nil
 }
 
 func cmdFarm() {
@@ -185,9 +413,27 @@ func cmdFarm() {
 		os.Exit(1)
 	}
 
+	// Blocks are signed with the farmer key, so only plots made for it can win
+	owned := plots[:0]
+	for _, p := range plots {
+		if !bytes.Equal(p.Header.FarmerPubKey[:], farmerPubKey) {
+			fmt.Printf("⚠️  Skipping %s: plotted for another farmer key\n", filepath.Base(p.Path))
+			continue
+		}
+		owned = append(owned, p)
+	}
+	plots = owned
+	if len(plots) == 0 {
+		fmt.Println("⚠️  No plots for this farmer key! Plot with --farmer-pubkey matching --farmer-privkey")
+		os.Exit(1)
+	}
+
 	fmt.Printf("✅ Loaded %d plot(s)\n", len(plots))
 	for _, p := range plots {
-		fmt.Printf("   - %s (k=%d, %d hashes)\n", filepath.Base(p.Path), p.Header.KSize, p.Header.NumHashes)
+		fmt.Printf("   - %s (v%d, k=%d, %d entries)\n", filepath.Base(p.Path), p.Header.Version, p.Header.KSize, p.Header.NumHashes)
+		if !p.Indexed() {
+			fmt.Printf("     ⚠️  Unindexed plot: every challenge scans the whole file, re-plot to migrate\n")
+		}
 	}
 	fmt.Println()
 	fmt.Println("🚜 Starting farming loop...")
@@ -238,7 +484,7 @@ func cmdFarm() {
 			fmt.Printf("🎉 Found winning proof! Quality: %d (target: %d)\n", bestProof.Quality, challengeInfo.Difficulty)
 
 			// Submit block with VDF info
-			if err := submitBlock(*nodeURL, bestProof, farmerAddr, farmerPubKey, privKeyBytes, challengeInfo); err != nil {
+			if err := submitBlock(*nodeURL, bestProof, farmerAddr, privKeyBytes, challengeInfo); err != nil {
 				fmt.Printf("❌ Error submitting block: %v\n", err)
 			} else {
 				vdfIter := uint64(0)
@@ -296,12 +542,28 @@ func getChallenge(nodeURL string) (*ChallengeInfo, error) {
 	return &info, nil
 }
 
-func submitBlock(nodeURL string, proof *pospace.Proof, farmerAddr string, farmerPubKey []byte, privKey []byte, challenge *ChallengeInfo) error {
+func submitBlock(nodeURL string, proof *pospace.Proof, farmerAddr string, privKey []byte, challenge *ChallengeInfo) error {
+	// Once blocks commit to their contents the node builds the block and the
+	// farmer signs its hash, so nobody else can claim the reward for this proof
+	blockHash, err := requestBlockTemplate(nodeURL, proof, farmerAddr)
+	if err != nil {
+		return err
+	}
+	if blockHash != nil {
+		return postBlock(nodeURL, map[string]interface{}{
+			"hash":      hex.EncodeToString(blockHash),
+			"signature": hex.EncodeToString(consensus.SignBlockHash(privKey, [32]byte(blockHash))),
+		})
+	}
+
+	// Otherwise sign the farmer header
+	sig := consensus.SignFarmerHeader(privKey, challenge.Height, proof, farmerAddr)
+
 	// Create block submission (VDF fields only if available)
 	submission := map[string]interface{}{
-		"proof":        proof,
-		"farmerAddr":   farmerAddr,
-		"farmerPubKey": hex.EncodeToString(farmerPubKey),
+		"proof":      proof,
+		"farmerAddr": farmerAddr,
+		"signature":  hex.EncodeToString(sig),
 	}
 
 	// Add VDF info if present (for PoSpace+Time mode)
@@ -313,6 +575,53 @@ func submitBlock(nodeURL string, proof *pospace.Proof, farmerAddr string, farmer
 		submission["vdfOutput"] = vdfOutput
 	}
 
+	return postBlock(nodeURL, submission)
+}
+
+// requestBlockTemplate asks the node to build the block proof wins and
+// returns the block hash to sign, or nil if the node expects a signed farmer
+// header instead (as do nodes that predate block templates)
+func requestBlockTemplate(nodeURL string, proof *pospace.Proof, farmerAddr string) ([]byte, error) {
+	data, err := json.Marshal(map[string]interface{}{
+		"proof":      proof,
+		"farmerAddr": farmerAddr,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.Post(nodeURL+"/blockTemplate", "application/json", bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusNotImplemented {
+		return nil, nil
+	}
+	if resp.StatusCode != 200 {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body))
+	}
+
+	var template struct {
+		Hash string `json:"hash"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&template); err != nil {
+		return nil, err
+	}
+	if template.Hash == "" {
+		return nil, nil
+	}
+	hash, err := hex.DecodeString(template.Hash)
+	if err != nil || len(hash) != 32 {
+		return nil, fmt.Errorf("invalid block template hash %q", template.Hash)
+	}
+	return hash, nil
+}
+
+// postBlock submits a block to the node
+func postBlock(nodeURL string, submission map[string]interface{}) error {
 	data, err := json.Marshal(submission)
 	if err != nil {
 		return err
@@ -361,6 +670,31 @@ func loadPlots(dir string) ([]*pospace.PlotFile, error) {
 	return plots, nil
 }
 
+// parsePoolAddress resolves the pool payout address from --pool-pubkey or --pool-address
+func parsePoolAddress(poolPubKeyHex, poolAddr string) ([20]byte, error) {
+	switch {
+	case poolPubKeyHex != "" && poolAddr != "":
+		return [20]byte{}, fmt.Errorf("use either --pool-pubkey or --pool-address, not both")
+	case poolPubKeyHex != "":
+		pubKeyBytes, err := hex.DecodeString(poolPubKeyHex)
+		if err != nil || len(pubKeyBytes) != 33 {
+			return [20]byte{}, fmt.Errorf("--pool-pubkey must be 33 bytes (66 hex chars) compressed public key")
+		}
+		pubKey, err := secp256k1.ParsePubKey(pubKeyBytes)
+		if err != nil {
+			return [20]byte{}, fmt.Errorf("invalid --pool-pubkey: %w", err)
+		}
+		return address.PublicKeyToEVMAddress(pubKey.ToECDSA()), nil
+	case poolAddr != "":
+		evmAddr, err := address.ParseAddress(poolAddr, "arcv")
+		if err != nil {
+			return [20]byte{}, fmt.Errorf("invalid --pool-address: %w", err)
+		}
+		return evmAddr, nil
+	}
+	return [20]byte{}, nil
+}
+
 func deriveFarmerAddress(privKey []byte) (string, []byte, error) {
 	// Use UNIFIED Ethereum-compatible derivation
 	evmAddr, err := address.PrivateKeyToEVMAddress(privKey)
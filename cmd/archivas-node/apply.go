@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/ArchivasNetwork/archivas/chain"
+	"github.com/ArchivasNetwork/archivas/ledger"
+)
+
+// Block state transition
+//
+// Blocks built by AcceptBlock, blocks imported from peers and blocks
+// downloaded during IBD all go through chain.ApplyBlock, so every node
+// derives the same world state from the same chain. Blocks below the strict
+// transaction activation height are applied leniently, the way they were
+// when produced. From the roots activation height, blocks also commit to
+// their transactions and resulting state (see chain/roots.go), which are
+// checked after applying them.
+
+// txAccounts returns the addresses whose state the transactions can change
+func txAccounts(txs []ledger.Transaction) []string {
+	addrs := make([]string, 0, 2*len(txs))
+	for _, tx := range txs {
+		if tx.From != "coinbase" {
+			addrs = append(addrs, tx.From)
+		}
+		addrs = append(addrs, tx.To)
+	}
+	return addrs
+}
+
+// applyBlock runs the shared state transition of b on top of ws and returns
+// the resulting state, to be committed into ws once b is accepted. With
+// assumeValid set transfer signatures aren't checked, for blocks below the
+// assume-valid block. (caller must hold lock)
+func (ns *NodeState) applyBlock(ws *ledger.WorldState, b *Block, assumeValid bool) (*chain.Overlay, error) {
+	opts := chain.ApplyOptions{SkipSignatures: assumeValid, Lenient: b.Height < ns.Upgrades.StrictTxs}
+	state, _, err := chain.ApplyBlockWithOptions(ws, &chain.Block{Height: b.Height, Txs: b.Txs}, opts)
+	return state, err
+}
+
+// blockRoots returns the tx root of b and the root of state, the state b
+// leaves behind on top of parent
+func blockRoots(parent, b *Block, state *chain.Overlay) ([32]byte, [32]byte) {
+	return chain.TxRoot(b.Txs), state.StateRoot(parent.StateRoot, txAccounts(b.Txs))
+}
+
+// checkRoots verifies the roots b commits to against its transactions and
+// state, the state it leaves behind on top of parent. Blocks below the
+// roots activation height carry none. (caller must hold lock)
+func (ns *NodeState) checkRoots(parent, b *Block, state *chain.Overlay) error {
+	if b.Height < ns.Upgrades.BlockRoots {
+		if b.TxRoot != ([32]byte{}) || b.StateRoot != ([32]byte{}) {
+			return fmt.Errorf("roots before their activation at %d", ns.Upgrades.BlockRoots)
+		}
+		return nil
+	}
+	txRoot, stateRoot := blockRoots(parent, b, state)
+	if b.TxRoot != txRoot {
+		return fmt.Errorf("tx root %x does not match the block's transactions", b.TxRoot[:8])
+	}
+	if b.StateRoot != stateRoot {
+		return fmt.Errorf("state root %x does not match the resulting state %x", b.StateRoot[:8], stateRoot[:8])
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ArchivasNetwork/archivas/consensus"
+	"github.com/ArchivasNetwork/archivas/p2p"
+	"github.com/ArchivasNetwork/archivas/storage"
+)
+
+// Block tree
+//
+// Peer blocks are connected by parent hash rather than by height. A block
+// extending the best tip is applied directly. A block extending any other
+// known block is stored as a side-chain block and triggers a reorg once its
+// branch has more work than the best chain. A block whose parent is unknown
+// waits in the orphan pool until the parent arrives.
+
+const (
+	maxOrphanBlocks = 256              // Orphans kept before the oldest is evicted
+	orphanTTL       = 10 * time.Minute // Orphans older than this are dropped
+)
+
+// blockIndexEntry returns the storage index entry of a block
+func blockIndexEntry(b *Block) storage.BlockIndexEntry {
+	return storage.BlockIndexEntry{
+		Height:     b.Height,
+		Parent:     b.PrevHash,
+		Difficulty: b.Difficulty,
+	}
+}
+
+// buildBlockTree indexes the best chain plus the side-chain blocks stored
+// within depth blocks of its tip
+func buildBlockTree(chain []Block, blockStore *storage.BlockStorage, depth uint64) *consensus.BlockTree {
+	tree := consensus.NewBlockTree(hashBlock(&chain[0]), chain[0].Difficulty)
+	tip := tree.Best()
+	for i := 1; i < len(chain); i++ {
+		node, err := tree.Add(hashBlock(&chain[i]), tip.Hash, chain[i].Difficulty)
+		if err != nil {
+			log.Fatalf("Failed to index block %d: %v", chain[i].Height, err)
+		}
+		tip = node
+	}
+	tree.SetBest(tip)
+
+	start := uint64(1)
+	if tip.Height > depth {
+		start = tip.Height - depth + 1
+	}
+	for h := start; ; h++ {
+		hashes, err := blockStore.Candidates(h)
+		if err != nil || (len(hashes) == 0 && h > tip.Height) {
+			break
+		}
+		for _, hash := range hashes {
+			if tree.Get(hash) != nil {
+				continue
+			}
+			if entry, err := blockStore.LoadIndex(hash); err == nil {
+				tree.Add(hash, entry.Parent, entry.Difficulty)
+			}
+		}
+	}
+	return tree
+}
+
+// advanceTree adds the block just appended to the chain to the block tree
+// and moves the best-chain pointer to it (caller must hold lock)
+func (ns *NodeState) advanceTree() {
+	tip := &ns.Chain[len(ns.Chain)-1]
+	node, err := ns.Tree.Add(hashBlock(tip), ns.Tree.Best().Hash, tip.Difficulty)
+	if err != nil {
+		log.Printf("[blocktree] Warning: failed to index block %d: %v", tip.Height, err)
+		return
+	}
+	ns.Tree.SetBest(node)
+
+	// Side chains too deep to reorg to are dropped from memory (they stay on disk)
+	if depth := uint64(ns.ReorgDetector.MaxReorgDepth); tip.Height > depth && tip.Height%depth == 0 {
+		ns.Tree.Prune(tip.Height - depth)
+	}
+}
+
+// importBlock connects a peer block to the block tree (caller must hold lock)
+func (ns *NodeState) importBlock(block *Block, raw json.RawMessage) error {
+	hash := hashBlock(block)
+	if ns.Tree.Get(hash) != nil {
+		return nil // Already known
+	}
+
+	parent := ns.Tree.Get(block.PrevHash)
+	if parent == nil {
+		if ns.Orphans.Add(hash, block.PrevHash, raw) {
+			log.Printf("[blocktree] Holding orphan block %d %x (%d orphans)", block.Height, hash[:8], ns.Orphans.Len())
+		}
+		return fmt.Errorf("orphan block %d: parent %x unknown", block.Height, block.PrevHash[:8])
+	}
+	if block.Height != parent.Height+1 {
+		return fmt.Errorf("block height %d does not follow parent height %d", block.Height, parent.Height)
+	}
+
+	if parent == ns.Tree.Best() {
+		return ns.extendChain(*block)
+	}
+	return ns.addSideBlock(block, hash)
+}
+
+// addSideBlock stores a block that doesn't extend the best tip and switches
+// to its branch if that has more work (caller must hold lock)
+func (ns *NodeState) addSideBlock(block *Block, hash [32]byte) error {
+	if ns.BlockStore == nil {
+		return fmt.Errorf("side-chain block %d requires a block store", block.Height)
+	}
+
+	// The header is checked against its own branch before anything is
+	// stored; transactions only once the branch becomes the best chain
+	parents, side, err := ns.branchParents(block.PrevHash)
+	if err != nil {
+		return err
+	}
+	if err := ns.validateBlock(parents, block); err != nil {
+		return invalidBlock(err)
+	}
+	if err := ns.BlockStore.SaveBlock(hash, blockIndexEntry(block), block); err != nil {
+		return fmt.Errorf("failed to store side-chain block %d: %w", block.Height, err)
+	}
+	node, err := ns.Tree.Add(hash, block.PrevHash, block.Difficulty)
+	if err != nil {
+		return err
+	}
+
+	best := ns.Tree.Best()
+	fork := consensus.FindFork(best, node)
+	if !consensus.CompareChains(node.Work, best.Work) {
+		log.Printf("[blocktree] Stored side-chain block %d %x (fork at %d)", block.Height, hash[:8], fork.Height)
+		return nil
+	}
+
+	// The side chain now has more work: switch to it
+	branch := append(side, *block)
+	if _, err := ns.reorganize(branch); err != nil {
+		// A block that fails the reorg can't join the best chain, nor can
+		// its descendants
+		var bad *branchBlockError
+		if errors.As(err, &bad) && errors.Is(invalidBlock(bad.Err), p2p.ErrInvalidBlock) {
+			removed := ns.Tree.Remove(node.Ancestor(bad.Height))
+			log.Printf("[blocktree] Dropped %d side-chain blocks from invalid block %d", removed, bad.Height)
+		}
+		return fmt.Errorf("reorg to side chain at %x failed: %w", hash[:8], err)
+	}
+	return nil
+}
+
+// branchParents returns the blocks up to parent that the header rules look
+// at: the best chain up to the fork point, then the side-chain blocks after
+// it, loaded from the store. The side-chain blocks are also returned on
+// their own. (caller must hold lock)
+func (ns *NodeState) branchParents(parent [32]byte) ([]Block, []Block, error) {
+	node := ns.Tree.Get(parent)
+	fork := consensus.FindFork(ns.Tree.Best(), node)
+
+	side := make([]Block, 0, node.Height-fork.Height+1)
+	for _, n := range consensus.Branch(fork, node) {
+		var b Block
+		if err := ns.BlockStore.LoadBlockByHash(n.Hash, &b); err != nil {
+			return nil, nil, fmt.Errorf("failed to load side-chain block %x: %w", n.Hash[:8], err)
+		}
+		side = append(side, b)
+	}
+
+	keep := uint64(max(ns.DifficultyParams.Window, ns.TimestampParams.MedianSpan) + 1)
+	start := uint64(0)
+	if fork.Height+1 > keep {
+		start = fork.Height + 1 - keep
+	}
+	parents := make([]Block, 0, fork.Height+1-start+uint64(len(side)))
+	parents = append(parents, ns.Chain[start:fork.Height+1]...)
+	parents = append(parents, side...)
+	return parents, side, nil
+}
+
+// connectOrphans imports the orphans descending from parent, now that it is
+// known (caller must hold lock)
+func (ns *NodeState) connectOrphans(parent [32]byte) {
+	queue := [][32]byte{parent}
+	for len(queue) > 0 {
+		children := ns.Orphans.TakeChildren(queue[0])
+		queue = queue[1:]
+		for _, orphan := range children {
+			var block Block
+			if err := json.Unmarshal(orphan.Data, &block); err != nil {
+				continue
+			}
+			if err := ns.importBlock(&block, orphan.Data); err != nil {
+				log.Printf("[blocktree] Orphan block %d %x rejected: %v", block.Height, orphan.Hash[:8], err)
+				continue
+			}
+			queue = append(queue, orphan.Hash)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/ArchivasNetwork/archivas/p2p"
+)
+
+// Headers-first sync
+//
+// A node far behind its peers first downloads the header chain, everything
+// about each block but its transactions, and validates it: hash links,
+// difficulty, timestamps, challenges, farmer signatures and PoSpace proofs.
+// Bodies are then fetched from several peers in parallel and connected in
+// order. A body is only accepted for a validated header, so peers serving
+// bodies can't change what the header chain committed to. Headers below the
+// roots activation don't commit to transactions, so the p2p layer fetches
+// those bodies from the peer that served the headers.
+
+// maxHeadersPerRequest caps the headers served per request
+const maxHeadersPerRequest = 1000
+
+// OnHeadersRequest serves up to maxHeaders headers of the best chain
+// starting at fromHeight
+func (ns *NodeState) OnHeadersRequest(fromHeight uint64, maxHeaders uint32) ([]json.RawMessage, uint64, error) {
+	ns.RLock()
+	defer ns.RUnlock()
+
+	if maxHeaders == 0 || maxHeaders > maxHeadersPerRequest {
+		maxHeaders = maxHeadersPerRequest
+	}
+	if fromHeight < 1 {
+		fromHeight = 1 // Genesis is known from the handshake
+	}
+
+	headers := []json.RawMessage{}
+	for h := fromHeight; h <= ns.CurrentHeight && len(headers) < int(maxHeaders); h++ {
+		header := ns.Chain[h]
+		header.Txs = nil
+		header.CumulativeWork = nil
+		data, err := json.Marshal(header)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to marshal header %d: %w", h, err)
+		}
+		headers = append(headers, data)
+	}
+	return headers, ns.CurrentHeight, nil
+}
+
+// HeaderHeight returns the height of the last validated header, which is
+// the tip when no headers are waiting for bodies
+func (ns *NodeState) HeaderHeight() uint64 {
+	ns.Lock()
+	defer ns.Unlock()
+	ns.trimHeaders()
+	return ns.CurrentHeight + uint64(len(ns.Headers))
+}
+
+// ConnectHeaders validates headers extending the chain and appends them,
+// stopping at the first invalid one or once p2p.MaxPendingHeaders are
+// waiting for bodies. Headers starting at or below the header height
+// replace the validated ones from there. It returns the new header height.
+func (ns *NodeState) ConnectHeaders(headers []json.RawMessage) (uint64, error) {
+	ns.Lock()
+	defer ns.Unlock()
+	ns.trimHeaders()
+
+	var parents []Block
+	for i, data := range headers {
+		var header Block
+		if err := json.Unmarshal(data, &header); err != nil {
+			return ns.CurrentHeight + uint64(len(ns.Headers)), invalidBlock(fmt.Errorf("failed to unmarshal header: %w", err))
+		}
+		header.Txs = nil
+		header.CumulativeWork = nil
+
+		if i == 0 {
+			if header.Height > ns.CurrentHeight && header.Height <= ns.CurrentHeight+uint64(len(ns.Headers)) {
+				ns.Headers = ns.Headers[:header.Height-ns.CurrentHeight-1]
+			}
+			parents = ns.headerParents()
+		}
+		if len(ns.Headers) >= p2p.MaxPendingHeaders {
+			break
+		}
+		next := ns.CurrentHeight + uint64(len(ns.Headers)) + 1
+		if header.Height != next {
+			return next - 1, fmt.Errorf("header height %d doesn't match expected %d", header.Height, next)
+		}
+		if header.Proof == nil {
+			return next - 1, invalidBlock(fmt.Errorf("header %d rejected: missing PoSpace proof", header.Height))
+		}
+		if err := ns.validateHeader(parents, &header); err != nil {
+			return next - 1, invalidBlock(fmt.Errorf("header %d rejected: %w", header.Height, err))
+		}
+		if _, err := ns.assumeValid(&header); err != nil {
+			return next - 1, err
+		}
+		ns.Headers = append(ns.Headers, header)
+		parents = append(parents, header)
+	}
+	return ns.CurrentHeight + uint64(len(ns.Headers)), nil
+}
+
+// ConnectBody connects the block whose header is next above the tip. Only
+// the transactions are taken from blockJSON; the rest comes from the
+// validated header, which the block must hash to.
+func (ns *NodeState) ConnectBody(blockJSON json.RawMessage) error {
+	var body Block
+	if err := json.Unmarshal(blockJSON, &body); err != nil {
+		return invalidBlock(fmt.Errorf("failed to unmarshal block: %w", err))
+	}
+
+	ns.Lock()
+	defer ns.Unlock()
+	ns.trimHeaders()
+
+	if len(ns.Headers) == 0 || ns.Headers[0].Height != body.Height {
+		return fmt.Errorf("no validated header for block %d (tip %d)", body.Height, ns.CurrentHeight)
+	}
+	block := ns.Headers[0]
+	if hashBlock(&body) != hashBlock(&block) {
+		return invalidBlock(fmt.Errorf("block %d does not match its header", body.Height))
+	}
+	block.Txs = body.Txs
+
+	if err := verifyCoinbase(&block); err != nil {
+		return invalidBlock(fmt.Errorf("block %d rejected: invalid coinbase: %w", block.Height, err))
+	}
+	if err := ns.connectBlock(block); err != nil {
+		return err
+	}
+	ns.trimHeaders()
+	return nil
+}
+
+// BodyCommitHeight returns the first height whose header commits to the
+// block's transactions
+func (ns *NodeState) BodyCommitHeight() uint64 {
+	ns.RLock()
+	defer ns.RUnlock()
+	return ns.Upgrades.BlockRoots
+}
+
+// trimHeaders drops headers the chain has caught up with, and all of them
+// once they no longer extend the tip (caller must hold lock)
+func (ns *NodeState) trimHeaders() {
+	for len(ns.Headers) > 0 && ns.Headers[0].Height <= ns.CurrentHeight {
+		ns.Headers = ns.Headers[1:]
+	}
+	if len(ns.Headers) > 0 && ns.Headers[0].PrevHash != hashBlock(&ns.Chain[len(ns.Chain)-1]) {
+		ns.Headers = nil
+	}
+}
+
+// headerParents returns the validated headers preceded by enough of the
+// chain for the difficulty and timestamp rules (caller must hold lock)
+func (ns *NodeState) headerParents() []Block {
+	span := ns.DifficultyParams.Window
+	if ns.TimestampParams.MedianSpan > span {
+		span = ns.TimestampParams.MedianSpan
+	}
+	start := len(ns.Chain) - span - 1
+	if start < 0 {
+		start = 0
+	}
+	tail := ns.Chain[start:len(ns.Chain):len(ns.Chain)]
+	return append(tail, ns.Headers...)
+}
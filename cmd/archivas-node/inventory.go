@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/ArchivasNetwork/archivas/ledger"
+	"github.com/ArchivasNetwork/archivas/p2p"
+)
+
+// Inventory
+//
+// Peers announce blocks by hashBlock and transactions by ledger.TxHash, and
+// fetch the ones they lack (see p2p/inventory.go). Every transaction added
+// to the mempool, whether submitted over RPC or received from a peer, is
+// announced. Relayed transactions are checked against the current state the
+// way the RPC submit handlers do before they enter the mempool; relayed
+// blocks are imported like any other peer block.
+
+// HasObject reports whether a block is known or a transaction is pending
+func (ns *NodeState) HasObject(invType string, hash [32]byte) bool {
+	switch invType {
+	case p2p.InvBlock:
+		ns.RLock()
+		defer ns.RUnlock()
+		return ns.Tree.Get(hash) != nil || ns.Orphans.Has(hash)
+	case p2p.InvTx:
+		return ns.Mempool.Has(hash)
+	}
+	return false
+}
+
+// GetObject returns a known block or a pending transaction for a peer
+func (ns *NodeState) GetObject(invType string, hash [32]byte) (json.RawMessage, bool) {
+	var obj interface{}
+	switch invType {
+	case p2p.InvBlock:
+		block, ok := ns.blockByHash(hash)
+		if !ok {
+			return nil, false
+		}
+		obj = block
+	case p2p.InvTx:
+		tx, ok := ns.Mempool.Get(hash)
+		if !ok {
+			return nil, false
+		}
+		obj = tx
+	default:
+		return nil, false
+	}
+
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// blockByHash finds a block of the best chain or a stored side chain
+func (ns *NodeState) blockByHash(hash [32]byte) (*Block, bool) {
+	ns.RLock()
+	defer ns.RUnlock()
+
+	node := ns.Tree.Get(hash)
+	if node == nil {
+		return nil, false
+	}
+	if ns.Tree.OnBestChain(node) && node.Height < uint64(len(ns.Chain)) {
+		block := ns.Chain[node.Height]
+		return &block, true
+	}
+	if ns.BlockStore == nil {
+		return nil, false
+	}
+	var block Block
+	if err := ns.BlockStore.LoadBlockByHash(hash, &block); err != nil {
+		return nil, false
+	}
+	return &block, true
+}
+
+// AcceptObject validates a block or transaction relayed by a peer that
+// announced it under hash, and connects the block or adds the transaction
+// to the mempool
+func (ns *NodeState) AcceptObject(invType string, hash [32]byte, data json.RawMessage) error {
+	switch invType {
+	case p2p.InvBlock:
+		var block Block
+		if err := json.Unmarshal(data, &block); err != nil {
+			return invalidBlock(fmt.Errorf("failed to unmarshal block: %w", err))
+		}
+		if hashBlock(&block) != hash {
+			return invalidBlock(fmt.Errorf("block does not match hash %x", hash))
+		}
+		return ns.VerifyAndApplyBlock(data)
+	case p2p.InvTx:
+		return ns.acceptTx(hash, data)
+	}
+	return fmt.Errorf("unknown inventory type %q", invType)
+}
+
+// acceptTx validates a relayed transaction and adds it to the mempool.
+// Transactions that can never be valid are marked p2p.ErrInvalidTx; ones
+// that don't fit the current state aren't.
+func (ns *NodeState) acceptTx(hash [32]byte, txJSON json.RawMessage) error {
+	var tx ledger.Transaction
+	if err := json.Unmarshal(txJSON, &tx); err != nil {
+		return invalidTx(fmt.Errorf("undecodable transaction: %w", err))
+	}
+	if ledger.TxHash(tx) != hash {
+		return invalidTx(fmt.Errorf("transaction does not match hash %x", hash))
+	}
+	if err := ledger.VerifyTransaction(tx); err != nil {
+		return invalidTx(err)
+	}
+
+	ns.RLock()
+	sender := ns.WorldState.Accounts[tx.From]
+	var balance int64
+	var nonce uint64
+	if sender != nil {
+		balance, nonce = sender.Balance, sender.Nonce
+	}
+	ns.RUnlock()
+
+	if sender == nil {
+		return fmt.Errorf("sender %s does not exist", tx.From)
+	}
+	if balance < tx.Amount+tx.Fee {
+		return fmt.Errorf("insufficient balance: have %d, need %d", balance, tx.Amount+tx.Fee)
+	}
+	if tx.Nonce != nonce {
+		return fmt.Errorf("invalid nonce: expected %d, got %d", nonce, tx.Nonce)
+	}
+
+	ns.Mempool.Add(tx)
+	return nil
+}
+
+// invalidTx marks an error as p2p.ErrInvalidTx, which counts against the
+// peer that sent the transaction
+func invalidTx(err error) error {
+	return fmt.Errorf("%w: %w", p2p.ErrInvalidTx, err)
+}
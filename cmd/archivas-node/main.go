@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/binary"
 	"encoding/hex"
@@ -8,11 +9,15 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"math/big"
+	"net"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/ArchivasNetwork/archivas/chain"
 	"github.com/ArchivasNetwork/archivas/config"
 	"github.com/ArchivasNetwork/archivas/consensus"
 	"github.com/ArchivasNetwork/archivas/health"
@@ -28,6 +33,7 @@ import (
 	"github.com/ArchivasNetwork/archivas/rpc"
 	"github.com/ArchivasNetwork/archivas/snapshot"
 	"github.com/ArchivasNetwork/archivas/storage"
+	"github.com/ArchivasNetwork/archivas/vdf"
 )
 
 // Block represents a blockchain block with Proof-of-Space
@@ -40,9 +46,18 @@ type Block struct {
 	Txs           []ledger.Transaction
 	Proof         *pospace.Proof // Proof-of-Space
 	FarmerAddr    string         // Address to receive block reward
+	FarmerSig     []byte         // Plot farmer key's signature binding FarmerAddr to the proof
+	TxRoot        [32]byte       // Root of Txs (zero before the roots activation)
+	StateRoot     [32]byte       // Root of the state after the block (zero before the roots activation)
+
+	// VDF outputs whose challenges the proof could answer, so peers can
+	// rebuild the challenge window, and checkpoints of the VDF run up to
+	// the last one for verifying it in parallel
+	ChallengeVDF   []consensus.VDFPoint
+	VDFCheckpoints [][]byte
 
 	// v0.5.0: Cumulative work for fork resolution
-	CumulativeWork uint64 // Total work from genesis to this block
+	CumulativeWork *big.Int // Total work from genesis to this block (expected proof trials)
 }
 
 // stringSliceFlag is a custom flag type for repeatable string flags
@@ -57,6 +72,9 @@ func (s *stringSliceFlag) Set(value string) error {
 	return nil
 }
 
+// maxBlockTemplates bounds the unsigned blocks kept for the current tip
+const maxBlockTemplates = 64
+
 // NodeState holds the entire node state
 type NodeState struct {
 	sync.RWMutex
@@ -66,6 +84,19 @@ type NodeState struct {
 	Consensus        *consensus.Consensus
 	CurrentHeight    uint64
 	CurrentChallenge [32]byte
+	// Challenges a proof for the next block may answer
+	Challenges *consensus.ChallengeWindow
+	// Difficulty rule parameters (from genesis)
+	DifficultyParams consensus.DifficultyParams
+	// Block timestamp rules (median time past, future drift)
+	TimestampParams consensus.TimestampParams
+	// Challenge window rule
+	ChallengeParams consensus.ChallengeParams
+	// Activation heights of later consensus rules (from genesis)
+	Upgrades consensus.Upgrades
+	// IBD skips transfer signature checks up to this block (height 0: never)
+	AssumeValidHeight uint64
+	AssumeValidHash   [32]byte
 	// Persistence
 	DB         *storage.DB
 	BlockStore *storage.BlockStorage
@@ -79,11 +110,24 @@ type NodeState struct {
 	Health *health.ChainHealth
 	// Reorg detection (v0.5.0)
 	ReorgDetector *consensus.ReorgDetector
+	// Validated headers above the tip, waiting for their bodies
+	Headers []Block
+	// Undo data of the last MaxReorgDepth blocks, by height
+	UndoLog map[uint64]*ledger.BlockUndo
+	// Every known block by hash, with the best-chain pointer
+	Tree *consensus.BlockTree
+	// Peer blocks waiting for their parent
+	Orphans *consensus.OrphanPool
 	// VDF state (updated by timelord)
-	VDFSeed       []byte
-	VDFIterations uint64
-	VDFOutput     []byte
-	HasVDF        bool
+	VDFSeed        []byte
+	VDFIterations  uint64
+	VDFOutput      []byte
+	VDFCheckpoints [][]byte // Checkpoints of the last update, recorded in blocks
+	HasVDF         bool
+	VDFStarted     time.Time // When the tip the VDF runs from was adopted
+	VerifiedVDF    [32]byte  // Run of the peer block being imported, verified before locking
+	// Unsigned blocks handed to farmers for the current tip, by hash
+	Templates map[[32]byte]*blockTemplate
 	// Backpressure for disk persistence (limit concurrent writes)
 	persistSem chan struct{}
 }
@@ -133,6 +177,11 @@ func main() {
 	genesisPath := flag.String("genesis", "", "Genesis file path (overrides network profile)")
 	networkID := flag.String("network-id", "", "Network ID (overrides network profile)")
 	bootnodes := flag.String("bootnodes", "", "Comma-separated bootnode addresses")
+	nodeName := flag.String("node-name", "", "Node name advertised to peers in the P2P handshake")
+	nodeKeyPath := flag.String("node-key", "", "Path to the P2P identity key, created if missing (default: <db>/node_key)")
+	timelordToken := flag.String("timelord-token", "", "Bearer token the timelord must send with VDF updates (updates are refused without one)")
+	adminToken := flag.String("admin-token", "", "Bearer token required on /admin RPC routes (they are refused without one)")
+	maxFutureDrift := flag.Int64("max-future-drift", consensus.DefaultMaxFutureDrift, "Max seconds a block timestamp may be ahead of local time")
 
 	// Gossip flags
 	enableGossip := flag.Bool("enable-gossip", true, "Enable automatic peer discovery via gossip")
@@ -140,6 +189,8 @@ func main() {
 	maxPeers := flag.Int("max-peers", 20, "Maximum number of peer connections")
 	dialsPerMin := flag.Int("gossip-dials-per-min", 5, "Maximum new peer dials per minute")
 	peersFile := flag.String("peers-file", "", "Path to peers.json (default: <db>/peers.json)")
+	peerBanThreshold := flag.Int("peer-ban-threshold", p2p.DefaultBanThreshold, "Ban peers whose misbehavior score falls to this value")
+	banDuration := flag.Duration("ban-duration", p2p.DefaultBanDuration, "How long misbehaving peers stay banned")
 
 	// P2P Isolation flags (v1.2.0)
 	noPeerDiscovery := flag.Bool("no-peer-discovery", false, "Disable automatic peer discovery (only dial whitelisted peers)")
@@ -147,6 +198,8 @@ func main() {
 	flag.Var(&peerWhitelist, "peer-whitelist", "Whitelisted peer address (repeatable, format: host:port or IP:port)")
 	checkpointHeight := flag.Uint64("checkpoint-height", 0, "Chain checkpoint height for validation")
 	checkpointHash := flag.String("checkpoint-hash", "", "Chain checkpoint hash (hex, 64 chars)")
+	assumeValidHeight := flag.Uint64("assume-valid-height", 0, "Skip transfer signature checks during IBD up to this height, from the block roots activation on (0 disables)")
+	assumeValidHash := flag.String("assume-valid-hash", "", "Hash of the block at -assume-valid-height (hex, 64 chars)")
 
 	flag.Parse()
 
@@ -236,6 +289,8 @@ func main() {
 	// Try to load existing state from disk
 	var worldState *ledger.WorldState
 	var cs *consensus.Consensus
+	var diffParams consensus.DifficultyParams
+	var upgrades consensus.Upgrades
 	var chain []Block
 	var currentHeight uint64
 	var genesisChallenge [32]byte
@@ -268,7 +323,12 @@ func main() {
 			fmt.Printf("   %s: %.8f %s\n", alloc.Address, float64(alloc.Amount)/100000000.0, config.DenomSymbol)
 		}
 
-		cs = consensus.NewConsensus()
+		diffParams = consensus.GenesisDifficultyParams(gen)
+		if err := diffParams.Validate(); err != nil {
+			log.Fatalf("Invalid genesis difficulty params: %v", err)
+		}
+		cs = &consensus.Consensus{DifficultyTarget: diffParams.InitialDifficulty}
+		upgrades = consensus.GenesisUpgrades(gen)
 
 		genesisChallenge = consensus.GenerateGenesisChallenge()
 		genesisBlock := Block{
@@ -286,7 +346,7 @@ func main() {
 		currentHeight = 0
 
 		// Persist genesis
-		if err := blockStore.SaveBlock(0, genesisBlock); err != nil {
+		if err := blockStore.SaveBestBlock(hashBlock(&genesisBlock), blockIndexEntry(&genesisBlock), genesisBlock); err != nil {
 			log.Fatalf("Failed to save genesis block: %v", err)
 		}
 		for addr, balance := range genesisAllocs {
@@ -300,6 +360,12 @@ func main() {
 		if err := metaStore.SaveDifficulty(cs.DifficultyTarget); err != nil {
 			log.Fatalf("Failed to save difficulty: %v", err)
 		}
+		if err := metaStore.SaveDifficultyParams(diffParams); err != nil {
+			log.Fatalf("Failed to save difficulty params: %v", err)
+		}
+		if err := metaStore.SaveUpgrades(upgrades); err != nil {
+			log.Fatalf("Failed to save upgrade heights: %v", err)
+		}
 		if err := metaStore.SaveGenesisHash(genesisHash); err != nil {
 			log.Fatalf("Failed to save genesis hash: %v", err)
 		}
@@ -313,13 +379,6 @@ func main() {
 		log.Printf("[DEBUG] Loading existing state from tip height %d...", tipHeight)
 		fmt.Printf("💾 Restoring from disk (tip height: %d)\n", tipHeight)
 
-		// Load difficulty
-		difficulty, err := metaStore.LoadDifficulty()
-		if err != nil {
-			log.Fatalf("Failed to load difficulty: %v", err)
-		}
-		cs = &consensus.Consensus{DifficultyTarget: difficulty}
-
 		// Load blocks
 		chain = make([]Block, 0, tipHeight+1)
 		for h := uint64(0); h <= tipHeight; h++ {
@@ -327,6 +386,12 @@ func main() {
 			if err := blockStore.LoadBlock(h, &blk); err != nil {
 				log.Fatalf("Failed to load block %d: %v", h, err)
 			}
+			// Recompute work locally (older databases stored the difficulty sum)
+			var parentWork *big.Int
+			if len(chain) > 0 {
+				parentWork = chain[len(chain)-1].CumulativeWork
+			}
+			blk.CumulativeWork = consensus.AddWork(parentWork, blk.Difficulty)
 			chain = append(chain, blk)
 		}
 
@@ -342,6 +407,33 @@ func main() {
 		}
 		genesisHash = savedGenesisHash
 
+		// Rule parameters come from the genesis file when it is available,
+		// and otherwise from those saved at the last start. The genesis hash
+		// covers activation heights, so both give the chain's own schedule.
+		if gen, err := loadGenesis(*genesisPath, genesisHash); err == nil {
+			diffParams = consensus.GenesisDifficultyParams(gen)
+			upgrades = consensus.GenesisUpgrades(gen)
+			if err := metaStore.SaveDifficultyParams(diffParams); err != nil {
+				log.Fatalf("Failed to save difficulty params: %v", err)
+			}
+			if err := metaStore.SaveUpgrades(upgrades); err != nil {
+				log.Fatalf("Failed to save upgrade heights: %v", err)
+			}
+		} else {
+			log.Printf("[genesis] Using saved rule parameters: %v", err)
+			if err := metaStore.LoadDifficultyParams(&diffParams); err != nil {
+				log.Fatalf("Failed to load difficulty params: %v", err)
+			}
+			// Rules added since the heights were saved stay unscheduled
+			upgrades = consensus.GenesisUpgrades(&config.GenesisDoc{})
+			if err := metaStore.LoadUpgrades(&upgrades); err != nil {
+				log.Fatalf("Failed to load upgrade heights: %v", err)
+			}
+		}
+		if err := diffParams.Validate(); err != nil {
+			log.Fatalf("Invalid difficulty params: %v", err)
+		}
+
 		savedNetworkID, err := metaStore.LoadNetworkID()
 		if err != nil {
 			log.Printf("[warning] Network ID not found in DB, using default")
@@ -397,10 +489,10 @@ func main() {
 
 		currentHeight = tipHeight
 
-		// Recompute challenge from tip
-		tipBlock := chain[len(chain)-1]
-		tipHash := hashBlock(&tipBlock)
-		genesisChallenge = consensus.GenerateChallenge(tipHash, currentHeight+1)
+		// Difficulty of the next block follows from the chain
+		cs = &consensus.Consensus{
+			DifficultyTarget: consensus.NextDifficulty(difficultyHeaders(chain, diffParams.Window), diffParams),
+		}
 
 		fmt.Printf("✅ Restored %d blocks from disk\n", len(chain))
 		fmt.Printf("📊 Loaded %d accounts\n", len(worldState.Accounts))
@@ -415,25 +507,64 @@ func main() {
 	fmt.Println("📋 Mempool initialized")
 	fmt.Println()
 
+	// Timestamp and challenge rules activate at their own genesis heights
+	tsParams := consensus.DefaultTimestampParams()
+	tsParams.MaxFutureDrift = *maxFutureDrift
+	tsParams.ActivationHeight = upgrades.Timestamps
+	chParams := consensus.DefaultChallengeParams()
+	chParams.ActivationHeight = upgrades.Challenges
+
+	// The assume-valid block must be named by hash, not just height
+	avHash, err := decodeHash32(*assumeValidHash)
+	if err != nil {
+		log.Fatalf("Invalid assume-valid hash: %v", err)
+	}
+	if (*assumeValidHeight > 0) != (*assumeValidHash != "") {
+		log.Fatalf("-assume-valid-height and -assume-valid-hash must be set together")
+	}
+	// Its hash only vouches for transfers once blocks commit to a tx root
+	if *assumeValidHeight > 0 && upgrades.BlockRoots == consensus.NotScheduled {
+		log.Fatalf("-assume-valid-height can't be used on this chain: its genesis doesn't schedule block roots, so no block hash commits to transfers")
+	}
+	if *assumeValidHeight > 0 && *assumeValidHeight < upgrades.BlockRoots {
+		log.Fatalf("-assume-valid-height must be at or above the block roots activation height %d; block hashes below it don't commit to transfers", upgrades.BlockRoots)
+	}
+
 	// Initialize node state
 	log.Println("[DEBUG] Initializing node state...")
 	nodeState := &NodeState{
-		Chain:            chain,
-		WorldState:       worldState,
-		Mempool:          mp,
-		Consensus:        cs,
-		CurrentHeight:    currentHeight,
-		CurrentChallenge: genesisChallenge,
-		DB:               db,
-		BlockStore:       blockStore,
-		StateStore:       stateStore,
-		MetaStore:        metaStore,
-		Health:           health.NewChainHealth(),
-		ReorgDetector:    consensus.NewReorgDetector(),
-		GenesisHash:      genesisHash,
-		NetworkID:        *networkID,
-		persistSem:       make(chan struct{}, 5), // Limit to 5 concurrent disk writes
-	}
+		Chain:             chain,
+		WorldState:        worldState,
+		Mempool:           mp,
+		Consensus:         cs,
+		CurrentHeight:     currentHeight,
+		DifficultyParams:  diffParams,
+		TimestampParams:   tsParams,
+		ChallengeParams:   chParams,
+		Upgrades:          upgrades,
+		AssumeValidHeight: *assumeValidHeight,
+		AssumeValidHash:   avHash,
+		DB:                db,
+		BlockStore:        blockStore,
+		StateStore:        stateStore,
+		MetaStore:         metaStore,
+		Health:            health.NewChainHealth(),
+		ReorgDetector:     consensus.NewReorgDetector(),
+		UndoLog:           make(map[uint64]*ledger.BlockUndo),
+		Orphans:           consensus.NewOrphanPool(maxOrphanBlocks, orphanTTL),
+		GenesisHash:       genesisHash,
+		NetworkID:         *networkID,
+		persistSem:        make(chan struct{}, 5), // Limit to 5 concurrent disk writes
+	}
+
+	// Index the best chain and recent side chains by hash
+	nodeState.Tree = buildBlockTree(chain, blockStore, uint64(nodeState.ReorgDetector.MaxReorgDepth))
+
+	// Undo data lets recent blocks be rolled back after a restart
+	nodeState.loadUndoLog()
+
+	// Proofs for the next block answer challenges derived from the tip
+	nodeState.resetChallenge()
 
 	metrics.StartWatchdogs(metrics.GroupNode)
 	metrics.UpdateTipHeight(nodeState.CurrentHeight)
@@ -441,7 +572,7 @@ func main() {
 	metrics.UpdatePeerCount(0)
 
 	log.Println("[DEBUG] Initialized chain memory")
-	fmt.Printf("🔍 Current challenge: %x\n", genesisChallenge[:8])
+	fmt.Printf("🔍 Current challenge: %x\n", nodeState.CurrentChallenge[:8])
 	fmt.Println()
 
 	// Start P2P network if enabled
@@ -450,6 +581,28 @@ func main() {
 		log.Printf("[p2p] Starting P2P listener on %s", *p2pAddr)
 		p2pNet = p2p.NewNetwork(*p2pAddr, nodeState)
 
+		// Connections are encrypted and authenticated with our identity key
+		if *nodeKeyPath == "" {
+			*nodeKeyPath = *dbPath + "/node_key"
+		}
+		nodeKey, err := p2p.LoadOrCreateNodeKey(*nodeKeyPath)
+		if err != nil {
+			log.Fatalf("[p2p] Failed to load node key: %v", err)
+		}
+
+		// Peers must match our network profile and genesis in the handshake
+		_, rpcPortStr, _ := net.SplitHostPort(rpcBindAddr)
+		rpcPort, _ := strconv.Atoi(rpcPortStr)
+		p2pNet.SetHandshakeConfig(p2p.HandshakeConfig{
+			Profile:     profile,
+			GenesisHash: nodeState.GenesisHash,
+			NodeVersion: buildInfo["version"],
+			NodeName:    *nodeName,
+			RPCPort:     rpcPort,
+			NodeKey:     nodeKey,
+		})
+		log.Printf("[p2p] Node ID: %s", p2pNet.NodeID())
+
 		// Configure gossip
 		p2pNet.SetGossipConfig(p2p.GossipConfig{
 			NetworkID:      *networkID,
@@ -459,6 +612,18 @@ func main() {
 			DialsPerMinute: *dialsPerMin,
 		})
 
+		// Misbehaving peers are banned (persisted in the peer store)
+		if *peerBanThreshold >= -p2p.PenaltyInvalidBlock {
+			log.Fatalf("[p2p] -peer-ban-threshold must be below %d, so one invalid block doesn't ban a peer", -p2p.PenaltyInvalidBlock)
+		}
+		p2pNet.SetBanConfig(p2p.BanConfig{
+			Threshold: *peerBanThreshold,
+			Duration:  *banDuration,
+		})
+
+		// Transactions entering the mempool are relayed to peers
+		mp.OnAdd(func(hash [32]byte) { go p2pNet.Announce(p2p.InvTx, hash) })
+
 		// Configure peer isolation (v1.2.0)
 		if *noPeerDiscovery || len(peerWhitelist) > 0 || *checkpointHeight > 0 {
 			// Parse checkpoint hash if provided
@@ -631,6 +796,21 @@ func main() {
 						}
 					}
 
+					// A peer on a competing branch with more work triggers a reorg;
+					// plain IBD would append its blocks on top of our fork
+					if bestPeerURL != "" && bestRemoteHeight >= localHeight {
+						info, err := ibdManager.SyncFork(bestPeerURL, uint64(nodeState.ReorgDetector.MaxReorgDepth))
+						if err != nil {
+							log.Printf("[SYNC] Fork check against %s failed: %v", bestPeerURL, err)
+							continue
+						}
+						if info != nil {
+							log.Printf("[SYNC] Reorganized to %s: fork=%d removed=%d added=%d",
+								bestPeerURL, info.ForkHeight, info.BlocksRemoved, info.BlocksAdded)
+							continue
+						}
+					}
+
 					// If any peer has a significantly longer chain, trigger IBD
 					if bestRemoteHeight > localHeight && ibdManager.ShouldRunIBD(localHeight, bestRemoteHeight) {
 						log.Printf("[SYNC] Detected longer chain: local=%d remote=%d (gap=%d), triggering reorg from %s",
@@ -639,7 +819,7 @@ func main() {
 						if err := ibdManager.RunIBD(bestPeerURL); err != nil {
 							log.Printf("[SYNC] Failed to sync from %s: %v", bestPeerURL, err)
 						} else {
-							log.Printf("[SYNC] Successfully reorganized to height %d", bestRemoteHeight)
+							log.Printf("[SYNC] Successfully synced to height %d", bestRemoteHeight)
 						}
 					}
 				}
@@ -651,6 +831,8 @@ func main() {
 	// Start RPC server in background
 	log.Println("[DEBUG] Starting RPC server...")
 	server := rpc.NewFarmingServer(nodeState.WorldState, nodeState.Mempool, nodeState)
+	server.SetTimelordToken(*timelordToken)
+	server.SetAdminToken(*adminToken)
 	go func() {
 		log.Printf("[rpc] starting server on %s", rpcBindAddr)
 		fmt.Printf("🌐 Starting RPC server on %s\n", rpcBindAddr)
@@ -691,42 +873,23 @@ func main() {
 	ticker := time.NewTicker(5 * time.Second)
 	defer ticker.Stop()
 
-	lastBlockTime := time.Now()
-
 	for range ticker.C {
-		nodeState.Lock()
+		nodeState.RLock()
 		height := nodeState.CurrentHeight
 		difficulty := nodeState.Consensus.DifficultyTarget
 		challenge := nodeState.CurrentChallenge
 		chainLen := len(nodeState.Chain)
-
-		// Check if we got a new block
-		if chainLen > int(height)+1 {
-			lastBlockTime = time.Now()
-		}
-
-		// Time-based difficulty drop: if no block for 60 seconds, halve difficulty
-		timeSinceBlock := time.Since(lastBlockTime)
-		if timeSinceBlock > 60*time.Second && difficulty > 1_000_000 {
-			oldDiff := difficulty
-			difficulty = difficulty / 2
-			if difficulty < 1_000_000 {
-				difficulty = 1_000_000
-			}
-			nodeState.Consensus.DifficultyTarget = difficulty
-			lastBlockTime = time.Now() // Reset timer
-			log.Printf("[auto-drop] No block for %v, dropping difficulty: %d → %d", timeSinceBlock, oldDiff, difficulty)
-		}
-
-		nodeState.Unlock()
+		nodeState.RUnlock()
 
 		log.Printf("[consensus] height=%d difficulty=%d challenge=%x chainLen=%d",
 			height, difficulty, challenge[:8], chainLen)
 	}
 }
 
-// AcceptBlock is called by RPC when a farmer submits a block
-func (ns *NodeState) AcceptBlock(proof *pospace.Proof, farmerAddr string, farmerPubKey []byte) error {
+// AcceptBlock is called by RPC when a farmer submits a block. From the roots
+// activation the farmer signs the block hash instead, so blocks are built
+// with BlockTemplate and submitted with SubmitSignedBlock.
+func (ns *NodeState) AcceptBlock(proof *pospace.Proof, farmerAddr string, farmerSig []byte) error {
 	// Track submission
 	metrics.IncSubmitReceived()
 
@@ -734,57 +897,154 @@ func (ns *NodeState) AcceptBlock(proof *pospace.Proof, farmerAddr string, farmer
 
 	// Get expected height
 	nextHeight := ns.CurrentHeight + 1
+	if nextHeight >= ns.Upgrades.BlockRoots {
+		metrics.IncSubmitIgnored()
+		ns.Unlock()
+		return fmt.Errorf("block %d must be built from a template whose hash the farmer signs", nextHeight)
+	}
 
-	// Verify proof against its embedded challenge
-	// Note: proof.Challenge is set by the farmer based on when it found the winner
-	// We accept this because VDF advances quickly and farmer might have found it
-	// for a slightly older challenge
-	if err := ns.Consensus.VerifyProofOfSpace(proof, proof.Challenge); err != nil {
+	if err := ns.checkSubmittedProof(proof, nextHeight); err != nil {
 		metrics.IncSubmitIgnored()
 		ns.Unlock()
-		return fmt.Errorf("invalid proof: %w", err)
+		return err
 	}
 
-	// Proof accepted
-	metrics.IncSubmitAccepted()
+	// Only the plot's owner may choose where the reward goes
+	if nextHeight >= ns.Upgrades.FarmerSigs {
+		if err := consensus.VerifyFarmerSignature(nextHeight, proof, farmerAddr, farmerSig); err != nil {
+			metrics.IncSubmitIgnored()
+			ns.Unlock()
+			return fmt.Errorf("invalid block signature: %w", err)
+		}
+	}
 
-	// Get pending transactions
-	pending := ns.Mempool.Pending()
-	log.Printf("[block] Creating block %d with %d pending transactions from mempool", nextHeight, len(pending))
+	tmpl, err := ns.buildBlock(proof, farmerAddr)
+	if err != nil {
+		metrics.IncSubmitIgnored()
+		ns.Unlock()
+		return err
+	}
+	tmpl.block.FarmerSig = farmerSig
+	return ns.commitBlock(tmpl)
+}
+
+// BlockTemplate builds the block a farmer's proof wins and returns its height
+// and the block hash the farmer signs to submit it with SubmitSignedBlock.
+// Below the roots activation no hash is returned: the farmer signs its
+// farmer header and submits the proof with AcceptBlock.
+func (ns *NodeState) BlockTemplate(proof *pospace.Proof, farmerAddr string) (uint64, []byte, error) {
+	ns.Lock()
+	defer ns.Unlock()
 
-	// Create coinbase transaction (block reward to farmer)
-	coinbase := ledger.Transaction{
-		From:         "coinbase",
-		To:           farmerAddr,
-		Amount:       config.InitialBlockReward,
-		Fee:          0,
-		Nonce:        0,
-		SenderPubKey: nil, // Coinbase has no sender
-		Signature:    nil, // Coinbase has no signature
+	nextHeight := ns.CurrentHeight + 1
+	if nextHeight < ns.Upgrades.BlockRoots {
+		return nextHeight, nil, nil
+	}
+	if err := ns.checkSubmittedProof(proof, nextHeight); err != nil {
+		return 0, nil, err
+	}
+	if len(ns.Templates) >= maxBlockTemplates {
+		return 0, nil, fmt.Errorf("too many block templates for height %d", nextHeight)
 	}
 
-	// Build transaction list (coinbase first, then user txs)
-	allTxs := []ledger.Transaction{coinbase}
+	tmpl, err := ns.buildBlock(proof, farmerAddr)
+	if err != nil {
+		return 0, nil, err
+	}
+	hash := hashBlock(&tmpl.block)
+	if ns.Templates == nil {
+		ns.Templates = make(map[[32]byte]*blockTemplate)
+	}
+	ns.Templates[hash] = tmpl
+	return nextHeight, hash[:], nil
+}
+
+// SubmitSignedBlock adds the block built by BlockTemplate with the given hash,
+// signed by the farmer key of its proof
+func (ns *NodeState) SubmitSignedBlock(hash [32]byte, farmerSig []byte) error {
+	// Track submission
+	metrics.IncSubmitReceived()
+
+	ns.Lock()
 
-	// Apply coinbase (special handling - no signature verification)
-	receiver, ok := ns.WorldState.Accounts[farmerAddr]
-	if !ok {
-		receiver = &ledger.AccountState{Balance: 0, Nonce: 0}
-		ns.WorldState.Accounts[farmerAddr] = receiver
+	// Templates are dropped whenever the tip changes
+	tmpl := ns.Templates[hash]
+	if tmpl == nil {
+		metrics.IncSubmitIgnored()
+		ns.Unlock()
+		return fmt.Errorf("unknown block template %x", hash[:8])
 	}
-	receiver.Balance += config.InitialBlockReward
 
-	// Apply user transactions
-	validTxs := []ledger.Transaction{}
-	for _, tx := range pending {
-		err := ns.WorldState.ApplyTransaction(tx)
-		if err != nil {
-			fmt.Printf("⚠️  Skipping invalid tx: %v\n", err)
-		} else {
-			validTxs = append(validTxs, tx)
+	// Only the plot's owner may sign the block
+	if tmpl.block.Height >= ns.Upgrades.FarmerSigs {
+		if err := consensus.VerifyBlockSignature(hash, tmpl.block.Proof, farmerSig); err != nil {
+			metrics.IncSubmitIgnored()
+			ns.Unlock()
+			return fmt.Errorf("invalid block signature: %w", err)
 		}
 	}
 
+	delete(ns.Templates, hash)
+	tmpl.block.FarmerSig = farmerSig
+	return ns.commitBlock(tmpl)
+}
+
+// checkSubmittedProof verifies a farmer's proof for the block at nextHeight
+// (caller must hold lock)
+func (ns *NodeState) checkSubmittedProof(proof *pospace.Proof, nextHeight uint64) error {
+	if proof == nil {
+		return fmt.Errorf("invalid proof: %w", consensus.ErrMissingProof)
+	}
+
+	// The farmer may answer a slightly older challenge, since the VDF advances
+	// quickly, but only one the node handed out for this height
+	if nextHeight >= ns.ChallengeParams.ActivationHeight && !ns.Challenges.Contains(proof.Challenge) {
+		return fmt.Errorf("invalid proof: challenge %x is not a current challenge", proof.Challenge[:8])
+	}
+
+	// Verify proof against the challenge it answers
+	if err := ns.Consensus.VerifyProofOfSpace(proof, proof.Challenge); err != nil {
+		return fmt.Errorf("invalid proof: %w", err)
+	}
+
+	// Enforce the plot format required at this height
+	if err := consensus.CheckPlotVersion(proof, nextHeight, ns.Upgrades); err != nil {
+		return fmt.Errorf("invalid proof: %w", err)
+	}
+	return nil
+}
+
+// blockTemplate is a block built on the tip for a farmer, with what adding
+// it needs
+type blockTemplate struct {
+	block    Block
+	state    *chain.Overlay           // State after the block
+	payouts  []consensus.RewardPayout // Block reward recipients
+	validTxs []ledger.Transaction     // Mempool transactions included
+}
+
+// buildBlock builds the block extending the tip with a verified proof,
+// paying the reward to farmerAddr. The block is left unsigned.
+// (caller must hold lock)
+func (ns *NodeState) buildBlock(proof *pospace.Proof, farmerAddr string) (*blockTemplate, error) {
+	nextHeight := ns.CurrentHeight + 1
+
+	// Split the block reward between farmer and pool
+	payouts, err := consensus.BlockRewardPayouts(config.InitialBlockReward, farmerAddr, proof)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proof: %w", err)
+	}
+
+	// Get pending transactions
+	pending := ns.Mempool.Pending()
+	log.Printf("[block] Creating block %d with %d pending transactions from mempool", nextHeight, len(pending))
+
+	// Build transaction list (coinbase first, then the user txs that apply)
+	allTxs := coinbaseTxs(payouts)
+	validTxs, skipped := chain.SelectTransactions(ns.WorldState, allTxs, pending)
+	for _, err := range skipped {
+		fmt.Printf("⚠️  Skipping invalid tx: %v\n", err)
+	}
 	allTxs = append(allTxs, validTxs...)
 
 	// Calculate prev hash
@@ -796,44 +1056,70 @@ func (ns *NodeState) AcceptBlock(proof *pospace.Proof, farmerAddr string, farmer
 
 	// Create new block with current difficulty
 	newBlock := Block{
-		Height:        nextHeight,
-		TimestampUnix: time.Now().Unix(),
-		PrevHash:      prevHash,
-		Difficulty:    ns.Consensus.DifficultyTarget, // Difficulty when mined
-		Challenge:     ns.CurrentChallenge,           // Challenge used to win
-		Txs:           allTxs,
-		Proof:         proof,
-		FarmerAddr:    farmerAddr,
+		Height:         nextHeight,
+		TimestampUnix:  ns.nextTimestamp(),
+		PrevHash:       prevHash,
+		Difficulty:     ns.Consensus.DifficultyTarget, // Difficulty when mined
+		Challenge:      proof.Challenge,               // Challenge used to win
+		Txs:            allTxs,
+		Proof:          proof,
+		FarmerAddr:     farmerAddr,
+		ChallengeVDF:   append([]consensus.VDFPoint(nil), ns.Challenges.Points...),
+		CumulativeWork: ns.tipWorkPlus(ns.Consensus.DifficultyTarget),
+	}
+	if len(newBlock.ChallengeVDF) > 0 {
+		newBlock.VDFCheckpoints = ns.VDFCheckpoints
+	}
+
+	// Apply it the way peers will when importing it
+	newState, err := ns.applyBlock(ns.WorldState, &newBlock, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply block %d: %w", nextHeight, err)
+	}
+	if nextHeight >= ns.Upgrades.BlockRoots {
+		newBlock.TxRoot, newBlock.StateRoot = blockRoots(&ns.Chain[len(ns.Chain)-1], &newBlock, newState)
 	}
+	return &blockTemplate{block: newBlock, state: newState, payouts: payouts, validTxs: validTxs}, nil
+}
+
+// commitBlock adds a signed block built by buildBlock to the chain, then
+// persists and announces it. It releases the lock the caller holds.
+func (ns *NodeState) commitBlock(tmpl *blockTemplate) error {
+	newBlock, newState, payouts, validTxs := tmpl.block, tmpl.state, tmpl.payouts, tmpl.validTxs
+	nextHeight, farmerAddr := newBlock.Height, newBlock.FarmerAddr
+
+	// Proof and signature accepted
+	metrics.IncSubmitAccepted()
+
+	// Record the accounts this block touches so it can be rolled back
+	undo := ns.WorldState.CaptureUndo(txAccounts(newBlock.Txs))
+	newState.Commit()
 
 	// Add to chain
 	ns.Chain = append(ns.Chain, newBlock)
 	ns.CurrentHeight = nextHeight
+	ns.recordUndo(nextHeight, undo)
+	ns.advanceTree()
 
 	// Clear mempool
 	ns.Mempool.Clear()
 
 	// Generate new challenge for next block
 	newBlockHash := hashBlock(&newBlock)
-	ns.CurrentChallenge = consensus.GenerateChallenge(newBlockHash, nextHeight+1)
+	ns.resetChallenge()
 
-	// TEMPORARY: Aggressive difficulty drop to get blocks flowing
-	// Drop difficulty by 50% every block until it reaches 1M
-	if ns.Consensus.DifficultyTarget > 1_000_000 {
-		oldDiff := ns.Consensus.DifficultyTarget
-		ns.Consensus.DifficultyTarget = ns.Consensus.DifficultyTarget / 2
-		if ns.Consensus.DifficultyTarget < 1_000_000 {
-			ns.Consensus.DifficultyTarget = 1_000_000
-		}
-		log.Printf("[difficulty] Dropping difficulty: %d → %d", oldDiff, ns.Consensus.DifficultyTarget)
-	}
+	// Retarget difficulty for the next block
+	ns.updateDifficulty()
 
 	// Copy data needed for persistence before releasing lock
 	// Track modified accounts (coinbase receiver + all transaction participants)
 	modifiedAccounts := make(map[string]*ledger.AccountState)
-	modifiedAccounts[farmerAddr] = &ledger.AccountState{
-		Balance: receiver.Balance,
-		Nonce:   receiver.Nonce,
+	for _, payout := range payouts {
+		receiver := ns.WorldState.Accounts[payout.Address]
+		modifiedAccounts[payout.Address] = &ledger.AccountState{
+			Balance: receiver.Balance,
+			Nonce:   receiver.Nonce,
+		}
 	}
 	for _, tx := range validTxs {
 		if sender, ok := ns.WorldState.Accounts[tx.From]; ok {
@@ -863,10 +1149,13 @@ func (ns *NodeState) AcceptBlock(proof *pospace.Proof, farmerAddr string, farmer
 	log.Println("[storage] Persisting block and state...")
 
 	// Save block
-	if err := ns.BlockStore.SaveBlock(nextHeight, newBlock); err != nil {
+	if err := ns.BlockStore.SaveBestBlock(newBlockHash, blockIndexEntry(&newBlock), newBlock); err != nil {
 		log.Printf("⚠️  Failed to persist block: %v", err)
 			return // Early exit on block save failure
 	}
+		if err := ns.BlockStore.SaveUndo(newBlockHash, undo); err != nil {
+			log.Printf("⚠️  Failed to persist undo data: %v", err)
+		}
 
 		// Save only modified accounts (not all accounts - much faster!)
 		for addr, acct := range modifiedAccounts {
@@ -886,8 +1175,8 @@ func (ns *NodeState) AcceptBlock(proof *pospace.Proof, farmerAddr string, farmer
 		log.Println("[storage] ✅ State persisted to disk")
 	}()
 
-	fmt.Printf("✅ Accepted block %d from farmer %s (reward: %.8f %s, txs: %d)\n",
-		nextHeight, farmerAddr, float64(config.InitialBlockReward)/100000000.0, config.DenomSymbol, len(validTxs))
+	fmt.Printf("✅ Accepted block %d from farmer %s (reward: %.8f %s, payouts: %d, txs: %d)\n",
+		nextHeight, farmerAddr, float64(config.InitialBlockReward)/100000000.0, config.DenomSymbol, len(payouts), len(validTxs))
 	fmt.Printf("🔍 New challenge for height %d: %x\n", nextHeight+1, ns.CurrentChallenge[:8])
 	fmt.Printf("⚙️  Difficulty adjusted to: %d\n", currentDifficulty)
 
@@ -911,12 +1200,12 @@ func (ns *NodeState) OnNewBlock(height uint64, hash [32]byte, fromPeer string) {
 	if height > currentHeight {
 		gap := height - currentHeight
 
-		// v1.1.1: Use batched IBD for large gaps (>10 blocks)
+		// Large gaps (>10 blocks) are synced headers-first from all peers
 		if gap > 10 {
-			log.Printf("[p2p] We're behind by %d blocks (our=%d, peer=%d), starting IBD",
+			log.Printf("[p2p] We're behind by %d blocks (our=%d, peer=%d), starting headers-first sync",
 				gap, currentHeight, height)
 			if ns.P2P != nil {
-				ns.P2P.StartIBD(currentHeight + 1)
+				ns.P2P.StartHeadersSync()
 			}
 		} else {
 			// Small gap, use single block requests
@@ -1043,21 +1332,73 @@ func (ns *NodeState) GetCurrentVDF() (seed []byte, iterations uint64, output []b
 	return ns.VDFSeed, ns.VDFIterations, ns.VDFOutput, ns.HasVDF
 }
 
-// UpdateVDFState updates the VDF state from timelord
-func (ns *NodeState) UpdateVDFState(seed []byte, iterations uint64, output []byte) {
+// UpdateVDFState verifies and updates the VDF state from timelord
+func (ns *NodeState) UpdateVDFState(seed []byte, iterations uint64, output []byte, checkpoints [][]byte) error {
+	// Cheap checks against the last accepted state come before verifying
+	if err := ns.checkVDFUpdate(seed, iterations, checkpoints); err != nil {
+		return err
+	}
+
+	// Verify without the lock; checkpoint segments are checked in parallel
+	if !vdf.VerifyWithCheckpoints(seed, iterations, checkpoints, output) {
+		return fmt.Errorf("VDF verification failed")
+	}
+
 	ns.Lock()
 	defer ns.Unlock()
+
+	// The tip or the VDF may have moved on while verifying
+	if err := ns.checkVDFUpdateLocked(seed, iterations); err != nil {
+		return err
+	}
+
+	// Blocks record the window's outputs as checkpoints of this run
+	if !consensus.CheckpointsCover(ns.Challenges.Points, iterations, checkpoints) {
+		return fmt.Errorf("VDF checkpoints don't include the outputs in the challenge window")
+	}
+
 	ns.VDFSeed = seed
 	ns.VDFIterations = iterations
 	ns.VDFOutput = output
+	ns.VDFCheckpoints = checkpoints
 	ns.HasVDF = true
 
-	// CRITICAL: Update challenge based on new VDF output!
-	// Challenge should be H(VDF_output || height)
-	h := sha256.New()
-	h.Write(output)
-	binary.Write(h, binary.BigEndian, ns.CurrentHeight+1)
-	ns.CurrentChallenge = sha256.Sum256(h.Sum(nil))
+	// Challenge is H(VDF_output || height); older ones stay valid while in the window
+	ns.Challenges.Add(consensus.VDFPoint{Iterations: iterations, Output: output})
+	ns.CurrentChallenge = ns.Challenges.Latest()
+	return nil
+}
+
+// checkVDFUpdate rejects a VDF update that can't be accepted whatever its
+// output: one without checkpoints, not run from the tip, not ahead of the
+// last update or claiming more iterations than could have been run since
+// the tip was adopted
+func (ns *NodeState) checkVDFUpdate(seed []byte, iterations uint64, checkpoints [][]byte) error {
+	if len(checkpoints) == 0 {
+		return fmt.Errorf("VDF update has no checkpoints")
+	}
+
+	ns.RLock()
+	defer ns.RUnlock()
+	return ns.checkVDFUpdateLocked(seed, iterations)
+}
+
+// checkVDFUpdateLocked checks a VDF update against the tip and the last
+// accepted update (caller must hold lock)
+func (ns *NodeState) checkVDFUpdateLocked(seed []byte, iterations uint64) error {
+	// Only a VDF run from the current tip yields challenges for the next block
+	tipHash := hashBlock(&ns.Chain[len(ns.Chain)-1])
+	if !bytes.Equal(seed, consensus.VDFSeed(tipHash, ns.CurrentHeight)) {
+		return fmt.Errorf("VDF seed is not derived from tip %d", ns.CurrentHeight)
+	}
+	if ns.HasVDF && bytes.Equal(seed, ns.VDFSeed) && iterations <= ns.VDFIterations {
+		return fmt.Errorf("VDF update at %d iterations is not ahead of %d", iterations, ns.VDFIterations)
+	}
+	elapsed := int64(time.Since(ns.VDFStarted) / time.Second)
+	if max := consensus.MaxVDFIterations(elapsed); iterations > max {
+		return fmt.Errorf("VDF update claims %d iterations, at most %d possible %ds after tip %d", iterations, max, elapsed, ns.CurrentHeight)
+	}
+	return nil
 }
 
 // LocalHeight returns current chain height
@@ -1090,118 +1431,21 @@ func (ns *NodeState) GetCurrentHeight() uint64 {
 
 // ApplyBlock applies a block received during IBD
 func (ns *NodeState) ApplyBlock(blockData json.RawMessage) error {
-	// Unmarshal to map first (blocks from /blocks/range are hex-encoded)
-	var blockMap map[string]interface{}
-	if err := json.Unmarshal(blockData, &blockMap); err != nil {
-		return fmt.Errorf("failed to unmarshal block map: %w", err)
-	}
-
-	// Extract and decode fields
-	height, _ := blockMap["height"].(float64)
-	difficulty, _ := blockMap["difficulty"].(float64)
-	timestamp, _ := blockMap["timestamp"].(float64)
-	farmerAddr, _ := blockMap["farmerAddr"].(string)
-	
-	// Decode hex fields
-	var prevHash, challenge [32]byte
-	if prevHashStr, ok := blockMap["prevHash"].(string); ok {
-		prevHashBytes, _ := hex.DecodeString(prevHashStr)
-		copy(prevHash[:], prevHashBytes)
-	}
-	if challengeStr, ok := blockMap["challenge"].(string); ok {
-		challengeBytes, _ := hex.DecodeString(challengeStr)
-		copy(challenge[:], challengeBytes)
-	}
-
-	// Extract transactions
-	txs := []ledger.Transaction{}
-	if txList, ok := blockMap["txs"].([]interface{}); ok {
-		for _, txRaw := range txList {
-			if txMap, ok := txRaw.(map[string]interface{}); ok {
-				tx := ledger.Transaction{
-					From:   getString(txMap, "from"),
-					To:     getString(txMap, "to"),
-					Amount: getInt64(txMap, "amount"),
-					Fee:    getInt64(txMap, "fee"),
-					Nonce:  getUint64(txMap, "nonce"),
-				}
-				txs = append(txs, tx)
-			}
-		}
-	}
-
-	// Reconstruct Block struct
-	block := Block{
-		Height:        uint64(height),
-		TimestampUnix: int64(timestamp),
-		PrevHash:      prevHash,
-		Difficulty:    uint64(difficulty),
-		Challenge:     challenge,
-		Txs:           txs,
-		Proof:         nil, // Not serialized in /blocks/range
-		FarmerAddr:    farmerAddr,
+	block, err := decodeRangeBlock(blockData)
+	if err != nil {
+		return err
 	}
 
 	ns.Lock()
 	defer ns.Unlock()
 
-	// Validate height continuity
-	expectedHeight := ns.CurrentHeight + 1
-	if block.Height != expectedHeight {
-		return fmt.Errorf("height discontinuity: expected %d, got %d", expectedHeight, block.Height)
-	}
-
-	// During IBD, we trust the seed node's blocks
-	// Full validation (including parent hash) happens only during P2P sync for new blocks
-	// We validate:
-	// 1. Height continuity (already checked above) ✓
-	// 2. Genesis hash match (checked at handshake) ✓
-	// 3. Network ID match (checked at handshake) ✓
-	//
-	// We skip:
-	// - Parent hash verification (can't recompute without full Proof data)
-	// - PoSpace proof verification (legacy blocks may have mismatched challenges)
-	// - Transaction signature verification (performance optimization during bulk sync)
-	//
-	// This allows backward-compatible sync from nodes with legacy block formats
-
-	// Apply transactions
-	for _, tx := range block.Txs {
-		if tx.From == "coinbase" {
-			// Coinbase transaction
-			receiver, ok := ns.WorldState.Accounts[tx.To]
-			if !ok {
-				receiver = &ledger.AccountState{Balance: 0, Nonce: 0}
-				ns.WorldState.Accounts[tx.To] = receiver
-			}
-			receiver.Balance += tx.Amount
-		} else {
-			// Regular transaction (skip validation during IBD for performance)
-			if err := ns.WorldState.ApplyTransaction(tx); err != nil {
-				log.Printf("[IBD] Warning: skipping invalid tx in block %d: %v", block.Height, err)
-			}
-		}
+	// Downloaded blocks get the same checks as blocks relayed by peers:
+	// linkage, difficulty, timestamp, challenge, farmer signature, PoSpace
+	// proof, coinbase and transactions
+	if block.Proof == nil {
+		return fmt.Errorf("block %d rejected: missing PoSpace proof", block.Height)
 	}
-
-	// Add block to chain
-	ns.Chain = append(ns.Chain, block)
-	ns.CurrentHeight = block.Height
-
-	// Persist to disk
-	if ns.BlockStore != nil {
-		if err := ns.BlockStore.SaveBlock(block.Height, block); err != nil {
-			return fmt.Errorf("failed to save block %d: %w", block.Height, err)
-		}
-	}
-
-	// Update tip in metadata
-	if ns.MetaStore != nil {
-		if err := ns.MetaStore.SaveTipHeight(block.Height); err != nil {
-			log.Printf("[IBD] Warning: failed to save tip height: %v", err)
-		}
-	}
-
-	return nil
+	return ns.extendChain(block)
 }
 
 // GetPeerCount returns number of connected peers
@@ -1220,6 +1464,22 @@ func (ns *NodeState) GetPeerList() (connected []string, known []string) {
 	return ns.P2P.GetPeerList()
 }
 
+// ListBans returns the peer hosts currently banned for misbehaving
+func (ns *NodeState) ListBans() interface{} {
+	if ns.P2P == nil {
+		return []p2p.Ban{}
+	}
+	return ns.P2P.Bans()
+}
+
+// ClearBans lifts the ban of a host, or every ban if host is empty
+func (ns *NodeState) ClearBans(host string) int {
+	if ns.P2P == nil {
+		return 0
+	}
+	return ns.P2P.ClearBans(host)
+}
+
 // GetHealthStats returns detailed health statistics
 func (ns *NodeState) GetHealthStats() interface{} {
 	if ns.Health == nil {
@@ -1243,53 +1503,95 @@ func (ns *NodeState) GetHealthStats() interface{} {
 func (ns *NodeState) VerifyAndApplyBlock(blockJSON json.RawMessage) error {
 	var block Block
 	if err := json.Unmarshal(blockJSON, &block); err != nil {
-		return fmt.Errorf("failed to unmarshal block: %w", err)
+		return invalidBlock(fmt.Errorf("failed to unmarshal block: %w", err))
+	}
+	run, err := ns.preverifyVDF(&block)
+	if err != nil {
+		return invalidBlock(err)
 	}
 
 	ns.Lock()
 	defer ns.Unlock()
+	ns.VerifiedVDF = run
+
+	if err := ns.importBlock(&block, blockJSON); err != nil {
+		return err
+	}
 
+	// Blocks that were waiting for this one can now be connected
+	ns.connectOrphans(hashBlock(&block))
+	return nil
+}
+
+// preverifyVDF checks the header of a block extending the tip and then, with
+// the lock released, verifies the VDF run it records, which takes the
+// longest of all block checks. It returns the run verified, if any; blocks
+// building on anything else are left to importBlock.
+func (ns *NodeState) preverifyVDF(block *Block) ([32]byte, error) {
+	ns.RLock()
+	parents := ns.Chain
+	parent := parents[len(parents)-1]
+	if len(block.ChallengeVDF) == 0 || block.Height < ns.ChallengeParams.ActivationHeight ||
+		block.Height != ns.CurrentHeight+1 || block.PrevHash != hashBlock(&parent) {
+		ns.RUnlock()
+		return [32]byte{}, nil
+	}
+	err := ns.checkHeader(parents, block)
+	ns.RUnlock()
+	if err != nil {
+		return [32]byte{}, err
+	}
+
+	parentHash := hashBlock(&parent)
+	if err := consensus.VerifyChallengeVDF(parentHash, block.Height, block.ChallengeVDF, block.VDFCheckpoints); err != nil {
+		return [32]byte{}, fmt.Errorf("invalid challenge: %w", err)
+	}
+	return vdfRun(parentHash, block), nil
+}
+
+// extendChain verifies a peer block extending the best tip and applies it
+// (caller must hold lock)
+func (ns *NodeState) extendChain(block Block) error {
 	// Verify block is next in sequence
 	if block.Height != ns.CurrentHeight+1 {
 		return fmt.Errorf("block height %d doesn't match expected %d", block.Height, ns.CurrentHeight+1)
 	}
 
-	// Verify prev hash
-	if len(ns.Chain) > 0 {
-		prevBlock := ns.Chain[len(ns.Chain)-1]
-		prevHash := hashBlock(&prevBlock)
-		if block.PrevHash != prevHash {
-			return fmt.Errorf("prev hash mismatch")
-		}
+	// Verify linkage, difficulty, PoSpace proof and coinbase
+	if err := ns.validateBlock(ns.Chain, &block); err != nil {
+		return invalidBlock(err)
 	}
+	return ns.connectBlock(block)
+}
 
-	// Verify difficulty matches expected (recompute from chain history)
-	// For now, trust the block's difficulty (production would recompute)
-	// TODO: Add RecomputeDifficulty(prev, params) and verify match
-
-	// Verify PoSpace proof using block's own difficulty and challenge!
-	if block.Proof != nil {
-		// Create temporary consensus with block's difficulty for verification
-		blockConsensus := &consensus.Consensus{DifficultyTarget: block.Difficulty}
-		if err := blockConsensus.VerifyProofOfSpace(block.Proof, block.Challenge); err != nil {
-			return fmt.Errorf("invalid PoSpace proof: %w", err)
-		}
+// connectBlock applies a validated block on top of the tip and persists it
+// (caller must hold lock)
+func (ns *NodeState) connectBlock(block Block) error {
+	// Re-execute every transaction; a block whose transfers don't apply
+	// cleanly is rejected and leaves the state untouched, except below the
+	// strict transaction activation where they are skipped as they used to
+	// be. Below the assume-valid block their signatures aren't re-verified.
+	assumed, err := ns.assumeValid(&block)
+	if err != nil {
+		return err
 	}
-
-	// Apply transactions (excluding coinbase)
-	for i, tx := range block.Txs {
-		if i == 0 && tx.From == "coinbase" {
-			// Skip coinbase validation
-			continue
-		}
-		// Transactions were already validated when block was created
-		// For received blocks, we trust the PoSpace proof validates the block
-		// In production, you'd re-verify all transactions here
+	newState, err := ns.applyBlock(ns.WorldState, &block, assumed)
+	if err != nil {
+		return invalidBlock(fmt.Errorf("block %d rejected: %w", block.Height, err))
 	}
+	if err := ns.checkRoots(&ns.Chain[len(ns.Chain)-1], &block, newState); err != nil {
+		return invalidBlock(fmt.Errorf("block %d rejected: %w", block.Height, err))
+	}
+	undo := ns.WorldState.CaptureUndo(txAccounts(block.Txs))
+	newState.Commit()
 
-	// Add block to chain
+	// Add block to chain (work is computed locally, never taken from the peer)
+	block.CumulativeWork = ns.tipWorkPlus(block.Difficulty)
 	ns.Chain = append(ns.Chain, block)
 	ns.CurrentHeight = block.Height
+	ns.updateDifficulty()
+	ns.recordUndo(block.Height, undo)
+	ns.advanceTree()
 
 	// Update Prometheus metrics
 	metrics.UpdateTipHeight(ns.CurrentHeight)
@@ -1303,13 +1605,22 @@ func (ns *NodeState) VerifyAndApplyBlock(blockJSON json.RawMessage) error {
 
 	// Update challenge for next block
 	newBlockHash := hashBlock(&block)
-	ns.CurrentChallenge = consensus.GenerateChallenge(newBlockHash, ns.CurrentHeight+1)
+	ns.resetChallenge()
 
 	// Persist to database
 	if ns.BlockStore != nil {
-		if err := ns.BlockStore.SaveBlock(block.Height, block); err != nil {
+		if err := ns.BlockStore.SaveBestBlock(newBlockHash, blockIndexEntry(&block), block); err != nil {
 			log.Printf("⚠️  Failed to persist block %d: %v", block.Height, err)
 		}
+		if err := ns.BlockStore.SaveUndo(newBlockHash, undo); err != nil {
+			log.Printf("⚠️  Failed to persist undo data %d: %v", block.Height, err)
+		}
+		for addr := range undo.Accounts {
+			acct := ns.WorldState.Accounts[addr]
+			if err := ns.StateStore.SaveAccount(addr, acct.Balance, acct.Nonce); err != nil {
+				log.Printf("⚠️  Failed to persist account %s: %v", addr, err)
+			}
+		}
 		if err := ns.MetaStore.SaveTipHeight(block.Height); err != nil {
 			log.Printf("⚠️  Failed to persist tip height: %v", err)
 		}
@@ -1320,6 +1631,156 @@ func (ns *NodeState) VerifyAndApplyBlock(blockJSON json.RawMessage) error {
 	return nil
 }
 
+// difficultyHeaders returns the headers of the last window+1 blocks of chain
+func difficultyHeaders(chain []Block, window int) []consensus.BlockInfo {
+	start := len(chain) - window - 1
+	if start < 0 {
+		start = 0
+	}
+	headers := make([]consensus.BlockInfo, 0, len(chain)-start)
+	for _, b := range chain[start:] {
+		headers = append(headers, consensus.BlockInfo{
+			Height:     b.Height,
+			Timestamp:  b.TimestampUnix,
+			Difficulty: b.Difficulty,
+		})
+	}
+	return headers
+}
+
+// checkTimestamp verifies a block's timestamp against its parents and the
+// local clock (caller must hold lock)
+func (ns *NodeState) checkTimestamp(parents []Block, block *Block) error {
+	headers := difficultyHeaders(parents, ns.TimestampParams.MedianSpan)
+	return consensus.CheckTimestamp(block.Height, block.TimestampUnix, headers, time.Now().Unix(), ns.TimestampParams)
+}
+
+// checkChallenge verifies that a block's proof answers a challenge from the
+// window recorded in the block, built on its parent, leaving the VDF run
+// behind the window to verifyChallengeVDF
+func (ns *NodeState) checkChallenge(parent *Block, block *Block) error {
+	if block.Proof != nil && block.Proof.Challenge != block.Challenge {
+		return fmt.Errorf("proof challenge %x differs from block challenge %x", block.Proof.Challenge[:8], block.Challenge[:8])
+	}
+	elapsed := block.TimestampUnix - parent.TimestampUnix
+	return consensus.CheckChallengeWindow(hashBlock(parent), block.Height, elapsed, block.Challenge, block.ChallengeVDF, block.VDFCheckpoints, ns.ChallengeParams)
+}
+
+// verifyChallengeVDF verifies the VDF run recorded in a block, unless it is
+// the one VerifyAndApplyBlock verified before taking the lock (caller must
+// hold lock)
+func (ns *NodeState) verifyChallengeVDF(parent *Block, block *Block) error {
+	if block.Height < ns.ChallengeParams.ActivationHeight {
+		return nil
+	}
+	parentHash := hashBlock(parent)
+	if run := vdfRun(parentHash, block); run == ns.VerifiedVDF {
+		ns.VerifiedVDF = [32]byte{}
+		return nil
+	}
+	return consensus.VerifyChallengeVDF(parentHash, block.Height, block.ChallengeVDF, block.VDFCheckpoints)
+}
+
+// vdfRun identifies the VDF run recorded in a block built on parentHash
+func vdfRun(parentHash [32]byte, block *Block) [32]byte {
+	h := sha256.New()
+	h.Write(parentHash[:])
+	for _, p := range block.ChallengeVDF {
+		binary.Write(h, binary.BigEndian, p.Iterations)
+		h.Write(p.Output)
+	}
+	for _, c := range block.VDFCheckpoints {
+		binary.Write(h, binary.BigEndian, uint32(len(c)))
+		h.Write(c)
+	}
+	var run [32]byte
+	h.Sum(run[:0])
+	return run
+}
+
+// checkFarmerSignature verifies that the plot's farmer signed the block: its
+// hash from the roots activation, which commits to the whole block, and its
+// farmer header before
+func (ns *NodeState) checkFarmerSignature(block *Block) error {
+	if block.Height < ns.Upgrades.FarmerSigs {
+		return nil
+	}
+	if block.Height >= ns.Upgrades.BlockRoots {
+		return consensus.VerifyBlockSignature(hashBlock(block), block.Proof, block.FarmerSig)
+	}
+	return consensus.VerifyFarmerSignature(block.Height, block.Proof, block.FarmerAddr, block.FarmerSig)
+}
+
+// assumeValid reports whether IBD may skip transfer signature checks for
+// block, which must then lie at or below the assume-valid block and commit
+// to a tx root: only from the roots activation does the assume-valid hash
+// vouch for the transfers of the blocks it builds on. Reaching that height
+// with a different block fails IBD. (caller must hold lock)
+func (ns *NodeState) assumeValid(block *Block) (bool, error) {
+	if ns.AssumeValidHeight == 0 || block.Height > ns.AssumeValidHeight {
+		return false, nil
+	}
+	if block.Height == ns.AssumeValidHeight && hashBlock(block) != ns.AssumeValidHash {
+		return false, fmt.Errorf("block %d does not match assume-valid block %x", block.Height, ns.AssumeValidHash)
+	}
+	return block.Height >= ns.Upgrades.BlockRoots, nil
+}
+
+// resetChallenge starts the challenge window of the block after the tip and
+// the clock that bounds VDF updates run from it
+// (caller must hold lock)
+func (ns *NodeState) resetChallenge() {
+	tipHash := hashBlock(&ns.Chain[len(ns.Chain)-1])
+	ns.Challenges = consensus.NewChallengeWindow(tipHash, ns.CurrentHeight+1, ns.ChallengeParams.WindowSize)
+	ns.CurrentChallenge = ns.Challenges.Latest()
+	ns.VDFStarted = time.Now()
+	ns.Templates = nil
+}
+
+// nextTimestamp returns the timestamp for a block extending the tip: the
+// current time, or just after the median time past if the clock is behind
+// (caller must hold lock)
+func (ns *NodeState) nextTimestamp() int64 {
+	now := time.Now().Unix()
+	headers := difficultyHeaders(ns.Chain, ns.TimestampParams.MedianSpan)
+	if mtp := consensus.MedianTimePast(headers, ns.TimestampParams.MedianSpan); now <= mtp {
+		return mtp + 1
+	}
+	return now
+}
+
+// tipWorkPlus returns the cumulative work of a block with difficulty extending the tip
+// (caller must hold lock)
+func (ns *NodeState) tipWorkPlus(difficulty uint64) *big.Int {
+	var parentWork *big.Int
+	if len(ns.Chain) > 0 {
+		parentWork = ns.Chain[len(ns.Chain)-1].CumulativeWork
+	}
+	return consensus.AddWork(parentWork, difficulty)
+}
+
+// updateDifficulty sets the difficulty of the next block from the chain (caller must hold lock)
+func (ns *NodeState) updateDifficulty() {
+	parents := difficultyHeaders(ns.Chain, ns.DifficultyParams.Window)
+	ns.Consensus.DifficultyTarget = consensus.NextDifficulty(parents, ns.DifficultyParams)
+}
+
+// loadGenesis reads the genesis file, which must be the one the database
+// was created from
+func loadGenesis(path string, genesisHash [32]byte) (*config.GenesisDoc, error) {
+	if path == "" {
+		return nil, fmt.Errorf("--genesis required to load genesis params")
+	}
+	gen, err := config.LoadGenesis(path)
+	if err != nil {
+		return nil, err
+	}
+	if config.HashGenesis(gen) != genesisHash {
+		return nil, fmt.Errorf("genesis file %s does not match database genesis %x", path, genesisHash[:8])
+	}
+	return gen, nil
+}
+
 // GetCurrentChallenge returns the current challenge and difficulty
 func (ns *NodeState) GetCurrentChallenge() ([32]byte, uint64, uint64) {
 	ns.RLock()
@@ -1328,25 +1789,241 @@ func (ns *NodeState) GetCurrentChallenge() ([32]byte, uint64, uint64) {
 }
 
 // Helper functions for IBD block parsing
-func getString(m map[string]interface{}, key string) string {
-	if val, ok := m[key].(string); ok {
-		return val
+// decodeRangeBlock rebuilds a full block, proof included, from the JSON
+// served by /blocks/range and checks it hashes to the hash the peer served
+func decodeRangeBlock(blockData json.RawMessage) (Block, error) {
+	var rb rangeBlock
+	if err := json.Unmarshal(blockData, &rb); err != nil {
+		return Block{}, fmt.Errorf("failed to unmarshal block: %w", err)
+	}
+
+	block := Block{
+		Height:        rb.Height,
+		TimestampUnix: rb.Timestamp,
+		Difficulty:    rb.Difficulty,
+		FarmerAddr:    rb.FarmerAddr,
+		Txs:           make([]ledger.Transaction, 0, len(rb.Txs)),
+	}
+	var err error
+	if block.PrevHash, err = decodeHash32(rb.PrevHash); err != nil {
+		return Block{}, fmt.Errorf("invalid prevHash in block %d: %w", rb.Height, err)
+	}
+	if block.Challenge, err = decodeHash32(rb.Challenge); err != nil {
+		return Block{}, fmt.Errorf("invalid challenge in block %d: %w", rb.Height, err)
+	}
+	if block.FarmerSig, err = hex.DecodeString(rb.FarmerSig); err != nil {
+		return Block{}, fmt.Errorf("invalid farmerSig in block %d: %w", rb.Height, err)
+	}
+	if block.TxRoot, err = decodeHash32(rb.TxRoot); err != nil {
+		return Block{}, fmt.Errorf("invalid txRoot in block %d: %w", rb.Height, err)
+	}
+	if block.StateRoot, err = decodeHash32(rb.StateRoot); err != nil {
+		return Block{}, fmt.Errorf("invalid stateRoot in block %d: %w", rb.Height, err)
+	}
+
+	// Signatures let the transfers be re-verified
+	for i, rt := range rb.Txs {
+		tx := ledger.Transaction{From: rt.From, To: rt.To, Amount: rt.Amount, Fee: rt.Fee, Nonce: rt.Nonce, Memo: rt.Memo}
+		if tx.SenderPubKey, err = hex.DecodeString(rt.SenderPubKey); err != nil {
+			return Block{}, fmt.Errorf("invalid senderPubKey in block %d tx %d: %w", rb.Height, i, err)
+		}
+		if tx.Signature, err = hex.DecodeString(rt.Signature); err != nil {
+			return Block{}, fmt.Errorf("invalid signature in block %d tx %d: %w", rb.Height, i, err)
+		}
+		block.Txs = append(block.Txs, tx)
+	}
+
+	if rb.Proof != nil {
+		if block.Proof, err = rb.Proof.decode(); err != nil {
+			return Block{}, fmt.Errorf("invalid proof in block %d: %w", rb.Height, err)
+		}
+	}
+	for _, p := range rb.ChallengeVDF {
+		output, err := hex.DecodeString(p.Output)
+		if err != nil {
+			return Block{}, fmt.Errorf("invalid VDF output in block %d: %w", rb.Height, err)
+		}
+		block.ChallengeVDF = append(block.ChallengeVDF, consensus.VDFPoint{Iterations: p.Iterations, Output: output})
+	}
+	for _, c := range rb.VDFCheckpoints {
+		checkpoint, err := hex.DecodeString(c)
+		if err != nil {
+			return Block{}, fmt.Errorf("invalid VDF checkpoint in block %d: %w", rb.Height, err)
+		}
+		block.VDFCheckpoints = append(block.VDFCheckpoints, checkpoint)
+	}
+
+	// A block that doesn't hash to the served hash lost or gained fields on the way
+	if rb.Hash != "" {
+		if hash := hashBlock(&block); hex.EncodeToString(hash[:]) != rb.Hash {
+			return Block{}, fmt.Errorf("block %d does not hash to served hash %s", rb.Height, rb.Hash)
+		}
+	}
+
+	return block, nil
+}
+
+// rangeBlock is a block as served by /blocks/range
+type rangeBlock struct {
+	Height         uint64          `json:"height"`
+	Hash           string          `json:"hash"`
+	PrevHash       string          `json:"prevHash"`
+	Timestamp      int64           `json:"timestamp"`
+	Difficulty     uint64          `json:"difficulty"`
+	Challenge      string          `json:"challenge"`
+	FarmerAddr     string          `json:"farmerAddr"`
+	FarmerSig      string          `json:"farmerSig"`
+	TxRoot         string          `json:"txRoot"`
+	StateRoot      string          `json:"stateRoot"`
+	Txs            []rangeTx       `json:"txs"`
+	Proof          *rangeProof     `json:"proof"`
+	ChallengeVDF   []rangeVDFPoint `json:"challengeVDF"`
+	VDFCheckpoints []string        `json:"vdfCheckpoints"`
+}
+
+// rangeTx is a hex-encoded transaction served with /blocks/range blocks
+type rangeTx struct {
+	From         string `json:"from"`
+	To           string `json:"to"`
+	Amount       int64  `json:"amount"`
+	Fee          int64  `json:"fee"`
+	Nonce        uint64 `json:"nonce"`
+	SenderPubKey string `json:"senderPubKey"`
+	Signature    string `json:"signature"`
+	Memo         string `json:"memo"`
+}
+
+// decodeHash32 decodes a hex-encoded 32-byte hash, empty meaning zero
+func decodeHash32(s string) ([32]byte, error) {
+	var h [32]byte
+	if s == "" {
+		return h, nil
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return h, err
+	}
+	if len(b) != len(h) {
+		return h, fmt.Errorf("expected %d bytes, got %d", len(h), len(b))
 	}
-	return ""
+	copy(h[:], b)
+	return h, nil
 }
 
-func getUint64(m map[string]interface{}, key string) uint64 {
-	if val, ok := m[key].(float64); ok {
-		return uint64(val)
+// rangeProof is the hex-encoded proof served with /blocks/range blocks
+type rangeProof struct {
+	Hash         string   `json:"hash"`
+	Quality      uint64   `json:"quality"`
+	PlotID       string   `json:"plotID"`
+	Index        uint64   `json:"index"`
+	FarmerPubKey string   `json:"farmerPubKey"`
+	Version      uint32   `json:"version"`
+	KSize        uint32   `json:"kSize"`
+	XValues      []uint32 `json:"xValues"`
+	Challenge    string   `json:"challenge"`
+	PlotSeed     string   `json:"plotSeed"`
+	PoolAddress  string   `json:"poolAddress"`
+}
+
+// decode converts the proof back to its binary form. Fields missing from
+// peers running older versions are left zero.
+func (rp *rangeProof) decode() (*pospace.Proof, error) {
+	proof := &pospace.Proof{
+		Quality: rp.Quality,
+		Index:   rp.Index,
+		KSize:   rp.KSize,
+		XValues: rp.XValues,
+	}
+	if rp.Version != pospace.PlotVersionV1 {
+		proof.Version = rp.Version
+	}
+	fields := []struct {
+		name string
+		hex  string
+		dst  []byte
+	}{
+		{"hash", rp.Hash, proof.Hash[:]},
+		{"plotID", rp.PlotID, proof.PlotID[:]},
+		{"farmerPubKey", rp.FarmerPubKey, proof.FarmerPubKey[:]},
+		{"challenge", rp.Challenge, proof.Challenge[:]},
+		{"plotSeed", rp.PlotSeed, proof.PlotSeed[:]},
+		{"poolAddress", rp.PoolAddress, proof.PoolAddress[:]},
+	}
+	for _, f := range fields {
+		if f.hex == "" {
+			continue
+		}
+		b, err := hex.DecodeString(f.hex)
+		if err != nil || len(b) != len(f.dst) {
+			return nil, fmt.Errorf("invalid %s", f.name)
+		}
+		copy(f.dst, b)
 	}
-	return 0
+	return proof, nil
 }
 
-func getInt64(m map[string]interface{}, key string) int64 {
-	if val, ok := m[key].(float64); ok {
-		return int64(val)
+// rangeVDFPoint is a hex-encoded challenge window VDF output
+type rangeVDFPoint struct {
+	Iterations uint64 `json:"iterations"`
+	Output     string `json:"output"`
+}
+
+// formatChallengeVDF hex-encodes the challenge window VDF outputs of a block
+func formatChallengeVDF(points []consensus.VDFPoint) []rangeVDFPoint {
+	formatted := make([]rangeVDFPoint, len(points))
+	for i, p := range points {
+		formatted[i] = rangeVDFPoint{Iterations: p.Iterations, Output: hex.EncodeToString(p.Output)}
 	}
-	return 0
+	return formatted
+}
+
+// formatVDFCheckpoints hex-encodes the VDF checkpoints of a block
+func formatVDFCheckpoints(checkpoints [][]byte) []string {
+	formatted := make([]string, len(checkpoints))
+	for i, c := range checkpoints {
+		formatted[i] = hex.EncodeToString(c)
+	}
+	return formatted
+}
+
+// coinbaseTxs builds the coinbase transactions for a block's reward payouts
+func coinbaseTxs(payouts []consensus.RewardPayout) []ledger.Transaction {
+	txs := make([]ledger.Transaction, 0, len(payouts))
+	for _, payout := range payouts {
+		txs = append(txs, ledger.Transaction{
+			From:         "coinbase",
+			To:           payout.Address,
+			Amount:       payout.Amount,
+			Fee:          0,
+			Nonce:        0,
+			SenderPubKey: nil, // Coinbase has no sender
+			Signature:    nil, // Coinbase has no signature
+		})
+	}
+	return txs
+}
+
+// verifyCoinbase checks that a block's coinbase transactions match the reward split
+func verifyCoinbase(b *Block) error {
+	payouts, err := consensus.BlockRewardPayouts(config.InitialBlockReward, b.FarmerAddr, b.Proof)
+	if err != nil {
+		return err
+	}
+	if len(b.Txs) < len(payouts) {
+		return fmt.Errorf("expected %d coinbase txs, block has %d txs", len(payouts), len(b.Txs))
+	}
+	for i, payout := range payouts {
+		tx := b.Txs[i]
+		if tx.From != "coinbase" || tx.To != payout.Address || tx.Amount != payout.Amount {
+			return fmt.Errorf("coinbase %d pays %d to %s, expected %d to %s", i, tx.Amount, tx.To, payout.Amount, payout.Address)
+		}
+	}
+	for _, tx := range b.Txs[len(payouts):] {
+		if tx.From == "coinbase" {
+			return fmt.Errorf("unexpected extra coinbase to %s", tx.To)
+		}
+	}
+	return nil
 }
 
 // hashBlock computes the hash of a block
@@ -1361,6 +2038,20 @@ func hashBlock(b *Block) [32]byte {
 	if b.Proof != nil {
 		h.Write(b.Proof.Hash[:])
 	}
+	for _, p := range b.ChallengeVDF {
+		fmt.Fprintf(h, "%d", p.Iterations)
+		h.Write(p.Output)
+	}
+	// Blocks from the roots activation on commit to their txs and state,
+	// and to their reward and pool addresses, which their farmer signs
+	if b.TxRoot != ([32]byte{}) || b.StateRoot != ([32]byte{}) {
+		h.Write(b.TxRoot[:])
+		h.Write(b.StateRoot[:])
+		fmt.Fprintf(h, "%d:%s", len(b.FarmerAddr), b.FarmerAddr)
+		if b.Proof != nil {
+			h.Write(b.Proof.PoolAddress[:])
+		}
+	}
 	return sha256.Sum256(h.Sum(nil))
 }
 
@@ -1434,12 +2125,15 @@ func (ns *NodeState) GetBlockByHeight(height uint64) (interface{}, error) {
 		}
 
 		formattedTxs[i] = map[string]interface{}{
-			"type":   txType,
-			"from":   tx.From,
-			"to":     tx.To,
-			"amount": tx.Amount,
-			"fee":    tx.Fee,
-			"nonce":  tx.Nonce,
+			"type":         txType,
+			"from":         tx.From,
+			"to":           tx.To,
+			"amount":       tx.Amount,
+			"fee":          tx.Fee,
+			"nonce":        tx.Nonce,
+			"senderPubKey": hex.EncodeToString(tx.SenderPubKey),
+			"signature":    hex.EncodeToString(tx.Signature),
+			"memo":         tx.Memo,
 		}
 	}
 
@@ -1452,20 +2146,31 @@ func (ns *NodeState) GetBlockByHeight(height uint64) (interface{}, error) {
 			"plotID":       hex.EncodeToString(block.Proof.PlotID[:]),
 			"index":        block.Proof.Index,
 			"farmerPubKey": hex.EncodeToString(block.Proof.FarmerPubKey[:]),
+			"version":      block.Proof.FormatVersion(),
+			"kSize":        block.Proof.KSize,
+			"xValues":      block.Proof.XValues,
+			"challenge":    hex.EncodeToString(block.Proof.Challenge[:]),
+			"plotSeed":     hex.EncodeToString(block.Proof.PlotSeed[:]),
+			"poolAddress":  hex.EncodeToString(block.Proof.PoolAddress[:]),
 		}
 	}
 
 	return map[string]interface{}{
-		"height":     block.Height,
-		"hash":       hex.EncodeToString(blockHash[:]),
-		"prevHash":   hex.EncodeToString(block.PrevHash[:]),
-		"timestamp":  block.TimestampUnix,
-		"difficulty": block.Difficulty,
-		"challenge":  hex.EncodeToString(block.Challenge[:]),
-		"farmerAddr": block.FarmerAddr,
-		"txCount":    len(block.Txs),
-		"txs":        formattedTxs,
-		"proof":      proofData, // Include proof for hash calculation during IBD
+		"height":         block.Height,
+		"hash":           hex.EncodeToString(blockHash[:]),
+		"prevHash":       hex.EncodeToString(block.PrevHash[:]),
+		"timestamp":      block.TimestampUnix,
+		"difficulty":     block.Difficulty,
+		"challenge":      hex.EncodeToString(block.Challenge[:]),
+		"farmerAddr":     block.FarmerAddr,
+		"farmerSig":      hex.EncodeToString(block.FarmerSig),
+		"txRoot":         hex.EncodeToString(block.TxRoot[:]),
+		"stateRoot":      hex.EncodeToString(block.StateRoot[:]),
+		"txCount":        len(block.Txs),
+		"txs":            formattedTxs,
+		"proof":          proofData, // Include proof for hash calculation during IBD
+		"challengeVDF":   formatChallengeVDF(block.ChallengeVDF),
+		"vdfCheckpoints": formatVDFCheckpoints(block.VDFCheckpoints),
 	}, nil
 }
 
@@ -1488,12 +2193,15 @@ func (ns *NodeState) GetBlockByHash(hash [32]byte) (interface{}, error) {
 				}
 
 				formattedTxs[j] = map[string]interface{}{
-					"type":   txType,
-					"from":   tx.From,
-					"to":     tx.To,
-					"amount": tx.Amount,
-					"fee":    tx.Fee,
-					"nonce":  tx.Nonce,
+					"type":         txType,
+					"from":         tx.From,
+					"to":           tx.To,
+					"amount":       tx.Amount,
+					"fee":          tx.Fee,
+					"nonce":        tx.Nonce,
+					"senderPubKey": hex.EncodeToString(tx.SenderPubKey),
+					"signature":    hex.EncodeToString(tx.Signature),
+					"memo":         tx.Memo,
 				}
 			}
 
@@ -1506,20 +2214,31 @@ func (ns *NodeState) GetBlockByHash(hash [32]byte) (interface{}, error) {
 					"plotID":       hex.EncodeToString(block.Proof.PlotID[:]),
 					"index":        block.Proof.Index,
 					"farmerPubKey": hex.EncodeToString(block.Proof.FarmerPubKey[:]),
+					"version":      block.Proof.FormatVersion(),
+					"kSize":        block.Proof.KSize,
+					"xValues":      block.Proof.XValues,
+					"challenge":    hex.EncodeToString(block.Proof.Challenge[:]),
+					"plotSeed":     hex.EncodeToString(block.Proof.PlotSeed[:]),
+					"poolAddress":  hex.EncodeToString(block.Proof.PoolAddress[:]),
 				}
 			}
 
 			return map[string]interface{}{
-				"height":     block.Height,
-				"hash":       hex.EncodeToString(blockHash[:]),
-				"prevHash":   hex.EncodeToString(block.PrevHash[:]),
-				"timestamp":  block.TimestampUnix,
-				"difficulty": block.Difficulty,
-				"challenge":  hex.EncodeToString(block.Challenge[:]),
-				"farmerAddr": block.FarmerAddr,
-				"txCount":    len(block.Txs),
-				"txs":        formattedTxs,
-				"proof":      proofData,
+				"height":         block.Height,
+				"hash":           hex.EncodeToString(blockHash[:]),
+				"prevHash":       hex.EncodeToString(block.PrevHash[:]),
+				"timestamp":      block.TimestampUnix,
+				"difficulty":     block.Difficulty,
+				"challenge":      hex.EncodeToString(block.Challenge[:]),
+				"farmerAddr":     block.FarmerAddr,
+				"farmerSig":      hex.EncodeToString(block.FarmerSig),
+				"txRoot":         hex.EncodeToString(block.TxRoot[:]),
+				"stateRoot":      hex.EncodeToString(block.StateRoot[:]),
+				"txCount":        len(block.Txs),
+				"txs":            formattedTxs,
+				"proof":          proofData,
+				"challengeVDF":   formatChallengeVDF(block.ChallengeVDF),
+				"vdfCheckpoints": formatVDFCheckpoints(block.VDFCheckpoints),
 			}, nil
 		}
 	}
@@ -1775,10 +2494,14 @@ func printUsage() {
 	fmt.Println("  --db <path>                 Database directory (default: ./data)")
 	fmt.Println("  --genesis <path>            Genesis file path (overrides network profile)")
 	fmt.Println("  --network-id <id>           Network ID (overrides network profile)")
+	fmt.Println("  --node-name <name>          Node name advertised to peers")
+	fmt.Println("  --node-key <path>           P2P identity key (default: <db>/node_key)")
+	fmt.Println("  --peer-ban-threshold <N>    Ban peers at this misbehavior score [default: -20]")
+	fmt.Println("  --ban-duration <dur>        How long misbehaving peers stay banned [default: 30m]")
 	fmt.Println()
 	fmt.Println("Private Node Flags:")
 	fmt.Println("  --no-peer-discovery         Disable automatic peer discovery")
-	fmt.Println("  --peer-whitelist <host:port> Whitelisted peer (repeatable)")
+	fmt.Println("  --peer-whitelist <host:port> Whitelisted peer (repeatable; <node ID>@host:port pins its key)")
 	fmt.Println("  --checkpoint-height <N>     Checkpoint height for validation")
 	fmt.Println("  --checkpoint-hash <hash>    Checkpoint block hash (hex)")
 	fmt.Println()
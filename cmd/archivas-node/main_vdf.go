@@ -22,6 +22,7 @@ type BlockVDF struct {
 	Height        uint64
 	TimestampUnix int64
 	PrevHash      [32]byte
+	Difficulty    uint64
 	Txs           []ledger.Transaction
 	Proof         *pospace.Proof // Proof-of-Space
 	FarmerAddr    string         // Address to receive block reward
@@ -31,6 +32,10 @@ type BlockVDF struct {
 	VDFOutput     []byte
 }
 
+// vdfVerifier checks timelord outputs. Devnet uses the SHA-256 hash chain,
+// which carries no proof.
+var vdfVerifier vdf.Verifier = vdf.HashChain{}
+
 // VDFState holds current VDF state
 type VDFState struct {
 	Seed       []byte
@@ -49,9 +54,11 @@ type NodeStateVDF struct {
 	CurrentHeight    uint64
 	CurrentChallenge [32]byte
 	CurrentVDF       *VDFState
+	DifficultyParams consensus.DifficultyParams
+	Upgrades         consensus.Upgrades
 }
 
-func mainVDF() {
+func mainVDF(gen *config.GenesisDoc) {
 	log.Println("[DEBUG] Archivas node starting (VDF-enabled)...")
 	fmt.Println("Archivas Devnet Node running… (Proof-of-Space-and-Time)")
 	fmt.Println()
@@ -86,7 +93,11 @@ func mainVDF() {
 
 	// Initialize consensus
 	log.Println("[DEBUG] Initializing consensus...")
-	cs := consensus.NewConsensus()
+	diffParams := consensus.GenesisDifficultyParams(gen)
+	if err := diffParams.Validate(); err != nil {
+		log.Fatalf("Invalid genesis difficulty params: %v", err)
+	}
+	cs := &consensus.Consensus{DifficultyTarget: diffParams.InitialDifficulty}
 	fmt.Printf("⚙️  Consensus initialized (difficulty: %d)\n", cs.DifficultyTarget)
 	fmt.Println()
 
@@ -127,6 +138,8 @@ func mainVDF() {
 		CurrentHeight:    0,
 		CurrentChallenge: genesisChallenge,
 		CurrentVDF:       initialVDF,
+		DifficultyParams: diffParams,
+		Upgrades:         consensus.GenesisUpgrades(gen),
 	}
 
 	log.Println("[DEBUG] Initialized chain memory")
@@ -191,7 +204,7 @@ func (ns *NodeStateVDF) AcceptBlock(proof *pospace.Proof, farmerAddr string, far
 	}
 
 	// Verify VDF output
-	if !vdf.VerifySequential(vdfSeed, vdfIterations, vdfOutput) {
+	if !vdfVerifier.Verify(vdfSeed, vdfIterations, vdfOutput, nil) {
 		return fmt.Errorf("VDF verification failed")
 	}
 
@@ -200,31 +213,31 @@ func (ns *NodeStateVDF) AcceptBlock(proof *pospace.Proof, farmerAddr string, far
 	if err := ns.Consensus.VerifyProofOfSpace(proof, vdfChallenge); err != nil {
 		return fmt.Errorf("invalid proof: %w", err)
 	}
+	if err := consensus.CheckPlotVersion(proof, nextHeight, ns.Upgrades); err != nil {
+		return fmt.Errorf("invalid proof: %w", err)
+	}
+
+	// Split the block reward between farmer and pool
+	payouts, err := consensus.BlockRewardPayouts(config.InitialBlockReward, farmerAddr, proof)
+	if err != nil {
+		return fmt.Errorf("invalid proof: %w", err)
+	}
 
 	// Get pending transactions
 	pending := ns.Mempool.Pending()
 
-	// Create coinbase transaction (block reward to farmer)
-	coinbase := ledger.Transaction{
-		From:         "coinbase",
-		To:           farmerAddr,
-		Amount:       config.InitialBlockReward,
-		Fee:          0,
-		Nonce:        0,
-		SenderPubKey: nil,
-		Signature:    nil,
-	}
-
 	// Build transaction list
-	allTxs := []ledger.Transaction{coinbase}
+	allTxs := coinbaseTxs(payouts)
 
 	// Apply coinbase
-	receiver, ok := ns.WorldState.Accounts[farmerAddr]
-	if !ok {
-		receiver = &ledger.AccountState{Balance: 0, Nonce: 0}
-		ns.WorldState.Accounts[farmerAddr] = receiver
+	for _, payout := range payouts {
+		receiver, ok := ns.WorldState.Accounts[payout.Address]
+		if !ok {
+			receiver = &ledger.AccountState{Balance: 0, Nonce: 0}
+			ns.WorldState.Accounts[payout.Address] = receiver
+		}
+		receiver.Balance += payout.Amount
 	}
-	receiver.Balance += config.InitialBlockReward
 
 	// Apply user transactions
 	validTxs := []ledger.Transaction{}
@@ -251,6 +264,7 @@ func (ns *NodeStateVDF) AcceptBlock(proof *pospace.Proof, farmerAddr string, far
 		Height:        nextHeight,
 		TimestampUnix: time.Now().Unix(),
 		PrevHash:      prevHash,
+		Difficulty:    ns.Consensus.DifficultyTarget,
 		Txs:           allTxs,
 		Proof:         proof,
 		FarmerAddr:    farmerAddr,
@@ -282,26 +296,16 @@ func (ns *NodeStateVDF) AcceptBlock(proof *pospace.Proof, farmerAddr string, far
 	ns.CurrentChallenge = computeChallengeFromVDF(newVDFSeed, nextHeight+1)
 
 	// Update difficulty
-	if len(ns.Chain) >= 2 {
-		recentTimes := make([]int64, 0, 10)
-		startIdx := len(ns.Chain) - 10
-		if startIdx < 0 {
-			startIdx = 0
-		}
-		for i := startIdx; i < len(ns.Chain); i++ {
-			recentTimes = append(recentTimes, ns.Chain[i].TimestampUnix)
-		}
-		// Calculate average block time
-		var avgBlockTime time.Duration
-		if len(recentTimes) > 1 {
-			var total int64
-			for _, t := range recentTimes {
-				total += t
-			}
-			avgBlockTime = time.Duration(total/int64(len(recentTimes))) * time.Second
-		}
-		ns.Consensus.UpdateDifficulty(avgBlockTime)
+	params := ns.DifficultyParams
+	start := len(ns.Chain) - params.Window - 1
+	if start < 0 {
+		start = 0
+	}
+	parents := make([]consensus.BlockInfo, 0, len(ns.Chain)-start)
+	for _, b := range ns.Chain[start:] {
+		parents = append(parents, consensus.BlockInfo{Height: b.Height, Timestamp: b.TimestampUnix, Difficulty: b.Difficulty})
 	}
+	ns.Consensus.DifficultyTarget = consensus.NextDifficulty(parents, params)
 
 	log.Printf("✅ Accepted block %d from farmer %s (PoSpace ✅, VDF t=%d ✅, reward: %.8f %s, txs: %d)",
 		nextHeight, farmerAddr, vdfIterations, float64(config.InitialBlockReward)/100000000.0, config.DenomSymbol, len(validTxs))
@@ -312,7 +316,7 @@ func (ns *NodeStateVDF) AcceptBlock(proof *pospace.Proof, farmerAddr string, far
 }
 
 // UpdateVDF is called by timelord to update VDF state
-func (ns *NodeStateVDF) UpdateVDF(seed []byte, iterations uint64, output []byte) error {
+func (ns *NodeStateVDF) UpdateVDF(seed []byte, iterations uint64, output []byte, checkpoints [][]byte) error {
 	ns.Lock()
 	defer ns.Unlock()
 
@@ -321,8 +325,8 @@ func (ns *NodeStateVDF) UpdateVDF(seed []byte, iterations uint64, output []byte)
 		return fmt.Errorf("VDF seed mismatch")
 	}
 
-	// Verify the VDF computation
-	if !vdf.VerifySequential(seed, iterations, output) {
+	// Verify the VDF computation, one checkpoint segment per core
+	if !vdf.VerifyWithCheckpoints(seed, iterations, checkpoints, output) {
 		return fmt.Errorf("VDF verification failed")
 	}
 
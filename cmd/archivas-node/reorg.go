@@ -0,0 +1,375 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/ArchivasNetwork/archivas/consensus"
+	"github.com/ArchivasNetwork/archivas/ledger"
+	"github.com/ArchivasNetwork/archivas/metrics"
+	"github.com/ArchivasNetwork/archivas/p2p"
+	"github.com/ArchivasNetwork/archivas/storage"
+)
+
+// Chain reorganization
+//
+// Every block applied to the chain records a ledger.BlockUndo holding the
+// accounts it touched as they were before the block. To switch to a competing
+// branch with more work, Reorganize rolls a copy of the world state back to
+// the fork point with those records, validates and applies the branch on top
+// of it and only then commits: the new blocks, undo data and accounts go to
+// disk in one batch and the in-memory chain and state are swapped under the
+// lock. If any branch block is invalid the node is left untouched.
+
+// errPrevHash is returned for a block that doesn't link to the given parents
+var errPrevHash = errors.New("prev hash mismatch")
+
+// branchBlockError is returned by reorganize for the branch block that
+// failed to validate or apply
+type branchBlockError struct {
+	Height uint64
+	Err    error
+}
+
+func (e *branchBlockError) Error() string {
+	return fmt.Sprintf("branch block %d: %v", e.Height, e.Err)
+}
+
+func (e *branchBlockError) Unwrap() error {
+	return e.Err
+}
+
+// invalidBlock marks a validation error as p2p.ErrInvalidBlock, which counts
+// against the peer that sent the block. A block on another branch or only
+// too far in the future may still be valid and isn't marked.
+func invalidBlock(err error) error {
+	if err == nil || errors.Is(err, errPrevHash) || errors.Is(err, consensus.ErrFutureTimestamp) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", p2p.ErrInvalidBlock, err)
+}
+
+// validateBlock checks a block extending parents: its header, then the
+// coinbase split (caller must hold lock)
+func (ns *NodeState) validateBlock(parents []Block, block *Block) error {
+	if err := ns.validateHeader(parents, block); err != nil {
+		return err
+	}
+	if err := verifyCoinbase(block); err != nil {
+		return fmt.Errorf("invalid coinbase: %w", err)
+	}
+	return nil
+}
+
+// validateHeader checks everything about a block extending parents except
+// its transactions: parent hash, difficulty, timestamp, farmer signature,
+// PoSpace proof and challenge window. The VDF run behind the challenge is
+// verified last, once everything cheaper has passed. (caller must hold lock)
+func (ns *NodeState) validateHeader(parents []Block, block *Block) error {
+	if err := ns.checkHeader(parents, block); err != nil {
+		return err
+	}
+	if len(parents) > 0 {
+		if err := ns.verifyChallengeVDF(&parents[len(parents)-1], block); err != nil {
+			return fmt.Errorf("invalid challenge: %w", err)
+		}
+	}
+	return nil
+}
+
+// checkHeader is validateHeader without verifying the VDF run (caller must
+// hold read lock)
+func (ns *NodeState) checkHeader(parents []Block, block *Block) error {
+	if len(parents) > 0 {
+		prevBlock := parents[len(parents)-1]
+		if block.PrevHash != hashBlock(&prevBlock) {
+			return errPrevHash
+		}
+	}
+
+	// Verify difficulty matches the one recomputed from chain history
+	headers := difficultyHeaders(parents, ns.DifficultyParams.Window)
+	if err := consensus.CheckDifficulty(block.Height, block.Difficulty, headers, ns.DifficultyParams); err != nil {
+		return fmt.Errorf("invalid difficulty: %w", err)
+	}
+
+	// Timestamps feed the difficulty rule, so they are bounded too
+	if err := ns.checkTimestamp(parents, block); err != nil {
+		return fmt.Errorf("invalid timestamp: %w", err)
+	}
+
+	if err := ns.checkFarmerSignature(block); err != nil {
+		return fmt.Errorf("invalid block signature: %w", err)
+	}
+	if err := ns.checkProof(block); err != nil {
+		return err
+	}
+
+	// The proof must answer a challenge from the parent's window
+	if len(parents) > 0 {
+		if err := ns.checkChallenge(&parents[len(parents)-1], block); err != nil {
+			return fmt.Errorf("invalid challenge: %w", err)
+		}
+	}
+	return nil
+}
+
+// expectedDifficulty returns the difficulty the rules require of a block
+// extending parents. Below the difficulty activation any difficulty was
+// accepted, so it is the block's own. (caller must hold lock)
+func (ns *NodeState) expectedDifficulty(parents []Block, block *Block) uint64 {
+	if block.Height < ns.DifficultyParams.ActivationHeight {
+		return block.Difficulty
+	}
+	return consensus.NextDifficulty(difficultyHeaders(parents, ns.DifficultyParams.Window), ns.DifficultyParams)
+}
+
+// checkProof verifies a block's PoSpace proof against its own difficulty
+// and challenge
+func (ns *NodeState) checkProof(block *Block) error {
+	if block.Proof == nil {
+		return fmt.Errorf("invalid PoSpace proof: block %d has no proof", block.Height)
+	}
+	if err := consensus.CheckPlotVersion(block.Proof, block.Height, ns.Upgrades); err != nil {
+		return fmt.Errorf("invalid PoSpace proof: %w", err)
+	}
+	// Create temporary consensus with block's difficulty for verification
+	blockConsensus := &consensus.Consensus{DifficultyTarget: block.Difficulty}
+	if err := blockConsensus.VerifyProofOfSpace(block.Proof, block.Challenge); err != nil {
+		return fmt.Errorf("invalid PoSpace proof: %w", err)
+	}
+	return nil
+}
+
+// recordUndo keeps the undo data of a newly applied block, dropping records
+// older than the maximum reorg depth (caller must hold lock)
+func (ns *NodeState) recordUndo(height uint64, undo *ledger.BlockUndo) {
+	ns.UndoLog[height] = undo
+	depth := uint64(ns.ReorgDetector.MaxReorgDepth)
+	if height > depth {
+		delete(ns.UndoLog, height-depth)
+	}
+}
+
+// loadUndoLog reads the undo data of the last MaxReorgDepth blocks from disk
+func (ns *NodeState) loadUndoLog() {
+	depth := uint64(ns.ReorgDetector.MaxReorgDepth)
+	for h := ns.CurrentHeight; h > 0 && ns.CurrentHeight-h < depth; h-- {
+		var undo ledger.BlockUndo
+		if err := ns.BlockStore.LoadUndo(hashBlock(&ns.Chain[h]), &undo); err != nil {
+			break // Blocks stored before undo data existed
+		}
+		ns.UndoLog[h] = &undo
+	}
+}
+
+// GetBlockHash returns the hash of the block at height on the best chain
+func (ns *NodeState) GetBlockHash(height uint64) ([32]byte, bool) {
+	ns.RLock()
+	defer ns.RUnlock()
+
+	if height >= uint64(len(ns.Chain)) {
+		return [32]byte{}, false
+	}
+	return hashBlock(&ns.Chain[height]), true
+}
+
+// ReorganizeBlocks switches to a branch downloaded from /blocks/range
+func (ns *NodeState) ReorganizeBlocks(blocks []json.RawMessage) (consensus.ReorgInfo, error) {
+	branch := make([]Block, 0, len(blocks))
+	for _, data := range blocks {
+		block, err := decodeRangeBlock(data)
+		if err != nil {
+			return consensus.ReorgInfo{}, err
+		}
+		branch = append(branch, block)
+	}
+	return ns.Reorganize(branch)
+}
+
+// Reorganize replaces the blocks after the fork point with branch if the
+// branch has more work. branch[0] must extend a block of the local chain.
+// Transactions of abandoned blocks that the branch doesn't include are
+// returned to the mempool.
+func (ns *NodeState) Reorganize(branch []Block) (consensus.ReorgInfo, error) {
+	ns.Lock()
+	defer ns.Unlock()
+	return ns.reorganize(branch)
+}
+
+// reorganize implements Reorganize (caller must hold lock)
+func (ns *NodeState) reorganize(branch []Block) (consensus.ReorgInfo, error) {
+	if len(branch) == 0 {
+		return consensus.ReorgInfo{}, fmt.Errorf("empty branch")
+	}
+
+	// Find the fork point
+	first := branch[0].Height
+	if first == 0 || first > ns.CurrentHeight+1 {
+		return consensus.ReorgInfo{}, fmt.Errorf("branch starting at height %d does not connect to local chain (tip %d)", first, ns.CurrentHeight)
+	}
+	forkHeight := first - 1
+	if branch[0].PrevHash != hashBlock(&ns.Chain[forkHeight]) {
+		return consensus.ReorgInfo{}, fmt.Errorf("branch does not fork from local block %d", forkHeight)
+	}
+
+	// Compare work before doing anything expensive. The work counted is
+	// that of the difficulty the rules expect, since the blocks' own claims
+	// aren't checked yet.
+	keep := min(first, uint64(ns.DifficultyParams.Window+1))
+	proposed := append(ns.Chain[first-keep:first:first], branch...)
+	branchWork := ns.Chain[forkHeight].CumulativeWork
+	for i := range branch {
+		if branch[i].Height != first+uint64(i) {
+			return consensus.ReorgInfo{}, fmt.Errorf("branch height discontinuity at %d", branch[i].Height)
+		}
+		branchWork = consensus.AddWork(branchWork, ns.expectedDifficulty(proposed[:keep+uint64(i)], &branch[i]))
+	}
+	tipWork := ns.Chain[len(ns.Chain)-1].CumulativeWork
+	needsReorg, _, err := ns.ReorgDetector.DetectReorg(tipWork, branchWork, forkHeight, ns.CurrentHeight)
+	if err != nil {
+		return consensus.ReorgInfo{}, err
+	}
+	if !needsReorg {
+		return consensus.ReorgInfo{}, fmt.Errorf("branch work %s does not exceed local work %s", branchWork, tipWork)
+	}
+
+	// Roll a copy of the state back to the fork point
+	state := ns.WorldState.Clone()
+	touched := make(map[string]bool)
+	for h := ns.CurrentHeight; h > forkHeight; h-- {
+		undo, ok := ns.UndoLog[h]
+		if !ok {
+			return consensus.ReorgInfo{}, fmt.Errorf("no undo data for block %d", h)
+		}
+		state.Revert(undo)
+		for addr := range undo.Accounts {
+			touched[addr] = true
+		}
+	}
+
+	// Validate and apply the branch on top of it
+	chain := make([]Block, forkHeight+1, forkHeight+1+uint64(len(branch)))
+	copy(chain, ns.Chain[:forkHeight+1])
+	branchUndo := make([]*ledger.BlockUndo, len(branch))
+	branchHashes := make([][32]byte, len(branch))
+	for i := range branch {
+		block := branch[i]
+		if err := ns.validateBlock(chain, &block); err != nil {
+			return consensus.ReorgInfo{}, &branchBlockError{block.Height, err}
+		}
+		undo := state.CaptureUndo(txAccounts(block.Txs))
+		next, err := ns.applyBlock(state, &block, false)
+		if err != nil {
+			return consensus.ReorgInfo{}, &branchBlockError{block.Height, err}
+		}
+		if err := ns.checkRoots(&chain[len(chain)-1], &block, next); err != nil {
+			return consensus.ReorgInfo{}, &branchBlockError{block.Height, err}
+		}
+		next.Commit()
+		for addr := range undo.Accounts {
+			touched[addr] = true
+		}
+		block.CumulativeWork = consensus.AddWork(chain[len(chain)-1].CumulativeWork, block.Difficulty)
+		chain = append(chain, block)
+		branchUndo[i] = undo
+		branchHashes[i] = hashBlock(&block)
+	}
+
+	oldTip := ns.CurrentHeight
+	newTip := chain[len(chain)-1].Height
+
+	// Commit to disk in a single batch
+	if ns.DB != nil {
+		err := ns.DB.Batch(func(b *storage.Batch) error {
+			// Abandoned blocks stay stored by hash as a side chain
+			for h := newTip + 1; h <= oldTip; h++ {
+				if err := b.DeleteBest(h); err != nil {
+					return err
+				}
+			}
+			for i, block := range chain[forkHeight+1:] {
+				if err := b.SaveBlock(branchHashes[i], blockIndexEntry(&block), block); err != nil {
+					return err
+				}
+				if err := b.SetBest(block.Height, branchHashes[i]); err != nil {
+					return err
+				}
+				if err := b.SaveUndo(branchHashes[i], branchUndo[i]); err != nil {
+					return err
+				}
+			}
+			for addr := range touched {
+				acct, ok := state.Accounts[addr]
+				if !ok {
+					if err := b.DeleteAccount(addr); err != nil {
+						return err
+					}
+					continue
+				}
+				if err := b.SaveAccount(addr, acct.Balance, acct.Nonce); err != nil {
+					return err
+				}
+			}
+			return b.SaveTipHeight(newTip)
+		})
+		if err != nil {
+			return consensus.ReorgInfo{}, fmt.Errorf("failed to persist reorg: %w", err)
+		}
+	}
+
+	// Swap in the new chain (the WorldState pointer is shared with RPC)
+	abandoned := ns.Chain[forkHeight+1:]
+	ns.Chain = chain
+	ns.WorldState.Accounts = state.Accounts
+	ns.CurrentHeight = newTip
+	for h := forkHeight + 1; h <= oldTip; h++ {
+		delete(ns.UndoLog, h)
+	}
+	for i, block := range branch {
+		ns.recordUndo(block.Height, branchUndo[i])
+	}
+	ns.updateDifficulty()
+	ns.resetChallenge()
+
+	// Move the best-chain pointer of the block tree to the new tip
+	parentHash := hashBlock(&chain[forkHeight])
+	for i, block := range branch {
+		node, err := ns.Tree.Add(branchHashes[i], parentHash, block.Difficulty)
+		if err != nil {
+			log.Printf("[reorg] Warning: failed to index block %d: %v", block.Height, err)
+			break
+		}
+		ns.Tree.SetBest(node)
+		parentHash = branchHashes[i]
+	}
+
+	// Return abandoned transactions the new branch doesn't include
+	included := make(map[string]bool)
+	for _, block := range branch {
+		for _, tx := range block.Txs {
+			included[fmt.Sprintf("%s/%d", tx.From, tx.Nonce)] = true
+		}
+	}
+	returned := 0
+	for _, block := range abandoned {
+		for _, tx := range block.Txs {
+			if tx.From == "coinbase" || included[fmt.Sprintf("%s/%d", tx.From, tx.Nonce)] {
+				continue
+			}
+			ns.Mempool.Add(tx)
+			returned++
+		}
+	}
+
+	metrics.UpdateTipHeight(ns.CurrentHeight)
+	metrics.UpdateDifficulty(ns.Consensus.DifficultyTarget)
+
+	info := consensus.CalculateReorgInfo(forkHeight, oldTip, newTip)
+	log.Printf("[reorg] Switched to branch at fork %d: removed %d blocks, added %d (tip %d -> %d), %d txs returned to mempool",
+		info.ForkHeight, info.BlocksRemoved, info.BlocksAdded, oldTip, newTip, returned)
+
+	return info, nil
+}
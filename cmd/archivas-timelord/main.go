@@ -15,6 +15,7 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/ArchivasNetwork/archivas/consensus"
 	"github.com/ArchivasNetwork/archivas/logging"
 	"github.com/ArchivasNetwork/archivas/metrics"
 	"github.com/ArchivasNetwork/archivas/vdf"
@@ -35,9 +36,10 @@ type ChainTipResponse struct {
 }
 
 type VDFUpdateRequest struct {
-	Seed       []byte `json:"seed"`
-	Iterations uint64 `json:"iterations"`
-	Output     []byte `json:"output"`
+	Seed        []byte   `json:"seed"`
+	Iterations  uint64   `json:"iterations"`
+	Output      []byte   `json:"output"`
+	Checkpoints [][]byte `json:"checkpoints"`
 }
 
 func main() {
@@ -46,10 +48,16 @@ func main() {
 	// Parse CLI flags
 	nodeURL := flag.String("node", "http://localhost:8080", "Node RPC URL")
 	stepSize := flag.Uint64("step", 500, "VDF iterations per tick")
+	token := flag.String("token", "", "Bearer token sent with VDF updates (the node's -timelord-token)")
 	// v1.1.1: Metrics server address (default: 0.0.0.0:9101)
 	metricsAddr := flag.String("metrics-addr", "0.0.0.0:9101", "Metrics server listen address")
 	flag.Parse()
 
+	// Checkpoints must split every published run into equal segments
+	if *stepSize == 0 || *stepSize%CheckpointStep != 0 {
+		log.Fatalf("[timelord] --step must be a positive multiple of %d", CheckpointStep)
+	}
+
 	log.Println("[timelord] Archivas Timelord starting...")
 	log.Printf("[timelord] Using node RPC base: %s", *nodeURL)
 	log.Printf("[timelord] Step size: %d iterations/tick", *stepSize)
@@ -66,6 +74,7 @@ func main() {
 	var currentSeed []byte
 	var currentIterations uint64
 	var currentOutput []byte
+	var currentCheckpoints [][]byte
 
 	ticker := time.NewTicker(TickInterval)
 	defer ticker.Stop()
@@ -109,17 +118,23 @@ func main() {
 			copy(currentOutput, currentSeed)
 		}
 
+		// Blocks can't record a longer run, so wait for the next tip
+		if currentIterations >= consensus.MaxChallengeIterations {
+			continue
+		}
+
 		// Advance VDF
-		newIterations := currentIterations + *stepSize
-		final, _ := vdf.ComputeSequential(currentSeed, newIterations, CheckpointStep)
+		newIterations := min(currentIterations+*stepSize, consensus.MaxChallengeIterations)
+		final, checkpoints := vdf.ComputeSequential(currentSeed, newIterations, CheckpointStep)
 
 		currentIterations = newIterations
 		currentOutput = final
+		currentCheckpoints = checkpoints
 
 		log.Printf("[timelord] seed=%x iter=%d output=%x", currentSeed[:8], currentIterations, currentOutput[:8])
 
 		// Send update to node
-		if err := sendVDFUpdate(*nodeURL, currentSeed, currentIterations, currentOutput); err != nil {
+		if err := sendVDFUpdate(*nodeURL, *token, currentSeed, currentIterations, currentOutput, currentCheckpoints); err != nil {
 			log.Printf("[timelord] ⚠️  Error sending VDF update: %v", err)
 		}
 	}
@@ -195,11 +210,12 @@ func computeSeed(blockHash [32]byte, height uint64) []byte {
 	return sum
 }
 
-func sendVDFUpdate(nodeURL string, seed []byte, iterations uint64, output []byte) error {
+func sendVDFUpdate(nodeURL, token string, seed []byte, iterations uint64, output []byte, checkpoints [][]byte) error {
 	update := VDFUpdateRequest{
-		Seed:       seed,
-		Iterations: iterations,
-		Output:     output,
+		Seed:        seed,
+		Iterations:  iterations,
+		Output:      output,
+		Checkpoints: checkpoints,
 	}
 
 	data, err := json.Marshal(update)
@@ -208,7 +224,15 @@ func sendVDFUpdate(nodeURL string, seed []byte, iterations uint64, output []byte
 	}
 
 	url := fmt.Sprintf("%s/vdf/update", nodeURL)
-	resp, err := http.Post(url, "application/json", bytes.NewReader(data))
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to POST to %s: %w", url, err)
 	}
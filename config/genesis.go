@@ -27,6 +27,24 @@ type GenesisDoc struct {
 	DifficultyParamsID string         `json:"difficultyParamsID"` // v1.1.1: difficulty params identifier
 	InitialDifficulty  uint64         `json:"initialDifficulty"`  // v1.1.1: starting difficulty
 	Allocations        []GenesisAlloc `json:"allocations"`
+
+	// Difficulty retargeting parameters (zero = consensus default)
+	TargetBlockTimeSeconds int64  `json:"targetBlockTimeSeconds,omitempty"`
+	DifficultyWindow       int    `json:"difficultyWindow,omitempty"`
+	MaxDifficultyAdjust    int64  `json:"maxDifficultyAdjust,omitempty"`
+	MinDifficulty          uint64 `json:"minDifficulty,omitempty"`
+	MaxDifficulty          uint64 `json:"maxDifficulty,omitempty"`
+
+	// Activation heights of consensus rules added after launch (unset = not
+	// scheduled, 0 = from genesis). They are part of the genesis hash, so
+	// nodes that disagree on when a rule activates refuse each other.
+	DifficultyActivationHeight *uint64 `json:"difficultyActivationHeight,omitempty"`
+	TimestampActivationHeight  *uint64 `json:"timestampActivationHeight,omitempty"`
+	ChallengeActivationHeight  *uint64 `json:"challengeActivationHeight,omitempty"`
+	FarmerSigActivationHeight  *uint64 `json:"farmerSigActivationHeight,omitempty"`
+	PlotV2ActivationHeight     *uint64 `json:"plotV2ActivationHeight,omitempty"`
+	BlockRootsActivationHeight *uint64 `json:"blockRootsActivationHeight,omitempty"`
+	StrictTxsActivationHeight  *uint64 `json:"strictTxsActivationHeight,omitempty"`
 }
 
 // LoadGenesis loads genesis from a JSON file
@@ -66,6 +84,21 @@ func HashGenesis(gen *GenesisDoc) [32]byte {
 		DifficultyParamsID string         `json:"difficultyParamsID"`
 		InitialDifficulty  uint64         `json:"initialDifficulty"`
 		Allocations        []GenesisAlloc `json:"allocations"`
+
+		// Omitted when unset so genesis documents without them keep their hash
+		TargetBlockTimeSeconds int64  `json:"targetBlockTimeSeconds,omitempty"`
+		DifficultyWindow       int    `json:"difficultyWindow,omitempty"`
+		MaxDifficultyAdjust    int64  `json:"maxDifficultyAdjust,omitempty"`
+		MinDifficulty          uint64 `json:"minDifficulty,omitempty"`
+		MaxDifficulty          uint64 `json:"maxDifficulty,omitempty"`
+
+		DifficultyActivationHeight *uint64 `json:"difficultyActivationHeight,omitempty"`
+		TimestampActivationHeight  *uint64 `json:"timestampActivationHeight,omitempty"`
+		ChallengeActivationHeight  *uint64 `json:"challengeActivationHeight,omitempty"`
+		FarmerSigActivationHeight  *uint64 `json:"farmerSigActivationHeight,omitempty"`
+		PlotV2ActivationHeight     *uint64 `json:"plotV2ActivationHeight,omitempty"`
+		BlockRootsActivationHeight *uint64 `json:"blockRootsActivationHeight,omitempty"`
+		StrictTxsActivationHeight  *uint64 `json:"strictTxsActivationHeight,omitempty"`
 	}{
 		ChainName:          gen.ChainName,
 		ChainID:            gen.ChainID,
@@ -78,6 +111,20 @@ func HashGenesis(gen *GenesisDoc) [32]byte {
 		DifficultyParamsID: gen.DifficultyParamsID,
 		InitialDifficulty:  gen.InitialDifficulty,
 		Allocations:        sortedAllocs,
+
+		TargetBlockTimeSeconds: gen.TargetBlockTimeSeconds,
+		DifficultyWindow:       gen.DifficultyWindow,
+		MaxDifficultyAdjust:    gen.MaxDifficultyAdjust,
+		MinDifficulty:          gen.MinDifficulty,
+		MaxDifficulty:          gen.MaxDifficulty,
+
+		DifficultyActivationHeight: gen.DifficultyActivationHeight,
+		TimestampActivationHeight:  gen.TimestampActivationHeight,
+		ChallengeActivationHeight:  gen.ChallengeActivationHeight,
+		FarmerSigActivationHeight:  gen.FarmerSigActivationHeight,
+		PlotV2ActivationHeight:     gen.PlotV2ActivationHeight,
+		BlockRootsActivationHeight: gen.BlockRootsActivationHeight,
+		StrictTxsActivationHeight:  gen.StrictTxsActivationHeight,
 	}
 
 	data, _ := json.Marshal(canonical)
@@ -0,0 +1,295 @@
+package consensus
+
+import (
+	"errors"
+	"math/big"
+	"time"
+)
+
+// Block tree
+//
+// Every block the node knows about is a node in a tree rooted at genesis,
+// linked to its parent by hash, so several blocks can compete at the same
+// height. The best chain is the path from genesis to the tip with the most
+// cumulative work and is tracked by a pointer separate from the tree. Blocks
+// whose parent is not known yet wait in an OrphanPool.
+
+// ErrUnknownParent is returned when a block's parent is not in the tree
+var ErrUnknownParent = errors.New("unknown parent block")
+
+// BlockNode is a block's position in the block tree
+type BlockNode struct {
+	Hash       [32]byte
+	Parent     *BlockNode // nil for genesis
+	Height     uint64
+	Difficulty uint64
+	Work       *big.Int // Cumulative work from genesis to this block
+}
+
+// Ancestor returns the ancestor of n at height, or nil if height is above n
+func (n *BlockNode) Ancestor(height uint64) *BlockNode {
+	if height > n.Height {
+		return nil
+	}
+	for n != nil && n.Height > height {
+		n = n.Parent
+	}
+	return n
+}
+
+// BlockTree indexes known blocks by hash and by height
+type BlockTree struct {
+	nodes    map[[32]byte]*BlockNode
+	byHeight map[uint64][]*BlockNode
+	best     *BlockNode
+}
+
+// NewBlockTree creates a tree holding only the genesis block, which is also the best tip
+func NewBlockTree(genesisHash [32]byte, genesisDifficulty uint64) *BlockTree {
+	root := &BlockNode{
+		Hash:       genesisHash,
+		Difficulty: genesisDifficulty,
+		Work:       AddWork(nil, genesisDifficulty),
+	}
+	return &BlockTree{
+		nodes:    map[[32]byte]*BlockNode{genesisHash: root},
+		byHeight: map[uint64][]*BlockNode{0: {root}},
+		best:     root,
+	}
+}
+
+// Add inserts a block whose parent is already in the tree. Adding a known
+// block returns its existing node. The best tip is not changed.
+func (t *BlockTree) Add(hash, parent [32]byte, difficulty uint64) (*BlockNode, error) {
+	if n, ok := t.nodes[hash]; ok {
+		return n, nil
+	}
+	p, ok := t.nodes[parent]
+	if !ok {
+		return nil, ErrUnknownParent
+	}
+	n := &BlockNode{
+		Hash:       hash,
+		Parent:     p,
+		Height:     p.Height + 1,
+		Difficulty: difficulty,
+		Work:       AddWork(p.Work, difficulty),
+	}
+	t.nodes[hash] = n
+	t.byHeight[n.Height] = append(t.byHeight[n.Height], n)
+	return n, nil
+}
+
+// Get returns the node of a block, or nil if it is unknown
+func (t *BlockTree) Get(hash [32]byte) *BlockNode {
+	return t.nodes[hash]
+}
+
+// Candidates returns every known block at height
+func (t *BlockTree) Candidates(height uint64) []*BlockNode {
+	return t.byHeight[height]
+}
+
+// Best returns the tip of the best chain
+func (t *BlockTree) Best() *BlockNode {
+	return t.best
+}
+
+// SetBest moves the best-chain pointer to n
+func (t *BlockTree) SetBest(n *BlockNode) {
+	t.best = n
+}
+
+// OnBestChain reports whether n is an ancestor of (or is) the best tip
+func (t *BlockTree) OnBestChain(n *BlockNode) bool {
+	return t.best.Ancestor(n.Height) == n
+}
+
+// Len returns the number of blocks in the tree
+func (t *BlockTree) Len() int {
+	return len(t.nodes)
+}
+
+// FindFork returns the most recent common ancestor of a and b
+func FindFork(a, b *BlockNode) *BlockNode {
+	if a.Height > b.Height {
+		a = a.Ancestor(b.Height)
+	} else {
+		b = b.Ancestor(a.Height)
+	}
+	for a != b {
+		a, b = a.Parent, b.Parent
+	}
+	return a
+}
+
+// Branch returns the nodes after ancestor up to and including tip, oldest first
+func Branch(ancestor, tip *BlockNode) []*BlockNode {
+	branch := make([]*BlockNode, tip.Height-ancestor.Height)
+	for n := tip; n != ancestor; n = n.Parent {
+		branch[n.Height-ancestor.Height-1] = n
+	}
+	return branch
+}
+
+// Prune drops blocks below height that are not on the best chain, along
+// with their descendants. Those branches are too deep to reorg to.
+func (t *BlockTree) Prune(height uint64) int {
+	removed := 0
+	for h := range t.byHeight {
+		if h >= height {
+			continue
+		}
+		nodes := append([]*BlockNode(nil), t.byHeight[h]...)
+		for _, n := range nodes {
+			if t.nodes[n.Hash] == n && !t.OnBestChain(n) {
+				removed += t.removeSubtree(n)
+			}
+		}
+	}
+	return removed
+}
+
+// Remove deletes a side-chain block n and every block descending from it,
+// returning how many were removed. Blocks on the best chain are kept.
+func (t *BlockTree) Remove(n *BlockNode) int {
+	if t.nodes[n.Hash] != n || t.OnBestChain(n) {
+		return 0
+	}
+	return t.removeSubtree(n)
+}
+
+// removeSubtree deletes n and every block descending from it
+func (t *BlockTree) removeSubtree(root *BlockNode) int {
+	removed := 0
+	for h := root.Height; ; h++ {
+		nodes, ok := t.byHeight[h]
+		if !ok {
+			break
+		}
+		kept := nodes[:0]
+		for _, n := range nodes {
+			if n.Ancestor(root.Height) == root {
+				delete(t.nodes, n.Hash)
+				removed++
+			} else {
+				kept = append(kept, n)
+			}
+		}
+		if len(kept) == 0 {
+			delete(t.byHeight, h)
+		} else {
+			t.byHeight[h] = kept
+		}
+	}
+	return removed
+}
+
+// Orphan is a block received before its parent
+type Orphan struct {
+	Hash   [32]byte
+	Parent [32]byte
+	Data   []byte // Raw block, decoded once the parent arrives
+	added  time.Time
+}
+
+// OrphanPool holds blocks whose parent is unknown. It keeps at most MaxSize
+// blocks, evicting the oldest first, and drops blocks older than TTL.
+type OrphanPool struct {
+	MaxSize int
+	TTL     time.Duration
+
+	orphans  map[[32]byte]*Orphan
+	byParent map[[32]byte][][32]byte
+	order    [][32]byte // Insertion order, may hold hashes already removed
+}
+
+// NewOrphanPool creates an empty orphan pool
+func NewOrphanPool(maxSize int, ttl time.Duration) *OrphanPool {
+	return &OrphanPool{
+		MaxSize:  maxSize,
+		TTL:      ttl,
+		orphans:  make(map[[32]byte]*Orphan),
+		byParent: make(map[[32]byte][][32]byte),
+	}
+}
+
+// Add stores an orphan block, evicting old ones if the pool is full.
+// It returns false if the block was already in the pool.
+func (p *OrphanPool) Add(hash, parent [32]byte, data []byte) bool {
+	if _, ok := p.orphans[hash]; ok {
+		return false
+	}
+	p.orphans[hash] = &Orphan{Hash: hash, Parent: parent, Data: data, added: time.Now()}
+	p.byParent[parent] = append(p.byParent[parent], hash)
+	p.order = append(p.order, hash)
+	p.evict(time.Now())
+	return true
+}
+
+// Has reports whether a block is in the pool
+func (p *OrphanPool) Has(hash [32]byte) bool {
+	_, ok := p.orphans[hash]
+	return ok
+}
+
+// Len returns the number of orphans in the pool
+func (p *OrphanPool) Len() int {
+	return len(p.orphans)
+}
+
+// TakeChildren removes and returns the orphans whose parent is hash
+func (p *OrphanPool) TakeChildren(parent [32]byte) []*Orphan {
+	var children []*Orphan
+	for _, hash := range p.byParent[parent] {
+		if o, ok := p.orphans[hash]; ok {
+			children = append(children, o)
+			delete(p.orphans, hash)
+		}
+	}
+	delete(p.byParent, parent)
+	return children
+}
+
+// evict drops expired orphans, then the oldest ones until the pool fits MaxSize
+func (p *OrphanPool) evict(now time.Time) {
+	for len(p.order) > 0 {
+		hash := p.order[0]
+		o, ok := p.orphans[hash]
+		if ok && len(p.orphans) <= p.MaxSize && now.Sub(o.added) < p.TTL {
+			break
+		}
+		p.order = p.order[1:]
+		if ok {
+			p.remove(o)
+		}
+	}
+
+	// Compact when hashes taken by TakeChildren pile up
+	if len(p.order) > 2*p.MaxSize {
+		live := make([][32]byte, 0, len(p.orphans))
+		for _, hash := range p.order {
+			if _, ok := p.orphans[hash]; ok {
+				live = append(live, hash)
+			}
+		}
+		p.order = live
+	}
+}
+
+// remove deletes an orphan and its parent link
+func (p *OrphanPool) remove(o *Orphan) {
+	delete(p.orphans, o.Hash)
+	siblings := p.byParent[o.Parent]
+	for i, hash := range siblings {
+		if hash == o.Hash {
+			siblings = append(siblings[:i], siblings[i+1:]...)
+			break
+		}
+	}
+	if len(siblings) == 0 {
+		delete(p.byParent, o.Parent)
+	} else {
+		p.byParent[o.Parent] = siblings
+	}
+}
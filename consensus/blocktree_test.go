@@ -0,0 +1,100 @@
+package consensus
+
+import (
+	"testing"
+	"time"
+)
+
+func testHash(b byte) [32]byte {
+	return [32]byte{b}
+}
+
+func TestBlockTree(t *testing.T) {
+	tree := NewBlockTree(testHash(0), 2_000_000)
+
+	// 0 - 1 - 2 - 3 is the best chain, 1 - 4 - 5 a side branch with harder blocks
+	for _, b := range []struct {
+		hash, parent byte
+		difficulty   uint64
+	}{
+		{1, 0, 2_000_000},
+		{2, 1, 2_000_000},
+		{3, 2, 2_000_000},
+		{4, 1, 1_000_000},
+		{5, 4, 1_000_000},
+	} {
+		if _, err := tree.Add(testHash(b.hash), testHash(b.parent), b.difficulty); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := tree.Add(testHash(9), testHash(8), 1); err != ErrUnknownParent {
+		t.Fatalf("expected ErrUnknownParent, got %v", err)
+	}
+	tree.SetBest(tree.Get(testHash(3)))
+
+	if n := len(tree.Candidates(2)); n != 2 {
+		t.Fatalf("expected 2 candidates at height 2, got %d", n)
+	}
+
+	side := tree.Get(testHash(5))
+	if !CompareChains(side.Work, tree.Best().Work) {
+		t.Fatal("expected the shorter branch of harder blocks to have more work")
+	}
+	fork := FindFork(tree.Best(), side)
+	if fork.Hash != testHash(1) {
+		t.Fatalf("unexpected fork point %x", fork.Hash[:1])
+	}
+	branch := Branch(fork, side)
+	if len(branch) != 2 || branch[0].Hash != testHash(4) || branch[1] != side {
+		t.Fatal("unexpected branch")
+	}
+
+	// Removing an invalid side block takes its descendants with it
+	if removed := tree.Remove(tree.Get(testHash(2))); removed != 0 {
+		t.Fatalf("removed %d blocks of the best chain", removed)
+	}
+	if removed := tree.Remove(side); removed != 1 || tree.Get(testHash(5)) != nil {
+		t.Fatalf("expected side block 5 removed, got %d", removed)
+	}
+	if _, err := tree.Add(testHash(5), testHash(4), 1_000_000); err != nil {
+		t.Fatal(err)
+	}
+
+	// Pruning above the fork drops the side branch but never the best chain
+	if removed := tree.Prune(3); removed != 2 {
+		t.Fatalf("expected 2 pruned blocks, got %d", removed)
+	}
+	if tree.Get(testHash(5)) != nil || tree.Len() != 4 {
+		t.Fatal("side branch survived pruning")
+	}
+}
+
+func TestOrphanPool(t *testing.T) {
+	pool := NewOrphanPool(2, time.Hour)
+
+	pool.Add(testHash(1), testHash(0), nil)
+	pool.Add(testHash(2), testHash(0), nil)
+	if pool.Add(testHash(2), testHash(0), nil) {
+		t.Fatal("duplicate orphan accepted")
+	}
+	pool.Add(testHash(3), testHash(9), nil)
+
+	// The oldest orphan is evicted once the pool is full
+	if pool.Len() != 2 || pool.Has(testHash(1)) {
+		t.Fatal("expected oldest orphan to be evicted")
+	}
+	children := pool.TakeChildren(testHash(0))
+	if len(children) != 1 || children[0].Hash != testHash(2) {
+		t.Fatal("unexpected children")
+	}
+	if pool.Len() != 1 {
+		t.Fatal("children were not removed")
+	}
+
+	// Expired orphans are dropped
+	pool.TTL = 0
+	pool.Add(testHash(4), testHash(9), nil)
+	if pool.Len() != 0 {
+		t.Fatalf("expected expired orphans to be dropped, %d left", pool.Len())
+	}
+}
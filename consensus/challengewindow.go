@@ -0,0 +1,229 @@
+package consensus
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/ArchivasNetwork/archivas/vdf"
+)
+
+// Challenge window
+//
+// A proof must answer a challenge the node handed out, not one the farmer
+// picked. The challenges for a height are the one derived from the parent
+// block plus those derived from the last WindowSize outputs of the VDF the
+// timelord runs from the parent. Farmers that found a proof for a slightly
+// older VDF output still win, and the VDF outputs are recorded in the block
+// so peers can recompute the same set. The block also records checkpoints
+// splitting the VDF run into equal segments, which peers verify in
+// parallel, and no more iterations than MaxVDFRate allows in the time since
+// the parent, up to MaxChallengeIterations whatever the time. Block
+// timestamps are picked by their farmer, so only the absolute cap bounds
+// the work a block can demand of its verifiers.
+
+// ChallengeWindowSize is how many VDF-derived challenges a proof may answer
+const ChallengeWindowSize = 8
+
+// MaxVDFRate is the most VDF iterations per second a timelord may claim. It
+// bounds the work of verifying VDF outputs while leaving room for timelords
+// far faster than the reference one (500 per second).
+const MaxVDFRate = 50000
+
+// MaxChallengeIterations is the most VDF iterations a block may record. The
+// VDF stops advancing the window there until the next block.
+const MaxChallengeIterations = 5_000_000
+
+// vdfRateSlack is the clock skew and propagation delay, in seconds, allowed
+// on top of the elapsed time when bounding VDF iterations
+const vdfRateSlack = 5
+
+// MaxVDFIterations returns the most VDF iterations that can have been run
+// in the given number of seconds, capped at MaxChallengeIterations
+func MaxVDFIterations(seconds int64) uint64 {
+	seconds = max(seconds, 0)
+	if seconds > MaxChallengeIterations/MaxVDFRate {
+		return MaxChallengeIterations
+	}
+	return min(uint64(seconds+vdfRateSlack)*MaxVDFRate, MaxChallengeIterations)
+}
+
+// ChallengeParams are the parameters of the challenge window rule
+type ChallengeParams struct {
+	WindowSize       int    // VDF-derived challenges accepted besides the parent's
+	ActivationHeight uint64 // First height whose challenge is checked
+}
+
+// DefaultChallengeParams returns the challenge rule with the default window
+func DefaultChallengeParams() ChallengeParams {
+	return ChallengeParams{WindowSize: ChallengeWindowSize}
+}
+
+// VDFPoint is an output of the VDF after some number of iterations
+type VDFPoint struct {
+	Iterations uint64
+	Output     []byte
+}
+
+// VDFSeed returns the seed of the VDF run on top of the block tipHash at tipHeight
+func VDFSeed(tipHash [32]byte, tipHeight uint64) []byte {
+	h := sha256.New()
+	h.Write(tipHash[:])
+	binary.Write(h, binary.BigEndian, tipHeight)
+	return h.Sum(nil)
+}
+
+// VDFChallenge derives the challenge for height from a VDF output
+func VDFChallenge(output []byte, height uint64) [32]byte {
+	h := sha256.New()
+	h.Write(output)
+	binary.Write(h, binary.BigEndian, height)
+	return sha256.Sum256(h.Sum(nil))
+}
+
+// ChallengeWindow holds the challenges a proof for one height may answer
+type ChallengeWindow struct {
+	Height uint64
+	Base   [32]byte   // Challenge derived from the parent block
+	Points []VDFPoint // Most recent VDF outputs, oldest first
+	size   int
+}
+
+// NewChallengeWindow creates the window for the block after parentHash,
+// holding only the parent's challenge
+func NewChallengeWindow(parentHash [32]byte, height uint64, size int) *ChallengeWindow {
+	return &ChallengeWindow{
+		Height: height,
+		Base:   GenerateChallenge(parentHash, height),
+		size:   size,
+	}
+}
+
+// Add records a new VDF output, dropping the oldest once the window is
+// full. Outputs that don't advance the VDF are ignored.
+func (w *ChallengeWindow) Add(p VDFPoint) bool {
+	if n := len(w.Points); n > 0 && p.Iterations <= w.Points[n-1].Iterations {
+		return false
+	}
+	w.Points = append(w.Points, p)
+	if len(w.Points) > w.size {
+		w.Points = append([]VDFPoint(nil), w.Points[len(w.Points)-w.size:]...)
+	}
+	return true
+}
+
+// Latest returns the challenge farmers should currently answer
+func (w *ChallengeWindow) Latest() [32]byte {
+	if n := len(w.Points); n > 0 {
+		return VDFChallenge(w.Points[n-1].Output, w.Height)
+	}
+	return w.Base
+}
+
+// Contains reports whether challenge is in the window
+func (w *ChallengeWindow) Contains(challenge [32]byte) bool {
+	return windowContains(w.Base, w.Points, w.Height, challenge)
+}
+
+// CheckChallenge verifies that the challenge of a block at height, child of
+// parentHash and elapsed seconds after it, is in the window described by
+// points, and that points are genuine outputs of the VDF seeded from the
+// parent, as proven by checkpoints
+func CheckChallenge(parentHash [32]byte, height uint64, elapsed int64, challenge [32]byte, points []VDFPoint, checkpoints [][]byte, params ChallengeParams) error {
+	if err := CheckChallengeWindow(parentHash, height, elapsed, challenge, points, checkpoints, params); err != nil {
+		return err
+	}
+	if height < params.ActivationHeight {
+		return nil
+	}
+	return VerifyChallengeVDF(parentHash, height, points, checkpoints)
+}
+
+// CheckChallengeWindow is CheckChallenge without verifying the VDF run
+// itself: only that points fall on checkpoints and don't claim more
+// iterations than possible
+func CheckChallengeWindow(parentHash [32]byte, height uint64, elapsed int64, challenge [32]byte, points []VDFPoint, checkpoints [][]byte, params ChallengeParams) error {
+	if height < params.ActivationHeight {
+		return nil
+	}
+	if len(points) > params.WindowSize {
+		return fmt.Errorf("block %d records %d VDF outputs (max %d)", height, len(points), params.WindowSize)
+	}
+	if n := len(points); n > 0 && points[n-1].Iterations > MaxVDFIterations(elapsed) {
+		return fmt.Errorf("block %d records %d VDF iterations, at most %d possible %ds after its parent", height, points[n-1].Iterations, MaxVDFIterations(elapsed), elapsed)
+	}
+	if !windowContains(GenerateChallenge(parentHash, height), points, height, challenge) {
+		return fmt.Errorf("block %d challenge %x is not in its challenge window", height, challenge[:8])
+	}
+	if !vdfPointsCovered(points, checkpoints) {
+		return fmt.Errorf("block %d records invalid VDF outputs", height)
+	}
+	return nil
+}
+
+// VerifyChallengeVDF verifies that points recorded by the block at height,
+// child of parentHash, are outputs of the VDF seeded from the parent, by
+// recomputing the checkpoint segments in parallel. It is the expensive part
+// of CheckChallenge.
+func VerifyChallengeVDF(parentHash [32]byte, height uint64, points []VDFPoint, checkpoints [][]byte) error {
+	if len(points) == 0 {
+		return nil
+	}
+	last := points[len(points)-1]
+	if !vdf.VerifyWithCheckpoints(VDFSeed(parentHash, height-1), last.Iterations, checkpoints, last.Output) {
+		return fmt.Errorf("block %d records invalid VDF outputs", height)
+	}
+	return nil
+}
+
+// windowContains reports whether challenge is base or derived from one of points
+func windowContains(base [32]byte, points []VDFPoint, height uint64, challenge [32]byte) bool {
+	if challenge == base {
+		return true
+	}
+	for _, p := range points {
+		if VDFChallenge(p.Output, height) == challenge {
+			return true
+		}
+	}
+	return false
+}
+
+// vdfPointsCovered checks that every point is one of the checkpoints of the
+// VDF run up to the last point
+func vdfPointsCovered(points []VDFPoint, checkpoints [][]byte) bool {
+	if len(points) == 0 {
+		return len(checkpoints) == 0
+	}
+	last := points[len(points)-1]
+	if !CheckpointsCover(points, last.Iterations, checkpoints) {
+		return false
+	}
+	step := last.Iterations / uint64(len(checkpoints))
+	for i, p := range points {
+		if i > 0 && p.Iterations <= points[i-1].Iterations {
+			return false // Iterations must strictly increase
+		}
+		if !bytes.Equal(checkpoints[p.Iterations/step-1], p.Output) {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckpointsCover reports whether checkpoints splitting a VDF run of
+// iterations into equal segments fall on every point
+func CheckpointsCover(points []VDFPoint, iterations uint64, checkpoints [][]byte) bool {
+	n := uint64(len(checkpoints))
+	if n == 0 || n > iterations || iterations%n != 0 {
+		return false
+	}
+	step := iterations / n
+	for _, p := range points {
+		if p.Iterations == 0 || p.Iterations > iterations || p.Iterations%step != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,88 @@
+package consensus
+
+import (
+	"testing"
+
+	"github.com/ArchivasNetwork/archivas/vdf"
+)
+
+func TestChallengeWindow(t *testing.T) {
+	params := ChallengeParams{WindowSize: 2}
+	parent := testHash(7)
+	seed := VDFSeed(parent, 9)
+
+	w := NewChallengeWindow(parent, 10, params.WindowSize)
+	if w.Latest() != GenerateChallenge(parent, 10) {
+		t.Fatal("expected the parent challenge before any VDF output")
+	}
+	for _, iters := range []uint64{100, 200, 300} {
+		out, _ := vdf.ComputeSequential(seed, iters, 0)
+		if !w.Add(VDFPoint{Iterations: iters, Output: out}) {
+			t.Fatalf("VDF output at %d iterations rejected", iters)
+		}
+	}
+	if w.Add(VDFPoint{Iterations: 300}) {
+		t.Fatal("expected an output that doesn't advance the VDF to be ignored")
+	}
+
+	// The window keeps the parent challenge and the last two VDF challenges
+	_, checkpoints := vdf.ComputeSequential(seed, 300, 100)
+	dropped, _ := vdf.ComputeSequential(seed, 100, 0)
+	if len(w.Points) != 2 || w.Contains(VDFChallenge(dropped, 10)) {
+		t.Fatal("expected the oldest VDF output to be dropped")
+	}
+	for _, c := range [][32]byte{w.Base, VDFChallenge(w.Points[0].Output, 10), w.Latest()} {
+		if !w.Contains(c) {
+			t.Fatalf("expected challenge %x in window", c[:4])
+		}
+		if err := CheckChallenge(parent, 10, 20, c, w.Points, checkpoints, params); err != nil {
+			t.Fatalf("expected recorded window to verify: %v", err)
+		}
+	}
+
+	// Farmer-chosen challenges and forged VDF outputs are rejected
+	if err := CheckChallenge(parent, 10, 20, testHash(1), w.Points, checkpoints, params); err == nil {
+		t.Fatal("expected challenge outside the window to be rejected")
+	}
+	forged := []VDFPoint{{Iterations: 400, Output: make([]byte, 32)}}
+	forgedCheckpoints := [][]byte{forged[0].Output}
+	if err := CheckChallenge(parent, 10, 20, VDFChallenge(forged[0].Output, 10), forged, forgedCheckpoints, params); err == nil {
+		t.Fatal("expected forged VDF output to be rejected")
+	}
+	if err := CheckChallenge(testHash(8), 10, 20, w.Latest(), w.Points, checkpoints, params); err == nil {
+		t.Fatal("expected VDF outputs from another parent to be rejected")
+	}
+	tooMany := append(append([]VDFPoint(nil), w.Points...), VDFPoint{Iterations: 400})
+	if err := CheckChallenge(parent, 10, 20, w.Base, tooMany, checkpoints, params); err == nil {
+		t.Fatal("expected oversized window to be rejected")
+	}
+
+	// Outputs need checkpoints that fall on them, and no more iterations
+	// than could have run since the parent
+	if err := CheckChallenge(parent, 10, 20, w.Latest(), w.Points, nil, params); err == nil {
+		t.Fatal("expected VDF outputs without checkpoints to be rejected")
+	}
+	if err := CheckChallenge(parent, 10, 20, w.Latest(), w.Points, checkpoints[2:], params); err == nil {
+		t.Fatal("expected checkpoints missing a VDF output to be rejected")
+	}
+	huge := []VDFPoint{{Iterations: 1 << 62, Output: make([]byte, 32)}}
+	if err := CheckChallenge(parent, 10, 20, w.Base, huge, [][]byte{huge[0].Output}, params); err == nil {
+		t.Fatal("expected VDF iterations beyond MaxVDFRate to be rejected")
+	}
+
+	// However long since the parent, a block can't demand more than
+	// MaxChallengeIterations of verification
+	if got := MaxVDFIterations(1 << 40); got != MaxChallengeIterations {
+		t.Fatalf("expected iterations capped at %d, got %d", MaxChallengeIterations, got)
+	}
+	capped := []VDFPoint{{Iterations: MaxChallengeIterations + 1, Output: make([]byte, 32)}}
+	if err := CheckChallengeWindow(parent, 10, 1<<40, w.Base, capped, [][]byte{capped[0].Output}, params); err == nil {
+		t.Fatal("expected VDF iterations beyond MaxChallengeIterations to be rejected")
+	}
+
+	// Blocks below the activation height are not checked
+	params.ActivationHeight = 100
+	if err := CheckChallenge(parent, 10, 20, testHash(1), nil, nil, params); err != nil {
+		t.Fatalf("expected unchecked challenge before activation: %v", err)
+	}
+}
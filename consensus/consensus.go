@@ -2,7 +2,6 @@ package consensus
 
 import (
 	"fmt"
-	"time"
 
 	"github.com/ArchivasNetwork/archivas/pospace"
 )
@@ -10,7 +9,6 @@ import (
 // Consensus implements the Archivas consensus protocol
 type Consensus struct {
 	DifficultyTarget uint64
-	TargetBlockTime  time.Duration
 }
 
 const (
@@ -23,7 +21,6 @@ const (
 func NewConsensus() *Consensus {
 	return &Consensus{
 		DifficultyTarget: InitialDifficulty,
-		TargetBlockTime:  25 * time.Second, // v1.0.0: 25s target for stability
 	}
 }
 
@@ -37,37 +34,28 @@ func (c *Consensus) VerifyProofOfSpace(proof *pospace.Proof, challenge [32]byte)
 	return nil
 }
 
-// UpdateDifficulty updates the difficulty based on actual vs target block time
-// Uses inverted proportional control with damping
-func (c *Consensus) UpdateDifficulty(actualBlockTime time.Duration) {
-	target := c.TargetBlockTime.Seconds()
-	actual := actualBlockTime.Seconds()
-
-	if actual == 0 || actual < 0.1 {
-		return
+// RequiredPlotVersion returns the minimum plot format accepted at a given height
+func RequiredPlotVersion(height uint64, upgrades Upgrades) uint32 {
+	if height >= upgrades.PlotV2 {
+		return pospace.PlotVersion
 	}
+	return pospace.PlotVersionV1
+}
 
-	// Inverted: scale = target / observed
-	// If blocks too fast (2s vs 20s target), scale = 10 (harder!)
-	scale := target / actual
-
-	// Damping factor (alpha = 0.5)
-	alpha := 0.5
-	adjustedScale := 1.0 + alpha*(scale-1.0)
-
-	// Apply to difficulty
-	newDiff := uint64(float64(c.DifficultyTarget) * adjustedScale)
-
-	// Clamp to domain [1e8, 1e12]
-	minDiff := uint64(100_000_000)       // 100M
-	maxDiff := uint64(1_000_000_000_000) // 1T (QMAX)
-
-	if newDiff < minDiff {
-		newDiff = minDiff
+// MinPlotKSize is the smallest k accepted from the plot format activation.
+// Smaller plots are cheap enough to rebuild for every challenge, which
+// would let a farmer win without storing anything.
+const MinPlotKSize = 18
+
+// CheckPlotVersion rejects proofs from a plot format or size that is no
+// longer valid at height
+func CheckPlotVersion(proof *pospace.Proof, height uint64, upgrades Upgrades) error {
+	required := RequiredPlotVersion(height, upgrades)
+	if proof.FormatVersion() < required {
+		return fmt.Errorf("plot version %d not accepted at height %d (requires v%d)", proof.FormatVersion(), height, required)
 	}
-	if newDiff > maxDiff {
-		newDiff = maxDiff
+	if height >= upgrades.PlotV2 && proof.KSize < MinPlotKSize {
+		return fmt.Errorf("plot k=%d not accepted at height %d (requires k>=%d)", proof.KSize, height, MinPlotKSize)
 	}
-
-	c.DifficultyTarget = newDiff
+	return nil
 }
@@ -1,65 +1,85 @@
 package consensus
 
 import (
-	"time"
+	"fmt"
+	"math/big"
+
+	"github.com/ArchivasNetwork/archivas/config"
+	"github.com/ArchivasNetwork/archivas/pospace"
 )
 
-// SmoothedDifficulty calculates difficulty using 10-block moving average
-func SmoothedDifficulty(recentBlocks []BlockInfo, targetBlockTime time.Duration, initialDifficulty uint64) uint64 {
-	if len(recentBlocks) < 2 {
-		return initialDifficulty
-	}
-	
-	// Use last 10 blocks for smoothing
-	window := 10
-	if len(recentBlocks) < window {
-		window = len(recentBlocks)
-	}
-	
-	blocks := recentBlocks[len(recentBlocks)-window:]
-	
-	// Calculate actual average time between blocks
-	totalTime := int64(0)
-	for i := 1; i < len(blocks); i++ {
-		timeDiff := blocks[i].Timestamp - blocks[i-1].Timestamp
-		totalTime += timeDiff
-	}
-	
-	avgTime := totalTime / int64(len(blocks)-1)
-	targetSec := int64(targetBlockTime.Seconds())
-	
-	if avgTime == 0 {
-		return initialDifficulty
-	}
-	
-	// Get last difficulty
-	lastDiff := blocks[len(blocks)-1].Difficulty
-	
-	// Adjust: if blocks too fast, increase difficulty; if too slow, decrease
-	// ratio = targetTime / actualTime
-	// newDiff = oldDiff * ratio
-	
-	ratio := float64(targetSec) / float64(avgTime)
-	newDiff := uint64(float64(lastDiff) * ratio)
-	
-	// Limit adjustment to 2x per window to prevent wild swings
-	maxIncrease := lastDiff * 2
-	maxDecrease := lastDiff / 2
-	
-	if newDiff > maxIncrease {
-		newDiff = maxIncrease
-	}
-	if newDiff < maxDecrease {
-		newDiff = maxDecrease
-	}
-	
-	// Ensure minimum difficulty
-	minDiff := uint64(1000000)
-	if newDiff < minDiff {
-		newDiff = minDiff
-	}
-	
-	return newDiff
+// Difficulty retargeting
+//
+// The difficulty of a block is a pure function of its parent headers: the
+// average difficulty of the last Window blocks, scaled by how long those
+// blocks actually took versus TargetBlockTime. Since a proof wins when its
+// quality is <= difficulty, slow blocks raise the difficulty (easier) and
+// fast blocks lower it (harder). Only integer arithmetic is used so every
+// node computes the same value.
+
+// DifficultyParams are the parameters of the difficulty rule, fixed by genesis
+type DifficultyParams struct {
+	InitialDifficulty uint64 `json:"initialDifficulty"` // Difficulty until enough blocks exist to retarget
+	TargetBlockTime   int64  `json:"targetBlockTime"`   // Target seconds between blocks
+	Window            int    `json:"window"`            // Number of parent blocks averaged
+	MaxAdjustFactor   int64  `json:"maxAdjustFactor"`   // Max factor the window timespan can move difficulty by
+	MinDifficulty     uint64 `json:"minDifficulty"`     // Floor (hardest)
+	MaxDifficulty     uint64 `json:"maxDifficulty"`     // Ceiling (easiest)
+	ActivationHeight  uint64 `json:"activationHeight"`  // First height whose difficulty is enforced
+}
+
+// DefaultDifficultyParams returns the parameters used when genesis doesn't override them
+func DefaultDifficultyParams() DifficultyParams {
+	return DifficultyParams{
+		InitialDifficulty: InitialDifficulty,
+		TargetBlockTime:   config.TargetBlockTimeSeconds,
+		Window:            30,
+		MaxAdjustFactor:   4,
+		MinDifficulty:     1_000_000,
+		MaxDifficulty:     pospace.QMAX,
+	}
+}
+
+// GenesisDifficultyParams returns the difficulty parameters of a genesis document
+func GenesisDifficultyParams(gen *config.GenesisDoc) DifficultyParams {
+	params := DefaultDifficultyParams()
+	if gen.InitialDifficulty != 0 {
+		params.InitialDifficulty = gen.InitialDifficulty
+	}
+	if gen.TargetBlockTimeSeconds != 0 {
+		params.TargetBlockTime = gen.TargetBlockTimeSeconds
+	}
+	if gen.DifficultyWindow != 0 {
+		params.Window = gen.DifficultyWindow
+	}
+	if gen.MaxDifficultyAdjust != 0 {
+		params.MaxAdjustFactor = gen.MaxDifficultyAdjust
+	}
+	if gen.MinDifficulty != 0 {
+		params.MinDifficulty = gen.MinDifficulty
+	}
+	if gen.MaxDifficulty != 0 {
+		params.MaxDifficulty = gen.MaxDifficulty
+	}
+	params.ActivationHeight = activationHeight(gen.DifficultyActivationHeight)
+	return params
+}
+
+// Validate checks that the parameters can be used by NextDifficulty
+func (p DifficultyParams) Validate() error {
+	switch {
+	case p.TargetBlockTime <= 0:
+		return fmt.Errorf("target block time must be positive")
+	case p.Window < 1:
+		return fmt.Errorf("difficulty window must be at least 1")
+	case p.MaxAdjustFactor < 1:
+		return fmt.Errorf("max difficulty adjust factor must be at least 1")
+	case p.MinDifficulty == 0 || p.MinDifficulty > p.MaxDifficulty:
+		return fmt.Errorf("invalid difficulty bounds [%d, %d]", p.MinDifficulty, p.MaxDifficulty)
+	case p.InitialDifficulty < p.MinDifficulty || p.InitialDifficulty > p.MaxDifficulty:
+		return fmt.Errorf("initial difficulty %d outside bounds [%d, %d]", p.InitialDifficulty, p.MinDifficulty, p.MaxDifficulty)
+	}
+	return nil
 }
 
 // BlockInfo contains minimal block data for difficulty calculation
@@ -68,3 +88,59 @@ type BlockInfo struct {
 	Timestamp  int64
 	Difficulty uint64
 }
+
+// NextDifficulty returns the difficulty required of the block following
+// parents. parents holds the most recent headers of the chain, oldest first
+// and ending with the parent; only the last Window+1 are used. The genesis
+// header is ignored since it was not won with a proof.
+func NextDifficulty(parents []BlockInfo, params DifficultyParams) uint64 {
+	if len(parents) > params.Window+1 {
+		parents = parents[len(parents)-params.Window-1:]
+	}
+	if len(parents) > 0 && parents[0].Height == 0 {
+		parents = parents[1:]
+	}
+	if len(parents) < 2 {
+		return params.InitialDifficulty
+	}
+
+	// Average difficulty of the blocks that closed each interval
+	sum := new(big.Int)
+	for _, b := range parents[1:] {
+		sum.Add(sum, new(big.Int).SetUint64(b.Difficulty))
+	}
+	intervals := int64(len(parents) - 1)
+
+	expected := params.TargetBlockTime * intervals
+	actual := parents[len(parents)-1].Timestamp - parents[0].Timestamp
+	if min := expected / params.MaxAdjustFactor; actual < min {
+		actual = min
+	}
+	if max := expected * params.MaxAdjustFactor; actual > max {
+		actual = max
+	}
+
+	// next = avg * actual / expected = sum * actual / (intervals * expected)
+	next := sum.Mul(sum, big.NewInt(actual))
+	next.Quo(next, big.NewInt(intervals*expected))
+
+	if next.Cmp(new(big.Int).SetUint64(params.MinDifficulty)) < 0 {
+		return params.MinDifficulty
+	}
+	if next.Cmp(new(big.Int).SetUint64(params.MaxDifficulty)) > 0 {
+		return params.MaxDifficulty
+	}
+	return next.Uint64()
+}
+
+// CheckDifficulty verifies that a block at height carries the difficulty
+// NextDifficulty derives from its parents
+func CheckDifficulty(height uint64, difficulty uint64, parents []BlockInfo, params DifficultyParams) error {
+	if height < params.ActivationHeight {
+		return nil
+	}
+	if expected := NextDifficulty(parents, params); difficulty != expected {
+		return fmt.Errorf("block %d has difficulty %d, expected %d", height, difficulty, expected)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package consensus
+
+import "testing"
+
+func testChain(n int, spacing int64, difficulty uint64) []BlockInfo {
+	chain := []BlockInfo{{Height: 0, Timestamp: 1000, Difficulty: 1 << 50}}
+	for i := 1; i <= n; i++ {
+		chain = append(chain, BlockInfo{
+			Height:     uint64(i),
+			Timestamp:  1000 + int64(i)*spacing,
+			Difficulty: difficulty,
+		})
+	}
+	return chain
+}
+
+func TestNextDifficulty(t *testing.T) {
+	params := DefaultDifficultyParams()
+	target := params.TargetBlockTime
+
+	// Not enough history (genesis is ignored)
+	if d := NextDifficulty(testChain(1, target, 50_000_000), params); d != params.InitialDifficulty {
+		t.Fatalf("expected initial difficulty, got %d", d)
+	}
+
+	// On-target blocks keep the difficulty
+	if d := NextDifficulty(testChain(100, target, 50_000_000), params); d != 50_000_000 {
+		t.Fatalf("on-target chain: expected 50000000, got %d", d)
+	}
+
+	// Blocks twice as slow make proofs twice as easy to find
+	if d := NextDifficulty(testChain(100, 2*target, 50_000_000), params); d != 100_000_000 {
+		t.Fatalf("slow chain: expected 100000000, got %d", d)
+	}
+
+	// Instant blocks are bounded by the max adjust factor
+	want := uint64(50_000_000) / uint64(params.MaxAdjustFactor)
+	if d := NextDifficulty(testChain(100, 0, 50_000_000), params); d != want {
+		t.Fatalf("fast chain: expected %d, got %d", want, d)
+	}
+
+	// Results are clamped to the configured bounds
+	if d := NextDifficulty(testChain(100, 0, params.MinDifficulty), params); d != params.MinDifficulty {
+		t.Fatalf("expected min difficulty, got %d", d)
+	}
+	if d := NextDifficulty(testChain(100, 10*target, params.MaxDifficulty), params); d != params.MaxDifficulty {
+		t.Fatalf("expected max difficulty, got %d", d)
+	}
+}
+
+func TestCheckDifficulty(t *testing.T) {
+	params := DefaultDifficultyParams()
+	chain := testChain(40, params.TargetBlockTime, 50_000_000)
+
+	if err := CheckDifficulty(41, 50_000_000, chain, params); err != nil {
+		t.Fatalf("expected valid difficulty: %v", err)
+	}
+	if err := CheckDifficulty(41, 100_000_000, chain, params); err == nil {
+		t.Fatal("expected wrong difficulty to be rejected")
+	}
+
+	// Blocks below the activation height are not checked
+	params.ActivationHeight = 100
+	if err := CheckDifficulty(41, 100_000_000, chain, params); err != nil {
+		t.Fatalf("expected unchecked difficulty before activation: %v", err)
+	}
+}
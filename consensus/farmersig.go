@@ -0,0 +1,88 @@
+package consensus
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/ArchivasNetwork/archivas/pospace"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+)
+
+// Farmer signatures
+//
+// A proof of space doesn't say who submitted it, so anyone who sees a
+// winning proof could claim its reward. A block therefore carries a
+// signature by the plot's farmer key. Once blocks commit to their
+// transactions and state (see Upgrades.BlockRoots) the farmer signs the
+// block hash, which covers the parent, the reward and pool addresses and the
+// transactions. Before that it signs a farmer header binding the reward
+// address to the proof and height.
+
+// ErrMissingFarmerSignature is returned for a block with a proof but no signature
+var ErrMissingFarmerSignature = errors.New("missing farmer signature")
+
+// ErrMissingProof is returned for a block without a proof, which no farmer
+// key can have signed
+var ErrMissingProof = errors.New("missing proof of space")
+
+// FarmerHeaderHash returns the hash a farmer signs to claim the block at height
+func FarmerHeaderHash(height uint64, proof *pospace.Proof, farmerAddr string) [32]byte {
+	h := sha256.New()
+	binary.Write(h, binary.BigEndian, height)
+	h.Write(proof.Challenge[:])
+	h.Write(proof.PlotID[:])
+	h.Write(proof.Hash[:])
+	h.Write([]byte(farmerAddr))
+	return sha256.Sum256(h.Sum(nil))
+}
+
+// SignFarmerHeader signs the farmer header of a block with the plot's farmer key
+func SignFarmerHeader(privKey []byte, height uint64, proof *pospace.Proof, farmerAddr string) []byte {
+	hash := FarmerHeaderHash(height, proof, farmerAddr)
+	return ecdsa.Sign(secp256k1.PrivKeyFromBytes(privKey), hash[:]).Serialize()
+}
+
+// SignBlockHash signs a block hash with the plot's farmer key
+func SignBlockHash(privKey []byte, blockHash [32]byte) []byte {
+	return ecdsa.Sign(secp256k1.PrivKeyFromBytes(privKey), blockHash[:]).Serialize()
+}
+
+// VerifyFarmerSignature checks that sig is a signature of the farmer header
+// by the farmer key of the proof's plot
+func VerifyFarmerSignature(height uint64, proof *pospace.Proof, farmerAddr string, sig []byte) error {
+	if proof == nil {
+		return ErrMissingProof
+	}
+	return verifyFarmerKey(FarmerHeaderHash(height, proof, farmerAddr), proof, sig)
+}
+
+// VerifyBlockSignature checks that sig is a signature of a block hash by the
+// farmer key of the block's proof
+func VerifyBlockSignature(blockHash [32]byte, proof *pospace.Proof, sig []byte) error {
+	return verifyFarmerKey(blockHash, proof, sig)
+}
+
+// verifyFarmerKey checks that sig signs hash with the proof's farmer key
+func verifyFarmerKey(hash [32]byte, proof *pospace.Proof, sig []byte) error {
+	if proof == nil {
+		return ErrMissingProof
+	}
+	if len(sig) == 0 {
+		return ErrMissingFarmerSignature
+	}
+	pubKey, err := secp256k1.ParsePubKey(proof.FarmerPubKey[:])
+	if err != nil {
+		return fmt.Errorf("invalid farmer public key: %w", err)
+	}
+	signature, err := ecdsa.ParseDERSignature(sig)
+	if err != nil {
+		return fmt.Errorf("invalid farmer signature: %w", err)
+	}
+	if !signature.Verify(hash[:], pubKey) {
+		return fmt.Errorf("farmer signature does not match plot key")
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package consensus
+
+import (
+	"testing"
+
+	"github.com/ArchivasNetwork/archivas/pospace"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+func TestFarmerSignature(t *testing.T) {
+	plotKey, _ := secp256k1.GeneratePrivateKey()
+	otherKey, _ := secp256k1.GeneratePrivateKey()
+
+	proof := &pospace.Proof{Challenge: testHash(1), PlotID: testHash(2), Hash: testHash(3)}
+	copy(proof.FarmerPubKey[:], plotKey.PubKey().SerializeCompressed())
+
+	sig := SignFarmerHeader(plotKey.Serialize(), 10, proof, "arcv1farmer")
+	if err := VerifyFarmerSignature(10, proof, "arcv1farmer", sig); err != nil {
+		t.Fatalf("expected valid signature: %v", err)
+	}
+
+	// The signature binds the reward address and height
+	if err := VerifyFarmerSignature(10, proof, "arcv1thief", sig); err == nil {
+		t.Fatal("expected redirected reward to be rejected")
+	}
+	if err := VerifyFarmerSignature(11, proof, "arcv1farmer", sig); err == nil {
+		t.Fatal("expected signature for another height to be rejected")
+	}
+
+	// Only the plot's farmer key can sign
+	forged := SignFarmerHeader(otherKey.Serialize(), 10, proof, "arcv1thief")
+	if err := VerifyFarmerSignature(10, proof, "arcv1thief", forged); err == nil {
+		t.Fatal("expected signature by another key to be rejected")
+	}
+	if err := VerifyFarmerSignature(10, proof, "arcv1farmer", nil); err != ErrMissingFarmerSignature {
+		t.Fatalf("expected ErrMissingFarmerSignature, got %v", err)
+	}
+	if err := VerifyFarmerSignature(10, nil, "arcv1farmer", sig); err != ErrMissingProof {
+		t.Fatalf("expected ErrMissingProof, got %v", err)
+	}
+}
+
+func TestBlockSignature(t *testing.T) {
+	plotKey, _ := secp256k1.GeneratePrivateKey()
+	otherKey, _ := secp256k1.GeneratePrivateKey()
+
+	proof := &pospace.Proof{Challenge: testHash(1), PlotID: testHash(2), Hash: testHash(3)}
+	copy(proof.FarmerPubKey[:], plotKey.PubKey().SerializeCompressed())
+
+	sig := SignBlockHash(plotKey.Serialize(), testHash(4))
+	if err := VerifyBlockSignature(testHash(4), proof, sig); err != nil {
+		t.Fatalf("expected valid signature: %v", err)
+	}
+	if err := VerifyBlockSignature(testHash(5), proof, sig); err == nil {
+		t.Fatal("expected signature of another block to be rejected")
+	}
+	forged := SignBlockHash(otherKey.Serialize(), testHash(4))
+	if err := VerifyBlockSignature(testHash(4), proof, forged); err == nil {
+		t.Fatal("expected signature by another key to be rejected")
+	}
+	if err := VerifyBlockSignature(testHash(4), nil, sig); err != ErrMissingProof {
+		t.Fatalf("expected ErrMissingProof, got %v", err)
+	}
+}
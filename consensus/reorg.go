@@ -2,6 +2,7 @@ package consensus
 
 import (
 	"fmt"
+	"math/big"
 )
 
 // ReorgDetector handles chain reorganization detection and execution
@@ -19,7 +20,7 @@ func NewReorgDetector() *ReorgDetector {
 
 // DetectReorg checks if a competing chain should replace the current chain
 // Returns: needsReorg, forkHeight, error
-func (r *ReorgDetector) DetectReorg(currentTipWork, newChainWork uint64, commonHeight uint64, currentHeight uint64) (bool, uint64, error) {
+func (r *ReorgDetector) DetectReorg(currentTipWork, newChainWork *big.Int, commonHeight uint64, currentHeight uint64) (bool, uint64, error) {
 	// Calculate reorg depth
 	reorgDepth := currentHeight - commonHeight
 
@@ -29,7 +30,7 @@ func (r *ReorgDetector) DetectReorg(currentTipWork, newChainWork uint64, commonH
 	}
 
 	// Compare cumulative work
-	if newChainWork > currentTipWork {
+	if CompareChains(newChainWork, currentTipWork) {
 		// New chain has more work - reorg needed
 		return true, commonHeight, nil
 	}
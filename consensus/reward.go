@@ -0,0 +1,53 @@
+package consensus
+
+import (
+	"fmt"
+
+	"github.com/ArchivasNetwork/archivas/address"
+	"github.com/ArchivasNetwork/archivas/pospace"
+)
+
+const (
+	// PoolRewardShareNum / PoolRewardShareDen of the block reward goes to the
+	// pool a plot commits to; the farmer keeps the rest
+	PoolRewardShareNum = 7
+	PoolRewardShareDen = 8
+)
+
+// RewardPayout is a single coinbase output of a block
+type RewardPayout struct {
+	Address string
+	Amount  int64
+}
+
+// SplitBlockReward splits a block reward between farmer and pool
+func SplitBlockReward(reward int64, hasPool bool) (farmerAmount, poolAmount int64) {
+	if !hasPool {
+		return reward, 0
+	}
+	poolAmount = reward * PoolRewardShareNum / PoolRewardShareDen
+	return reward - poolAmount, poolAmount
+}
+
+// BlockRewardPayouts returns the coinbase outputs required for a block won with proof.
+// Solo plots pay the whole reward to the farmer address. Legacy v1 plots can't
+// commit to a pool, so a v1 proof naming one is rejected.
+func BlockRewardPayouts(reward int64, farmerAddr string, proof *pospace.Proof) ([]RewardPayout, error) {
+	if proof != nil && proof.HasPool() && proof.FormatVersion() == pospace.PlotVersionV1 {
+		return nil, fmt.Errorf("v1 proof cannot name a pool address")
+	}
+	if proof == nil || !proof.HasPool() {
+		return []RewardPayout{{Address: farmerAddr, Amount: reward}}, nil
+	}
+
+	poolAddr, err := address.EncodeARCVAddress(address.EVMAddress(proof.PoolAddress), "arcv")
+	if err != nil {
+		return nil, fmt.Errorf("invalid pool address: %w", err)
+	}
+
+	farmerAmount, poolAmount := SplitBlockReward(reward, true)
+	return []RewardPayout{
+		{Address: farmerAddr, Amount: farmerAmount},
+		{Address: poolAddr, Amount: poolAmount},
+	}, nil
+}
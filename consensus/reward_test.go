@@ -0,0 +1,28 @@
+package consensus
+
+import (
+	"testing"
+
+	"github.com/ArchivasNetwork/archivas/pospace"
+)
+
+func TestBlockRewardPayouts(t *testing.T) {
+	farmer := "arcv1zramsn568zt3cwc8ny995u3dhpz5rpuamx2jz7"
+
+	payouts, err := BlockRewardPayouts(800, farmer, &pospace.Proof{})
+	if err != nil || len(payouts) != 1 || payouts[0].Amount != 800 {
+		t.Fatalf("expected solo payout of the whole reward, got %v (%v)", payouts, err)
+	}
+
+	pooled := &pospace.Proof{Version: pospace.PlotVersion, PoolAddress: [20]byte{0xaa}}
+	payouts, err = BlockRewardPayouts(800, farmer, pooled)
+	if err != nil || len(payouts) != 2 || payouts[0].Amount != 100 || payouts[1].Amount != 700 {
+		t.Fatalf("expected 100/700 farmer/pool split, got %v (%v)", payouts, err)
+	}
+
+	// Legacy v1 plots can't commit to a pool
+	pooled.Version = 0
+	if _, err := BlockRewardPayouts(800, farmer, pooled); err == nil {
+		t.Fatal("expected v1 proof with a pool address to be rejected")
+	}
+}
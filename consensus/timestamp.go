@@ -0,0 +1,75 @@
+package consensus
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Block timestamp rules
+//
+// Difficulty is derived from timestamps, so a farmer free to pick any time
+// could push retargeting either way. A block's timestamp must be later than
+// the median timestamp of its last MedianSpan parents, which stops timestamps
+// from being dragged backwards, and no more than MaxFutureDrift seconds ahead
+// of the validating node's clock, which stops them from being pushed forward.
+
+const (
+	// MedianTimeSpan is the number of parents whose median a timestamp must exceed
+	MedianTimeSpan = 11
+
+	// DefaultMaxFutureDrift is how many seconds a timestamp may be ahead of local time
+	DefaultMaxFutureDrift = 120
+)
+
+// ErrFutureTimestamp is returned for a block too far ahead of local time. It
+// may become valid later, unlike the other timestamp errors.
+var ErrFutureTimestamp = errors.New("timestamp too far in the future")
+
+// TimestampParams are the parameters of the timestamp rules
+type TimestampParams struct {
+	MedianSpan       int    // Number of parents whose median timestamp must be exceeded
+	MaxFutureDrift   int64  // Seconds a timestamp may be ahead of local time
+	ActivationHeight uint64 // First height whose timestamp is checked
+}
+
+// DefaultTimestampParams returns the timestamp rules with the default drift
+func DefaultTimestampParams() TimestampParams {
+	return TimestampParams{
+		MedianSpan:     MedianTimeSpan,
+		MaxFutureDrift: DefaultMaxFutureDrift,
+	}
+}
+
+// MedianTimePast returns the median timestamp of the last span parents
+// (oldest first, ending with the parent)
+func MedianTimePast(parents []BlockInfo, span int) int64 {
+	if len(parents) > span {
+		parents = parents[len(parents)-span:]
+	}
+	if len(parents) == 0 {
+		return 0
+	}
+	times := make([]int64, len(parents))
+	for i, b := range parents {
+		times[i] = b.Timestamp
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+	return times[len(times)/2]
+}
+
+// CheckTimestamp verifies that a block at height has a timestamp after the
+// median time past of its parents and at most MaxFutureDrift seconds after
+// now
+func CheckTimestamp(height uint64, timestamp int64, parents []BlockInfo, now int64, params TimestampParams) error {
+	if height < params.ActivationHeight {
+		return nil
+	}
+	if mtp := MedianTimePast(parents, params.MedianSpan); timestamp <= mtp {
+		return fmt.Errorf("block %d timestamp %d not after median time past %d", height, timestamp, mtp)
+	}
+	if timestamp > now+params.MaxFutureDrift {
+		return fmt.Errorf("%w: block %d timestamp %d is %ds ahead (max %ds)", ErrFutureTimestamp, height, timestamp, timestamp-now, params.MaxFutureDrift)
+	}
+	return nil
+}
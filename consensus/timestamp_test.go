@@ -0,0 +1,48 @@
+package consensus
+
+import (
+	"testing"
+
+	"github.com/ArchivasNetwork/archivas/config"
+)
+
+func TestCheckTimestamp(t *testing.T) {
+	params := DefaultTimestampParams()
+	chain := testChain(20, 20, 50_000_000) // Tip at 1400, median of last 11 at 1300
+	now := int64(1420)
+
+	if mtp := MedianTimePast(chain, params.MedianSpan); mtp != 1300 {
+		t.Fatalf("expected median time past 1300, got %d", mtp)
+	}
+	if err := CheckTimestamp(21, 1301, chain, now, params); err != nil {
+		t.Fatalf("expected timestamp after median to be valid: %v", err)
+	}
+	if err := CheckTimestamp(21, 1300, chain, now, params); err == nil {
+		t.Fatal("expected timestamp at median to be rejected")
+	}
+	if err := CheckTimestamp(21, now+params.MaxFutureDrift, chain, now, params); err != nil {
+		t.Fatalf("expected timestamp at max drift to be valid: %v", err)
+	}
+	if err := CheckTimestamp(21, now+params.MaxFutureDrift+1, chain, now, params); err == nil {
+		t.Fatal("expected timestamp beyond max drift to be rejected")
+	}
+
+	// Blocks below the activation height are not checked
+	params.ActivationHeight = 100
+	if err := CheckTimestamp(21, 0, chain, now, params); err != nil {
+		t.Fatalf("expected unchecked timestamp before activation: %v", err)
+	}
+}
+
+func TestShippedGenesisTimestamps(t *testing.T) {
+	// New chains check timestamps from their first block
+	for _, path := range []string{"../genesis/devnet.genesis.json", "../configs/genesis-betanet.json"} {
+		gen, err := config.LoadGenesis(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h := GenesisUpgrades(gen).Timestamps; h != 0 {
+			t.Errorf("%s activates timestamp rules at %d, expected genesis", path, h)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package consensus
+
+import (
+	"math"
+
+	"github.com/ArchivasNetwork/archivas/config"
+)
+
+// Upgrades
+//
+// Rules added after a network launched take effect at an activation height
+// fixed by genesis, so blocks produced under the old rules keep validating.
+// A height the genesis document leaves out is never reached: the rule stays
+// off until the network schedules it.
+
+// NotScheduled is the activation height of a rule genesis doesn't schedule
+const NotScheduled = math.MaxUint64
+
+// Upgrades are the activation heights of consensus rule changes
+type Upgrades struct {
+	Timestamps uint64 // First height whose timestamp is checked
+	Challenges uint64 // First height whose challenge is checked
+	FarmerSigs uint64 // First height whose block must be signed by its farmer
+	PlotV2     uint64 // First height whose proof must come from a v2 plot
+	BlockRoots uint64 // First height whose block commits to tx and state roots
+	StrictTxs  uint64 // First height whose every transaction must apply
+}
+
+// GenesisUpgrades returns the activation heights scheduled by a genesis document
+func GenesisUpgrades(gen *config.GenesisDoc) Upgrades {
+	return Upgrades{
+		Timestamps: activationHeight(gen.TimestampActivationHeight),
+		Challenges: activationHeight(gen.ChallengeActivationHeight),
+		FarmerSigs: activationHeight(gen.FarmerSigActivationHeight),
+		PlotV2:     activationHeight(gen.PlotV2ActivationHeight),
+		BlockRoots: activationHeight(gen.BlockRootsActivationHeight),
+		StrictTxs:  activationHeight(gen.StrictTxsActivationHeight),
+	}
+}
+
+// activationHeight returns a genesis activation height, NotScheduled if unset
+func activationHeight(h *uint64) uint64 {
+	if h == nil {
+		return NotScheduled
+	}
+	return *h
+}
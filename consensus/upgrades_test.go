@@ -0,0 +1,71 @@
+package consensus
+
+import (
+	"testing"
+
+	"github.com/ArchivasNetwork/archivas/config"
+	"github.com/ArchivasNetwork/archivas/pospace"
+)
+
+func TestGenesisUpgrades(t *testing.T) {
+	// Rules a genesis document doesn't schedule never activate
+	gen := &config.GenesisDoc{ChainName: "test"}
+	upgrades := GenesisUpgrades(gen)
+	if upgrades != (Upgrades{NotScheduled, NotScheduled, NotScheduled, NotScheduled, NotScheduled, NotScheduled}) {
+		t.Fatalf("expected unscheduled activations, got %+v", upgrades)
+	}
+	if h := GenesisDifficultyParams(gen).ActivationHeight; h != NotScheduled {
+		t.Fatalf("expected unscheduled difficulty activation, got %d", h)
+	}
+	v1 := &pospace.Proof{}
+	if err := CheckPlotVersion(v1, 5_000_000, upgrades); err != nil {
+		t.Fatalf("expected v1 proof accepted without activation: %v", err)
+	}
+
+	// Scheduling a rule changes the genesis hash, so nodes with different
+	// schedules don't connect
+	hash := config.HashGenesis(gen)
+	height := uint64(100)
+	gen.PlotV2ActivationHeight = &height
+	gen.DifficultyActivationHeight = &height
+	if config.HashGenesis(gen) == hash {
+		t.Fatal("activation heights don't change the genesis hash")
+	}
+	other := uint64(101)
+	scheduled := *gen
+	scheduled.PlotV2ActivationHeight = &other
+	if config.HashGenesis(&scheduled) == config.HashGenesis(gen) {
+		t.Fatal("activation heights don't change the genesis hash")
+	}
+	upgrades = GenesisUpgrades(gen)
+	if err := CheckPlotVersion(v1, 99, upgrades); err != nil {
+		t.Fatalf("expected v1 proof accepted before activation: %v", err)
+	}
+	if err := CheckPlotVersion(v1, 100, upgrades); err == nil {
+		t.Fatal("expected v1 proof rejected at activation")
+	}
+
+	// v2 plots must be large enough not to be rebuilt per challenge
+	small := &pospace.Proof{Version: pospace.PlotVersion, KSize: MinPlotKSize - 1}
+	if err := CheckPlotVersion(small, 100, upgrades); err == nil {
+		t.Fatal("expected plot below MinPlotKSize rejected")
+	}
+	small.KSize = MinPlotKSize
+	if err := CheckPlotVersion(small, 100, upgrades); err != nil {
+		t.Fatalf("expected plot of MinPlotKSize accepted: %v", err)
+	}
+}
+
+func TestShippedGenesisBlockRoots(t *testing.T) {
+	// Blocks of new chains commit to their transfers from the start, so
+	// IBD can assume any block valid
+	for _, path := range []string{"../genesis/devnet.genesis.json", "../configs/genesis-betanet.json"} {
+		gen, err := config.LoadGenesis(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if upgrades := GenesisUpgrades(gen); upgrades.BlockRoots != 0 || upgrades.StrictTxs != 0 {
+			t.Errorf("%s activates block roots at %d and strict transactions at %d, expected genesis", path, upgrades.BlockRoots, upgrades.StrictTxs)
+		}
+	}
+}
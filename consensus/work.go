@@ -1,31 +1,59 @@
 package consensus
 
-// CalculateWork computes the work contribution of a block based on its difficulty
-// Higher difficulty = more work
-func CalculateWork(difficulty uint64) uint64 {
-	// Simple work calculation: work is proportional to difficulty
-	// In production, this would be: work = 2^256 / difficulty
-	// For now, we use difficulty directly as work
-	return difficulty
+import (
+	"math/big"
+
+	"github.com/ArchivasNetwork/archivas/pospace"
+)
+
+// CalculateWork computes the work contribution of a block based on its difficulty.
+// A proof wins when its quality (uniform in [0, QMAX)) is <= difficulty, so the
+// expected number of trials to win is QMAX/difficulty: a lower difficulty is
+// harder and counts as more work. Every block counts as at least one trial.
+func CalculateWork(difficulty uint64) *big.Int {
+	if difficulty == 0 {
+		difficulty = 1
+	}
+	work := new(big.Int).Div(big.NewInt(pospace.QMAX), new(big.Int).SetUint64(difficulty))
+	if work.Sign() == 0 {
+		work.SetInt64(1)
+	}
+	return work
+}
+
+// AddWork returns the cumulative work of a block given its parent's cumulative work
+func AddWork(parentWork *big.Int, difficulty uint64) *big.Int {
+	total := CalculateWork(difficulty)
+	if parentWork != nil {
+		total.Add(total, parentWork)
+	}
+	return total
 }
 
 // CompareChains returns true if chain A has more cumulative work than chain B
-func CompareChains(workA, workB uint64) bool {
-	return workA > workB
+func CompareChains(workA, workB *big.Int) bool {
+	return workOrZero(workA).Cmp(workOrZero(workB)) > 0
 }
 
 // ComputeCumulativeWork calculates total work from a chain of blocks
-func ComputeCumulativeWork(blocks []BlockWork) uint64 {
-	var total uint64
+func ComputeCumulativeWork(blocks []BlockWork) *big.Int {
+	total := new(big.Int)
 	for _, block := range blocks {
-		total += CalculateWork(block.Difficulty)
+		total.Add(total, CalculateWork(block.Difficulty))
 	}
 	return total
 }
 
+// workOrZero treats a missing work value as zero
+func workOrZero(work *big.Int) *big.Int {
+	if work == nil {
+		return new(big.Int)
+	}
+	return work
+}
+
 // BlockWork contains minimal block data for work calculation
 type BlockWork struct {
 	Height     uint64
 	Difficulty uint64
 }
-
@@ -0,0 +1,30 @@
+package consensus
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ArchivasNetwork/archivas/pospace"
+)
+
+func TestCalculateWork(t *testing.T) {
+	// Lower difficulty (harder target) must count as more work
+	if !CompareChains(CalculateWork(1_000_000), CalculateWork(2_000_000)) {
+		t.Fatal("expected harder block to have more work")
+	}
+
+	// Cumulative work must not overflow on long, hard chains
+	parent := new(big.Int).SetUint64(^uint64(0))
+	total := AddWork(parent, 1)
+	if total.Cmp(parent) <= 0 || total.IsUint64() {
+		t.Fatalf("unexpected cumulative work %s", total)
+	}
+	if ComputeCumulativeWork([]BlockWork{{Height: 1, Difficulty: 1}, {Height: 2, Difficulty: 1}}).Int64() != 2*pospace.QMAX {
+		t.Fatal("unexpected cumulative work for two blocks")
+	}
+
+	// Blocks easier than every trial still count
+	if CalculateWork(^uint64(0)).Int64() != 1 {
+		t.Fatal("expected minimum work of 1")
+	}
+}
@@ -52,6 +52,11 @@ if [ ! -f "$ENV_FILE" ]; then
 ARCHIVAS_WALLET_ADDR=arcv1REPLACE_WITH_YOUR_ADDRESS
 ARCHIVAS_FARMER_PRIVKEY=REPLACE_WITH_YOUR_PRIVATE_KEY
 ARCHIVAS_NODE_RPC=http://57.129.148.132:8080
+
+# The timelord feeds VDF updates to your own node (public seeds run their
+# own timelord and don't take updates from others). Start that node with
+# --timelord-token set to ARCHIVAS_RPC_TOKEN.
+ARCHIVAS_TIMELORD_NODE=http://127.0.0.1:8080
 ARCHIVAS_RPC_TOKEN=
 
 # Timelord Performance
@@ -68,6 +73,10 @@ EOF
   echo "  ✅ Created $ENV_FILE (edit before starting!)"
 else
   echo "  ℹ️  $ENV_FILE exists (not overwriting)"
+  if ! sudo grep -q '^ARCHIVAS_TIMELORD_NODE=' "$ENV_FILE"; then
+    echo "ARCHIVAS_TIMELORD_NODE=http://127.0.0.1:8080" | sudo tee -a "$ENV_FILE" >/dev/null
+    echo "  ✅ Added ARCHIVAS_TIMELORD_NODE (the timelord now feeds your own node)"
+  fi
 fi
 
 # Create plots.yaml
@@ -97,7 +106,7 @@ EnvironmentFile=$ENV_FILE
 WorkingDirectory=$INSTALL_DIR
 CPUAffinity=$TL_CORES
 Environment=GOGC=100
-ExecStart=$BIN_DIR/archivas-timelord --node \${ARCHIVAS_NODE_RPC}
+ExecStart=$BIN_DIR/archivas-timelord --node \${ARCHIVAS_TIMELORD_NODE} --token=\${ARCHIVAS_RPC_TOKEN}
 Restart=always
 RestartSec=2
 StandardOutput=append:$LOG_DIR/timelord.log
@@ -150,7 +159,7 @@ echo ""
 echo "2. (Optional) Generate plots:"
 echo "   sudo bash $INSTALL_DIR/autojoin/create-plots.sh 2 28"
 echo ""
-echo "3. Start services:"
+echo "3. Start services (the timelord only if you run your own node):"
 echo "   sudo systemctl enable --now archivas-timelord"
 echo "   sudo systemctl enable --now archivas-farmer@1"
 echo ""
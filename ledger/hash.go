@@ -24,3 +24,13 @@ func hashTransaction(tx Transaction) []byte {
 	return hash[:]
 }
 
+// TxHash identifies a transaction, signature and memo included, when it is
+// relayed between nodes
+func TxHash(tx Transaction) [32]byte {
+	var buf bytes.Buffer
+	buf.Write(hashTransaction(tx))
+	binary.Write(&buf, binary.BigEndian, uint32(len(tx.Memo)))
+	buf.WriteString(tx.Memo)
+	buf.Write(tx.Signature)
+	return sha256.Sum256(buf.Bytes())
+}
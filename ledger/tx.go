@@ -8,6 +8,7 @@ type Transaction struct {
 	Fee          int64  // base units
 	Nonce        uint64 // must match sender's current nonce
 	SenderPubKey []byte // sender's public key (used to verify signature and derive From address)
-	Signature    []byte // secp256k1 signature over HashTransaction(tx)
+	Signature    []byte // secp256k1 signature over HashTransaction(tx), or ed25519 over the txv1 hash
+	Memo         string // txv1 memo, covered by ed25519 signatures only
 }
 
@@ -0,0 +1,44 @@
+package ledger
+
+// BlockUndo records the accounts a block touched as they were before the
+// block was applied, so the block can be rolled back during a reorg
+type BlockUndo struct {
+	Accounts map[string]*AccountState // nil = account did not exist
+}
+
+// CaptureUndo records the current state of addrs. It must be called before
+// the block touching them is applied.
+func (ws *WorldState) CaptureUndo(addrs []string) *BlockUndo {
+	undo := &BlockUndo{Accounts: make(map[string]*AccountState, len(addrs))}
+	for _, addr := range addrs {
+		if _, seen := undo.Accounts[addr]; seen {
+			continue
+		}
+		if acct, ok := ws.Accounts[addr]; ok {
+			undo.Accounts[addr] = &AccountState{Balance: acct.Balance, Nonce: acct.Nonce}
+		} else {
+			undo.Accounts[addr] = nil
+		}
+	}
+	return undo
+}
+
+// Revert restores the accounts recorded in undo, removing those that did not exist
+func (ws *WorldState) Revert(undo *BlockUndo) {
+	for addr, acct := range undo.Accounts {
+		if acct == nil {
+			delete(ws.Accounts, addr)
+			continue
+		}
+		ws.Accounts[addr] = &AccountState{Balance: acct.Balance, Nonce: acct.Nonce}
+	}
+}
+
+// Clone returns a deep copy of the world state
+func (ws *WorldState) Clone() *WorldState {
+	clone := &WorldState{Accounts: make(map[string]*AccountState, len(ws.Accounts))}
+	for addr, acct := range ws.Accounts {
+		clone.Accounts[addr] = &AccountState{Balance: acct.Balance, Nonce: acct.Nonce}
+	}
+	return clone
+}
@@ -0,0 +1,25 @@
+package ledger
+
+import "testing"
+
+func TestBlockUndo(t *testing.T) {
+	ws := NewWorldState(map[string]int64{"alice": 1000})
+
+	tx := Transaction{From: "alice", To: "bob", Amount: 300, Fee: 10, Nonce: 0}
+	undo := ws.CaptureUndo([]string{tx.From, tx.To})
+	before := ws.Clone()
+	if err := ws.ApplyTransaction(tx); err != nil {
+		t.Fatal(err)
+	}
+	if before.GetBalance("alice") != 1000 || before.GetAccount("bob") != nil {
+		t.Fatal("clone shares state with the original")
+	}
+
+	ws.Revert(undo)
+	if acct := ws.Accounts["alice"]; acct.Balance != 1000 || acct.Nonce != 0 {
+		t.Fatalf("alice not restored: %+v", acct)
+	}
+	if _, ok := ws.Accounts["bob"]; ok {
+		t.Fatal("account created by the block survived the revert")
+	}
+}
@@ -2,9 +2,12 @@ package ledger
 
 import (
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"fmt"
 
 	"github.com/ArchivasNetwork/archivas/address"
+	pkgcrypto "github.com/ArchivasNetwork/archivas/pkg/crypto"
+	txv1 "github.com/ArchivasNetwork/archivas/pkg/tx/v1"
 	"github.com/decred/dcrd/dcrec/secp256k1/v4"
 	decredEcdsa "github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
 	"github.com/ethereum/go-ethereum/crypto"
@@ -76,3 +79,44 @@ func VerifyTransactionSignature(tx Transaction) error {
 	return nil
 }
 
+// VerifyTransaction verifies the signature of a transfer in a block, whether
+// it was signed by a secp256k1 wallet or submitted in the ed25519 txv1 format
+func VerifyTransaction(tx Transaction) error {
+	if tx.Amount < 0 || tx.Fee < 0 {
+		return fmt.Errorf("negative amount or fee")
+	}
+	if len(tx.SenderPubKey) == ed25519.PublicKeySize {
+		return verifyTxV1Signature(tx)
+	}
+	return VerifyTransactionSignature(tx)
+}
+
+// verifyTxV1Signature rebuilds the txv1 transfer a transaction was converted
+// from and checks its ed25519 signature
+func verifyTxV1Signature(tx Transaction) error {
+	addr, err := pkgcrypto.PubKeyToAddress(tx.SenderPubKey)
+	if err != nil {
+		return fmt.Errorf("failed to derive address from public key: %w", err)
+	}
+	if addr != tx.From {
+		return fmt.Errorf("public key does not match From address: expected %s, got %s", tx.From, addr)
+	}
+
+	transfer := &txv1.Transfer{
+		Type:   "transfer",
+		From:   tx.From,
+		To:     tx.To,
+		Amount: uint64(tx.Amount),
+		Fee:    uint64(tx.Fee),
+		Nonce:  tx.Nonce,
+		Memo:   tx.Memo,
+	}
+	valid, err := txv1.Verify(tx.SenderPubKey, transfer, tx.Signature)
+	if err != nil {
+		return err
+	}
+	if !valid {
+		return fmt.Errorf("invalid signature")
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package ledger
+
+import (
+	"crypto/ed25519"
+	"testing"
+
+	pkgcrypto "github.com/ArchivasNetwork/archivas/pkg/crypto"
+	txv1 "github.com/ArchivasNetwork/archivas/pkg/tx/v1"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	decredEcdsa "github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+)
+
+func TestVerifyTransaction(t *testing.T) {
+	// secp256k1 wallet transfer
+	key, _ := secp256k1.GeneratePrivateKey()
+	pub := key.PubKey().SerializeCompressed()
+	from, err := pubKeyToARCVAddress(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := Transaction{From: from, To: "arcv1bob", Amount: 100, Fee: 1, Nonce: 0, SenderPubKey: pub}
+	tx.Signature = decredEcdsa.Sign(key, hashTransaction(tx)).Serialize()
+	if err := VerifyTransaction(tx); err != nil {
+		t.Fatalf("expected valid secp256k1 transfer: %v", err)
+	}
+	tampered := tx
+	tampered.Amount = 1000
+	if err := VerifyTransaction(tampered); err == nil {
+		t.Fatal("expected tampered secp256k1 transfer to be rejected")
+	}
+
+	// ed25519 txv1 transfer, memo included
+	edPub, edPriv, _ := ed25519.GenerateKey(nil)
+	edFrom, err := pkgcrypto.PubKeyToAddress(edPub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transfer := &txv1.Transfer{Type: "transfer", From: edFrom, To: "arcv1bob", Amount: 100, Fee: 1, Nonce: 3, Memo: "rent"}
+	sig, _, _, err := txv1.Sign(edPriv, transfer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v1 := Transaction{From: edFrom, To: "arcv1bob", Amount: 100, Fee: 1, Nonce: 3, SenderPubKey: edPub, Signature: sig, Memo: "rent"}
+	if err := VerifyTransaction(v1); err != nil {
+		t.Fatalf("expected valid txv1 transfer: %v", err)
+	}
+	v1.Memo = ""
+	if err := VerifyTransaction(v1); err == nil {
+		t.Fatal("expected txv1 transfer with altered memo to be rejected")
+	}
+
+	// A key can only spend from its own address
+	v1.Memo, v1.From = "rent", from
+	if err := VerifyTransaction(v1); err == nil {
+		t.Fatal("expected transfer from another address to be rejected")
+	}
+}
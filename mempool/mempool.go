@@ -1,31 +1,85 @@
 package mempool
 
-import "github.com/ArchivasNetwork/archivas/ledger"
+import (
+	"sync"
+
+	"github.com/ArchivasNetwork/archivas/ledger"
+)
 
 // Mempool stores pending transactions
 type Mempool struct {
-	txs []ledger.Transaction
+	mu     sync.Mutex
+	txs    []ledger.Transaction
+	hashes map[[32]byte]int // Index into txs by ledger.TxHash
+	onAdd  func(hash [32]byte)
 }
 
 // NewMempool creates a new empty mempool
 func NewMempool() *Mempool {
 	return &Mempool{
-		txs: make([]ledger.Transaction, 0),
+		txs:    make([]ledger.Transaction, 0),
+		hashes: make(map[[32]byte]int),
 	}
 }
 
-// Add adds a transaction to the mempool
-func (m *Mempool) Add(tx ledger.Transaction) {
+// OnAdd sets a function called with the hash of every transaction added
+func (m *Mempool) OnAdd(fn func(hash [32]byte)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onAdd = fn
+}
+
+// Add adds a transaction to the mempool, reporting false if it was already
+// there
+func (m *Mempool) Add(tx ledger.Transaction) bool {
+	hash := ledger.TxHash(tx)
+
+	m.mu.Lock()
+	if _, ok := m.hashes[hash]; ok {
+		m.mu.Unlock()
+		return false
+	}
+	m.hashes[hash] = len(m.txs)
 	m.txs = append(m.txs, tx)
+	onAdd := m.onAdd
+	m.mu.Unlock()
+
+	if onAdd != nil {
+		onAdd(hash)
+	}
+	return true
+}
+
+// Has reports whether a transaction is in the mempool
+func (m *Mempool) Has(hash [32]byte) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.hashes[hash]
+	return ok
+}
+
+// Get returns a pending transaction by hash
+func (m *Mempool) Get(hash [32]byte) (ledger.Transaction, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i, ok := m.hashes[hash]
+	if !ok {
+		return ledger.Transaction{}, false
+	}
+	return m.txs[i], true
 }
 
 // Pending returns all pending transactions
 func (m *Mempool) Pending() []ledger.Transaction {
-	return m.txs
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]ledger.Transaction(nil), m.txs...)
 }
 
 // Clear removes all transactions from the mempool
 func (m *Mempool) Clear() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.txs = make([]ledger.Transaction, 0)
+	m.hashes = make(map[[32]byte]int)
 }
-
@@ -1,6 +1,7 @@
 package node
 
 import (
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -11,6 +12,8 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/ArchivasNetwork/archivas/consensus"
 )
 
 // IBDState tracks Initial Block Download progress
@@ -53,6 +56,13 @@ type NodeIBDInterface interface {
 	ApplyBlock(blockData json.RawMessage) error
 }
 
+// NodeReorgInterface is implemented by nodes that can switch to a competing branch
+type NodeReorgInterface interface {
+	NodeIBDInterface
+	GetBlockHash(height uint64) ([32]byte, bool)
+	ReorganizeBlocks(blocks []json.RawMessage) (consensus.ReorgInfo, error)
+}
+
 // IBDManager handles Initial Block Download
 type IBDManager struct {
 	config *IBDConfig
@@ -235,6 +245,83 @@ func (m *IBDManager) RunIBD(peerURL string) error {
 	return nil
 }
 
+// SyncFork checks whether a peer's chain diverges from the local one within
+// the last maxDepth blocks. If it does, the peer's branch is downloaded from
+// the fork point and handed to the node, which switches to it if it has more
+// work. It returns nil when the local chain is a prefix of the peer's, in
+// which case plain IBD applies.
+func (m *IBDManager) SyncFork(peerURL string, maxDepth uint64) (*consensus.ReorgInfo, error) {
+	rn, ok := m.node.(NodeReorgInterface)
+	if !ok {
+		return nil, fmt.Errorf("node does not support reorganization")
+	}
+
+	remoteTip, err := m.FetchRemoteTip(peerURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch remote tip: %w", err)
+	}
+	localHeight := rn.GetCurrentHeight()
+
+	// Compare block hashes from the highest common height down
+	top := localHeight
+	if remoteTip < top {
+		top = remoteTip
+	}
+	bottom := uint64(0)
+	if top > maxDepth {
+		bottom = top - maxDepth
+	}
+	blocks, _, err := m.fetchBlockBatch(peerURL, bottom, int(top-bottom+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch blocks %d-%d: %w", bottom, top, err)
+	}
+
+	forkHeight, found := uint64(0), false
+	for i := len(blocks) - 1; i >= 0; i-- {
+		var header struct {
+			Height uint64 `json:"height"`
+			Hash   string `json:"hash"`
+		}
+		if err := json.Unmarshal(blocks[i], &header); err != nil {
+			return nil, fmt.Errorf("failed to decode block: %w", err)
+		}
+		localHash, ok := rn.GetBlockHash(header.Height)
+		if ok && hex.EncodeToString(localHash[:]) == header.Hash {
+			forkHeight, found = header.Height, true
+			break
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("no common block with %s in heights %d-%d", peerURL, bottom, top)
+	}
+	if forkHeight == localHeight {
+		return nil, nil
+	}
+
+	log.Printf("[SYNC] Peer %s diverges after height %d (local=%d remote=%d), fetching branch",
+		peerURL, forkHeight, localHeight, remoteTip)
+
+	// Download the competing branch
+	var branch []json.RawMessage
+	for next := forkHeight + 1; next <= remoteTip; {
+		batch, _, err := m.fetchBlockBatch(peerURL, next, m.config.BatchSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch branch at %d: %w", next, err)
+		}
+		if len(batch) == 0 {
+			break
+		}
+		branch = append(branch, batch...)
+		next += uint64(len(batch))
+	}
+
+	info, err := rn.ReorganizeBlocks(branch)
+	if err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
 // FetchRemoteTip gets current chain tip from peer (exported for periodic sync checks)
 func (m *IBDManager) FetchRemoteTip(peerURL string) (uint64, error) {
 	url := fmt.Sprintf("%s/chainTip", peerURL)
@@ -0,0 +1,283 @@
+package p2p
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// Compact payload encoding
+//
+// Blocks are JSON on the node side, where hashes and keys show up either as
+// hex strings or as arrays of byte values, both two to four times the size
+// of the bytes they carry. Block-carrying messages are therefore sent as a
+// tagged binary form of their JSON: integers are varints, hex strings and
+// byte arrays are raw bytes, and strings, arrays and objects are length
+// prefixed. Decoding gives back equivalent JSON.
+
+const (
+	tagNull   = 0
+	tagFalse  = 1
+	tagTrue   = 2
+	tagUint   = 3 // uvarint
+	tagInt    = 4 // zigzag varint, negative integers
+	tagNumber = 5 // Any other number, as its JSON text
+	tagString = 6
+	tagHex    = 7 // Lowercase hex string, as the bytes it encodes
+	tagArray  = 8
+	tagBytes  = 9 // Array of integers 0-255, as bytes
+	tagObject = 10
+
+	maxCompactDepth = 64
+)
+
+var errCompactTruncated = errors.New("truncated compact payload")
+
+// encodeCompact converts a JSON document to its compact form
+func encodeCompact(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	appendCompact(&buf, v)
+	return buf.Bytes(), nil
+}
+
+func appendCompact(buf *bytes.Buffer, v interface{}) {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteByte(tagNull)
+	case bool:
+		if v {
+			buf.WriteByte(tagTrue)
+		} else {
+			buf.WriteByte(tagFalse)
+		}
+	case json.Number:
+		if u, err := strconv.ParseUint(v.String(), 10, 64); err == nil {
+			buf.WriteByte(tagUint)
+			buf.Write(binary.AppendUvarint(nil, u))
+		} else if i, err := strconv.ParseInt(v.String(), 10, 64); err == nil {
+			buf.WriteByte(tagInt)
+			buf.Write(binary.AppendVarint(nil, i))
+		} else {
+			buf.WriteByte(tagNumber)
+			appendCompactBytes(buf, []byte(v.String()))
+		}
+	case string:
+		if b, err := hex.DecodeString(v); err == nil && len(b) > 0 && hex.EncodeToString(b) == v {
+			buf.WriteByte(tagHex)
+			appendCompactBytes(buf, b)
+		} else {
+			buf.WriteByte(tagString)
+			appendCompactBytes(buf, []byte(v))
+		}
+	case []interface{}:
+		if b, ok := byteArray(v); ok {
+			buf.WriteByte(tagBytes)
+			appendCompactBytes(buf, b)
+			return
+		}
+		buf.WriteByte(tagArray)
+		buf.Write(binary.AppendUvarint(nil, uint64(len(v))))
+		for _, item := range v {
+			appendCompact(buf, item)
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		buf.WriteByte(tagObject)
+		buf.Write(binary.AppendUvarint(nil, uint64(len(v))))
+		for _, k := range keys {
+			appendCompactBytes(buf, []byte(k))
+			appendCompact(buf, v[k])
+		}
+	}
+}
+
+// byteArray returns the bytes of a non-empty array of integers 0-255
+func byteArray(items []interface{}) ([]byte, bool) {
+	if len(items) == 0 {
+		return nil, false
+	}
+	b := make([]byte, len(items))
+	for i, item := range items {
+		n, ok := item.(json.Number)
+		if !ok {
+			return nil, false
+		}
+		u, err := strconv.ParseUint(n.String(), 10, 8)
+		if err != nil {
+			return nil, false
+		}
+		b[i] = byte(u)
+	}
+	return b, true
+}
+
+func appendCompactBytes(buf *bytes.Buffer, b []byte) {
+	buf.Write(binary.AppendUvarint(nil, uint64(len(b))))
+	buf.Write(b)
+}
+
+// decodeCompact converts a compact payload back to JSON
+func decodeCompact(data []byte) ([]byte, error) {
+	d := &compactDecoder{data: data}
+	var out bytes.Buffer
+	if err := d.value(&out, 0); err != nil {
+		return nil, err
+	}
+	if d.pos != len(d.data) {
+		return nil, fmt.Errorf("%d trailing bytes", len(d.data)-d.pos)
+	}
+	return out.Bytes(), nil
+}
+
+type compactDecoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *compactDecoder) value(out *bytes.Buffer, depth int) error {
+	if depth > maxCompactDepth {
+		return errors.New("compact payload nested too deeply")
+	}
+	if d.pos >= len(d.data) {
+		return errCompactTruncated
+	}
+	tag := d.data[d.pos]
+	d.pos++
+
+	switch tag {
+	case tagNull:
+		out.WriteString("null")
+	case tagFalse:
+		out.WriteString("false")
+	case tagTrue:
+		out.WriteString("true")
+	case tagUint:
+		u, n := binary.Uvarint(d.data[d.pos:])
+		if n <= 0 {
+			return errCompactTruncated
+		}
+		d.pos += n
+		out.WriteString(strconv.FormatUint(u, 10))
+	case tagInt:
+		i, n := binary.Varint(d.data[d.pos:])
+		if n <= 0 {
+			return errCompactTruncated
+		}
+		d.pos += n
+		out.WriteString(strconv.FormatInt(i, 10))
+	case tagNumber:
+		b, err := d.bytes()
+		if err != nil {
+			return err
+		}
+		if _, err := strconv.ParseFloat(string(b), 64); err != nil {
+			return fmt.Errorf("invalid number %q", b)
+		}
+		out.Write(b)
+	case tagString:
+		b, err := d.bytes()
+		if err != nil {
+			return err
+		}
+		s, _ := json.Marshal(string(b))
+		out.Write(s)
+	case tagHex:
+		b, err := d.bytes()
+		if err != nil {
+			return err
+		}
+		out.WriteByte('"')
+		out.WriteString(hex.EncodeToString(b))
+		out.WriteByte('"')
+	case tagBytes:
+		b, err := d.bytes()
+		if err != nil {
+			return err
+		}
+		out.WriteByte('[')
+		for i, c := range b {
+			if i > 0 {
+				out.WriteByte(',')
+			}
+			out.WriteString(strconv.Itoa(int(c)))
+		}
+		out.WriteByte(']')
+	case tagArray:
+		count, err := d.count()
+		if err != nil {
+			return err
+		}
+		out.WriteByte('[')
+		for i := uint64(0); i < count; i++ {
+			if i > 0 {
+				out.WriteByte(',')
+			}
+			if err := d.value(out, depth+1); err != nil {
+				return err
+			}
+		}
+		out.WriteByte(']')
+	case tagObject:
+		count, err := d.count()
+		if err != nil {
+			return err
+		}
+		out.WriteByte('{')
+		for i := uint64(0); i < count; i++ {
+			if i > 0 {
+				out.WriteByte(',')
+			}
+			key, err := d.bytes()
+			if err != nil {
+				return err
+			}
+			k, _ := json.Marshal(string(key))
+			out.Write(k)
+			out.WriteByte(':')
+			if err := d.value(out, depth+1); err != nil {
+				return err
+			}
+		}
+		out.WriteByte('}')
+	default:
+		return fmt.Errorf("unknown compact tag %d", tag)
+	}
+	return nil
+}
+
+// count reads an element count; every element takes at least one byte, so
+// counts beyond the remaining payload are rejected before looping
+func (d *compactDecoder) count() (uint64, error) {
+	count, n := binary.Uvarint(d.data[d.pos:])
+	if n <= 0 || count > uint64(len(d.data)-d.pos-n) {
+		return 0, errCompactTruncated
+	}
+	d.pos += n
+	return count, nil
+}
+
+// bytes reads a length-prefixed byte string
+func (d *compactDecoder) bytes() ([]byte, error) {
+	length, n := binary.Uvarint(d.data[d.pos:])
+	if n <= 0 || length > uint64(len(d.data)-d.pos-n) {
+		return nil, errCompactTruncated
+	}
+	start := d.pos + n
+	d.pos = start + int(length)
+	return d.data[start:d.pos], nil
+}
@@ -0,0 +1,137 @@
+package p2p
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ArchivasNetwork/archivas/network"
+)
+
+// Connection handshake
+//
+// Every connection, dialed or accepted, first sets up the encrypted
+// transport, proving both node identities (see noise.go). Then both sides
+// send a HandshakeMessage. The first message read from the peer must be its
+// handshake, arrive within handshakeTimeout and match our network profile
+// and genesis hash; otherwise the connection is closed before the peer is
+// registered or any other message is handled.
+
+// handshakeTimeout bounds the handshake exchange
+const handshakeTimeout = 10 * time.Second
+
+// HandshakeConfig identifies this node to its peers
+type HandshakeConfig struct {
+	Profile     *network.NetworkProfile
+	GenesisHash [32]byte
+	NodeVersion string
+	NodeName    string
+	RPCPort     int
+	NodeKey     ed25519.PrivateKey // Persistent identity; a random one if nil
+}
+
+// SetHandshakeConfig sets the identity exchanged and enforced in handshakes
+func (n *Network) SetHandshakeConfig(cfg HandshakeConfig) {
+	n.Lock()
+	defer n.Unlock()
+
+	if cfg.Profile != nil {
+		n.profile = *cfg.Profile
+	}
+	n.genesisHash = cfg.GenesisHash
+	n.nodeVersion = cfg.NodeVersion
+	n.nodeName = cfg.NodeName
+	n.rpcPort = cfg.RPCPort
+	if cfg.NodeKey != nil {
+		n.noise = newNoiseKeys(cfg.NodeKey)
+	}
+}
+
+// NodeID returns this node's identity, as peers see it
+func (n *Network) NodeID() string {
+	n.RLock()
+	defer n.RUnlock()
+	return NodeID(n.noise.identity.Public().(ed25519.PublicKey))
+}
+
+// handshake secures a new connection, then exchanges handshakes with the
+// peer and records what it advertised. The initiator is the dialing side;
+// pinned, or else a whitelist pin, is the identity key the peer must prove.
+// An error means the peer must be disconnected; a peer that sends something
+// other than a valid handshake is also penalized.
+func (n *Network) handshake(peer *Peer, initiator bool, pinned ed25519.PublicKey) error {
+	n.RLock()
+	profile := n.profile
+	genesisHash := n.genesisHash
+	local := CreateHandshake(&profile, genesisHash, n.nodeVersion, n.nodeName)
+	local.RPCPort = n.rpcPort
+	keys := n.noise
+	if pinned == nil {
+		pinned = n.pinnedKeyLocked(peer.Address)
+	}
+	n.RUnlock()
+
+	peer.Conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	defer peer.Conn.SetDeadline(time.Time{})
+
+	secure, identity, err := secureHandshake(peer.Conn, keys, initiator)
+	if err != nil {
+		if errors.Is(err, ErrNoiseHandshake) {
+			n.misbehaving(peer, PenaltyBadHandshake, err.Error())
+		}
+		return fmt.Errorf("encrypted transport: %w", err)
+	}
+	if identity.Equal(keys.identity.Public()) {
+		return fmt.Errorf("connected to self")
+	}
+	if pinned != nil && !identity.Equal(pinned) {
+		return fmt.Errorf("%w: peer is node %s, expected %s", ErrNoiseHandshake, NodeID(identity), NodeID(pinned))
+	}
+	peer.IdentityKey = identity
+	peer.Reader = bufio.NewReaderSize(secure, noiseMaxPlain)
+	peer.Writer = bufio.NewWriterSize(secure, noiseMaxPlain)
+
+	if err := n.SendMessage(peer, MsgTypeHandshake, local); err != nil {
+		return fmt.Errorf("failed to send handshake: %w", err)
+	}
+
+	msg, err := readFrame(peer.Reader)
+	if err != nil {
+		if isFrameError(err) {
+			n.misbehaving(peer, PenaltyMalformed, err.Error())
+		}
+		return fmt.Errorf("no handshake received: %w", err)
+	}
+	remote, err := checkHandshake(msg, &profile, genesisHash)
+	if err != nil {
+		n.misbehaving(peer, PenaltyBadHandshake, err.Error())
+		return err
+	}
+
+	peer.Version = remote.NodeVersion
+	peer.NodeName = remote.NodeName
+	peer.RPCPort = remote.RPCPort
+	log.Printf("[p2p] handshake with %s ok: node=%s version=%s name=%q rpcPort=%d",
+		peer.Address, NodeID(identity), remote.NodeVersion, remote.NodeName, remote.RPCPort)
+	return nil
+}
+
+// checkHandshake decodes the peer's first message and verifies it is a
+// handshake for our network and genesis
+func checkHandshake(msg *Message, profile *network.NetworkProfile, genesisHash [32]byte) (*HandshakeMessage, error) {
+	if msg.Type != MsgTypeHandshake {
+		return nil, fmt.Errorf("first message has type %d, expected handshake", msg.Type)
+	}
+	var remote HandshakeMessage
+	if err := json.Unmarshal(msg.Payload, &remote); err != nil {
+		return nil, fmt.Errorf("invalid handshake: %w", err)
+	}
+	if err := VerifyHandshake(&remote, profile, genesisHash); err != nil {
+		return nil, err
+	}
+	return &remote, nil
+}
@@ -0,0 +1,75 @@
+package p2p
+
+import (
+	"net"
+	"testing"
+
+	"github.com/ArchivasNetwork/archivas/network"
+)
+
+func TestHandshake(t *testing.T) {
+	profile, err := network.GetProfile("betanet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	genesis := [32]byte{1}
+
+	server := NewNetwork("127.0.0.1:0", &testChain{})
+	server.SetHandshakeConfig(HandshakeConfig{Profile: profile, GenesisHash: genesis, NodeVersion: "v1", NodeName: "server", RPCPort: 8545})
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+	addr := server.listener.Addr().String()
+
+	// Matching peers connect and record each other's identity
+	client := NewNetwork("127.0.0.1:0", &testChain{})
+	client.SetHandshakeConfig(HandshakeConfig{Profile: profile, GenesisHash: genesis, NodeName: "client"})
+	if err := client.ConnectPeer(addr); err != nil {
+		t.Fatalf("expected handshake to succeed: %v", err)
+	}
+	peer := client.peerSnapshot()[0]
+	if peer.NodeName != "server" || peer.Version != "v1" || peer.RPCPort != 8545 {
+		t.Fatalf("peer identity not recorded: %+v", peer)
+	}
+	waitFor(t, func() bool { return server.GetPeerCount() == 1 })
+	if name := server.peerSnapshot()[0].NodeName; name != "client" {
+		t.Fatalf("expected server to record client name, got %q", name)
+	}
+
+	// A peer on another chain is rejected
+	other := NewNetwork("127.0.0.1:0", &testChain{})
+	other.SetHandshakeConfig(HandshakeConfig{Profile: profile, GenesisHash: [32]byte{2}})
+	if err := other.ConnectPeer(addr); err == nil {
+		t.Fatal("expected genesis mismatch to be rejected")
+	}
+	if other.GetPeerCount() != 0 {
+		t.Fatal("rejected peer was registered")
+	}
+
+	// So is a peer whose first message isn't a handshake
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		secure, _, err := secureHandshake(conn, ephemeralNoiseKeys(), false)
+		if err != nil {
+			return
+		}
+		writeFrame(secure, MsgTypePing, []byte(`{}`))
+		conn.Read(make([]byte, 1024))
+	}()
+	if err := client.ConnectPeer(listener.Addr().String()); err == nil {
+		t.Fatal("expected peer skipping the handshake to be rejected")
+	}
+	if client.GetPeerCount() != 1 {
+		t.Fatal("peer skipping the handshake was registered")
+	}
+}
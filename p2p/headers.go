@@ -0,0 +1,523 @@
+package p2p
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ArchivasNetwork/archivas/metrics"
+)
+
+// Headers-first sync
+//
+// StartHeadersSync downloads the header chain from the best peer and has the
+// node validate it batch by batch. As headers are validated, their heights
+// are cut into windows of ibdBatchSize blocks, which are requested with
+// RequestBlocks from every peer that has them, up to ibdMaxConcurrent
+// windows per peer. Bodies arrive in any order and are connected strictly in
+// height order. Windows that time out, come back short or carry a rejected
+// block are retried from another peer. Peers that don't serve headers are
+// synced with the older single-peer StartIBD.
+//
+// Headers below the node's BodyCommitHeight don't commit to their blocks'
+// transactions, so the bodies for them are only fetched from the peer that
+// served the headers. Header download pauses while MaxPendingHeaders headers
+// are waiting for their bodies.
+
+const (
+	headersBatchSize = 1000             // Headers asked for per GetHeaders
+	headersTimeout   = 30 * time.Second // Wait for Headers before asking another peer
+	bodyTimeout      = 60 * time.Second // Wait for a window before retrying it elsewhere
+	bodyRetryDelay   = 2 * time.Second  // Pause before re-requesting a window a busy peer declined
+	syncTick         = 1 * time.Second
+)
+
+// MaxPendingHeaders caps the validated headers a node keeps ahead of its chain
+const MaxPendingHeaders = 50000
+
+// bodyWindow is a range of block bodies to fetch from a single peer
+type bodyWindow struct {
+	from, to uint64
+	source   *Peer          // Only peer that may serve it (nil: any)
+	peer     *Peer          // Peer the window was requested from (nil: queued)
+	sentAt   time.Time      // When it was requested
+	retryAt  time.Time      // Not requested again before this
+	failed   map[*Peer]bool // Peers that didn't deliver it
+}
+
+// syncBody is a downloaded block waiting for its parent to be connected
+type syncBody struct {
+	data json.RawMessage
+	peer *Peer
+}
+
+// headerSpan is a run of headers validated from one peer
+type headerSpan struct {
+	from, to uint64
+	peer     *Peer
+}
+
+// headerSync tracks a headers-first sync
+type headerSync struct {
+	sync.Mutex
+	active      bool
+	headerFrom  uint64         // First height of the next GetHeaders
+	headerPeer  *Peer          // Peer the pending GetHeaders went to
+	headerSent  time.Time      // When it was sent (zero: none pending)
+	headerWait  bool           // Waiting for bodies before asking for more
+	headersDone bool           // No more headers to fetch
+	gotHeaders  bool           // Some peer served headers
+	headerTried map[*Peer]bool // Peers that failed to serve headers
+	sources     []headerSpan   // Who served the headers of this sync
+	next        uint64         // First height not yet cut into a window
+	queue       []*bodyWindow
+	inflight    []*bodyWindow
+	bodies      map[uint64]syncBody
+
+	applyMu sync.Mutex // Serializes connecting bodies
+}
+
+func newHeaderSync() *headerSync {
+	return &headerSync{}
+}
+
+// StartHeadersSync starts a headers-first sync unless one is running
+func (n *Network) StartHeadersSync() {
+	if n.nodeHandler == nil {
+		return
+	}
+	localHeight := n.nodeHandler.LocalHeight()
+
+	hs := n.headerSync
+	hs.Lock()
+	if hs.active {
+		hs.Unlock()
+		return
+	}
+	hs.active = true
+	hs.headerFrom = localHeight + 1 // Replaces headers left by an earlier sync
+	hs.headerPeer, hs.headerSent = nil, time.Time{}
+	hs.headersDone, hs.gotHeaders = false, false
+	hs.headerTried = make(map[*Peer]bool)
+	hs.sources = nil
+	hs.next = localHeight + 1
+	hs.queue, hs.inflight = nil, nil
+	hs.bodies = make(map[uint64]syncBody)
+	hs.Unlock()
+
+	log.Printf("[sync] starting headers-first sync from height %d", localHeight+1)
+
+	// Fresh peer heights decide who can serve which windows
+	for _, peer := range n.peerSnapshot() {
+		n.SendMessage(peer, MsgTypeGetStatus, GetStatusMessage{})
+	}
+
+	go n.headerSyncLoop()
+	n.requestHeaders()
+}
+
+// requestHeaders asks the highest peer that hasn't failed yet for the
+// headers following the validated ones, unless enough are waiting for
+// their bodies already
+func (n *Network) requestHeaders() {
+	localHeight := n.nodeHandler.LocalHeight()
+
+	hs := n.headerSync
+	hs.Lock()
+	if !hs.active || !hs.headerSent.IsZero() {
+		hs.Unlock()
+		return
+	}
+	from := hs.headerFrom
+	hs.headerWait = from > localHeight+MaxPendingHeaders
+	if hs.headerWait {
+		hs.Unlock()
+		return // headerSyncLoop asks again once bodies catch up
+	}
+	var peer *Peer
+	for _, p := range n.peerSnapshot() {
+		if p.Height() >= from && !hs.headerTried[p] && (peer == nil || p.Height() > peer.Height()) {
+			peer = p
+		}
+	}
+	if peer == nil {
+		hs.headersDone = true
+		hs.headerSent = time.Time{}
+		hs.Unlock()
+		log.Printf("[sync] no peer left to serve headers from %d", from)
+		n.scheduleBodies()
+		return
+	}
+	hs.headerPeer, hs.headerSent = peer, time.Now()
+	hs.Unlock()
+
+	n.SendMessage(peer, MsgTypeGetHeaders, GetHeadersMessage{FromHeight: from, MaxHeaders: headersBatchSize})
+}
+
+// handleGetHeaders serves a batch of headers
+func (n *Network) handleGetHeaders(peer *Peer, payload json.RawMessage) {
+	var req GetHeadersMessage
+	if err := json.Unmarshal(payload, &req); err != nil {
+		n.misbehaving(peer, PenaltyMalformed, "invalid GET_HEADERS")
+		return
+	}
+	if n.nodeHandler == nil {
+		return
+	}
+
+	headers, tipHeight, err := n.nodeHandler.OnHeadersRequest(req.FromHeight, req.MaxHeaders)
+	if err != nil {
+		log.Printf("[p2p] failed to get headers from=%d: %v", req.FromHeight, err)
+		return
+	}
+	n.SendMessage(peer, MsgTypeHeaders, HeadersMessage{
+		FromHeight: req.FromHeight,
+		Headers:    headers,
+		TipHeight:  tipHeight,
+	})
+}
+
+// handleHeaders validates a batch of headers and asks for the next one
+func (n *Network) handleHeaders(peer *Peer, payload json.RawMessage) {
+	var msg HeadersMessage
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		n.misbehaving(peer, PenaltyMalformed, "invalid HEADERS")
+		return
+	}
+
+	hs := n.headerSync
+	hs.Lock()
+	if !hs.active || peer != hs.headerPeer || hs.headerSent.IsZero() {
+		hs.Unlock()
+		log.Printf("[p2p] ignoring unrequested HEADERS from %s", peer.Address)
+		return
+	}
+	hs.headerSent = time.Time{}
+	hs.Unlock()
+
+	peer.raiseHeight(msg.TipHeight)
+
+	if len(msg.Headers) > 0 && n.distrusted(peer) {
+		log.Printf("[sync] ignoring headers from distrusted peer %s", peer.Address)
+		hs.Lock()
+		hs.headerTried[peer] = true
+		hs.Unlock()
+		n.requestHeaders()
+		n.scheduleBodies()
+		return
+	}
+	if len(msg.Headers) > 0 {
+		headerHeight, err := n.nodeHandler.ConnectHeaders(msg.Headers)
+		hs.Lock()
+		hs.gotHeaders = true
+		if err != nil {
+			hs.headerTried[peer] = true
+		}
+		if headerHeight >= hs.headerFrom {
+			hs.sources = append(hs.sources, headerSpan{from: hs.headerFrom, to: headerHeight, peer: peer})
+			hs.headerFrom = headerHeight + 1
+		}
+		hs.Unlock()
+
+		if err != nil {
+			log.Printf("[sync] invalid headers from %s: %v", peer.Address, err)
+			if errors.Is(err, ErrInvalidBlock) {
+				n.misbehaving(peer, PenaltyInvalidBlock, err.Error())
+			}
+		} else {
+			log.Printf("[sync] validated headers up to %d (peer tip %d)", headerHeight, msg.TipHeight)
+		}
+		if err != nil || headerHeight < msg.TipHeight {
+			n.requestHeaders()
+			n.scheduleBodies()
+			return
+		}
+	}
+
+	hs.Lock()
+	hs.headersDone = true
+	hs.Unlock()
+	log.Printf("[sync] header chain complete at %d", n.nodeHandler.HeaderHeight())
+	n.scheduleBodies()
+}
+
+// scheduleBodies cuts validated headers into windows and requests queued
+// windows from peers with spare capacity
+func (n *Network) scheduleBodies() {
+	headerHeight := n.nodeHandler.HeaderHeight()
+	commitHeight := n.nodeHandler.BodyCommitHeight()
+	peers := n.peerSnapshot()
+	now := time.Now()
+
+	hs := n.headerSync
+	hs.Lock()
+	if !hs.active {
+		hs.Unlock()
+		return
+	}
+	target := min(headerHeight, hs.headerFrom-1) // Only headers this sync validated
+	for hs.next <= target {
+		w := &bodyWindow{from: hs.next, to: min(hs.next+uint64(n.ibdBatchSize)-1, target), failed: make(map[*Peer]bool)}
+		if w.from < commitHeight {
+			span := hs.sourceOf(w.from)
+			w.source = span.peer
+			w.to = min(w.to, span.to, commitHeight-1)
+		}
+		hs.queue = append(hs.queue, w)
+		hs.next = w.to + 1
+	}
+
+	load := make(map[*Peer]int)
+	for _, w := range hs.inflight {
+		load[w.peer]++
+	}
+
+	// Lowest windows first: they unblock connecting the ones above
+	sort.Slice(hs.queue, func(i, j int) bool { return hs.queue[i].from < hs.queue[j].from })
+	var sends []*bodyWindow
+	var stuck *bodyWindow
+	queued := hs.queue[:0]
+	for _, w := range hs.queue {
+		if len(peers) > 0 && (allFailed(peers, w.failed) || w.source != nil && (w.failed[w.source] || !slices.Contains(peers, w.source))) {
+			stuck = w
+		}
+		var peer *Peer
+		if now.After(w.retryAt) {
+			for _, p := range peers {
+				if w.failed[p] || load[p] >= n.ibdMaxConcurrent || p.Height() < w.to || w.source != nil && p != w.source {
+					continue
+				}
+				if peer == nil || load[p] < load[peer] {
+					peer = p
+				}
+			}
+		}
+		if peer == nil {
+			queued = append(queued, w)
+			continue
+		}
+		w.peer, w.sentAt = peer, now
+		load[peer]++
+		hs.inflight = append(hs.inflight, w)
+		sends = append(sends, w)
+	}
+	hs.queue = queued
+	done := hs.headersDone && len(hs.queue) == 0 && len(hs.inflight) == 0
+	hs.Unlock()
+
+	for _, w := range sends {
+		metrics.IncIBDRequestedBatches()
+		n.SendMessage(w.peer, MsgTypeRequestBlocks, RequestBlocksMessage{
+			FromHeight: w.from,
+			MaxBlocks:  uint32(w.to - w.from + 1),
+		})
+	}
+
+	if stuck != nil {
+		log.Printf("[sync] no peer delivered blocks %d-%d, stopping headers-first sync", stuck.from, stuck.to)
+		n.finishHeadersSync()
+	} else if done {
+		n.finishHeadersSync()
+	}
+}
+
+// handleBodyBatch takes a BlocksBatch answering one of our body windows.
+// It returns false when no headers-first sync is running.
+func (n *Network) handleBodyBatch(peer *Peer, batch *BlocksBatchMessage) bool {
+	hs := n.headerSync
+	hs.Lock()
+	if !hs.active {
+		hs.Unlock()
+		return false
+	}
+	var w *bodyWindow
+	for i, iw := range hs.inflight {
+		if iw.peer == peer && iw.from == batch.FromHeight {
+			w = iw
+			hs.inflight = append(hs.inflight[:i], hs.inflight[i+1:]...)
+			break
+		}
+	}
+	if w == nil {
+		hs.Unlock()
+		log.Printf("[sync] ignoring unrequested BLOCKS_BATCH from=%d from %s", batch.FromHeight, peer.Address)
+		return true
+	}
+
+	count := uint64(len(batch.Blocks))
+	if count > w.to-w.from+1 {
+		count = w.to - w.from + 1
+	}
+	for i := uint64(0); i < count; i++ {
+		hs.bodies[w.from+i] = syncBody{data: batch.Blocks[i], peer: peer}
+	}
+
+	// The rest of a short window is fetched again; a peer that is merely
+	// busy may be asked again after a pause
+	if w.from+count <= w.to {
+		rest := &bodyWindow{from: w.from + count, to: w.to, source: w.source, failed: w.failed}
+		if count == 0 && !batch.EOF {
+			rest.retryAt = time.Now().Add(bodyRetryDelay)
+		} else {
+			rest.failed[peer] = true
+		}
+		hs.queue = append(hs.queue, rest)
+	}
+	hs.Unlock()
+
+	log.Printf("[sync] received blocks %d-%d from %s", w.from, w.from+count-1, peer.Address)
+	metrics.IncIBDReceivedBatches()
+	n.applyBodies()
+	n.scheduleBodies()
+	return true
+}
+
+// applyBodies connects downloaded bodies in height order until one is missing
+func (n *Network) applyBodies() {
+	hs := n.headerSync
+	hs.applyMu.Lock()
+	defer hs.applyMu.Unlock()
+
+	height := n.nodeHandler.LocalHeight() + 1
+	hs.Lock()
+	for h := range hs.bodies {
+		if h < height {
+			delete(hs.bodies, h) // Connected some other way meanwhile
+		}
+	}
+	hs.Unlock()
+
+	applied := 0
+	for ; ; height++ {
+		hs.Lock()
+		body, ok := hs.bodies[height]
+		delete(hs.bodies, height)
+		hs.Unlock()
+		if !ok {
+			break
+		}
+
+		if err := n.nodeHandler.ConnectBody(body.data); err != nil {
+			log.Printf("[sync] block %d from %s rejected: %v", height, body.peer.Address, err)
+			if errors.Is(err, ErrInvalidBlock) {
+				n.misbehaving(body.peer, PenaltyInvalidBlock, err.Error())
+			}
+			committed := height >= n.nodeHandler.BodyCommitHeight()
+			hs.Lock()
+			w := &bodyWindow{from: height, to: height, failed: map[*Peer]bool{body.peer: true}}
+			if !committed {
+				w.source = hs.sourceOf(height).peer
+			}
+			hs.queue = append(hs.queue, w)
+			hs.Unlock()
+			break
+		}
+		applied++
+	}
+
+	if applied > 0 {
+		metrics.IncIBDBlocksApplied(applied)
+		log.Printf("[sync] connected %d blocks, now at height %d", applied, height-1)
+	}
+}
+
+// headerSyncLoop retries stalled header and body requests while a sync runs
+func (n *Network) headerSyncLoop() {
+	ticker := time.NewTicker(syncTick)
+	defer ticker.Stop()
+
+	hs := n.headerSync
+	for range ticker.C {
+		now := time.Now()
+		hs.Lock()
+		if !hs.active {
+			hs.Unlock()
+			return
+		}
+		headersStalled := !hs.headerSent.IsZero() && now.Sub(hs.headerSent) > headersTimeout
+		if headersStalled {
+			log.Printf("[sync] peer %s didn't send headers in time", hs.headerPeer.Address)
+			hs.headerTried[hs.headerPeer] = true
+			hs.headerSent = time.Time{}
+		}
+		inflight := hs.inflight[:0]
+		for _, w := range hs.inflight {
+			if now.Sub(w.sentAt) > bodyTimeout {
+				log.Printf("[sync] peer %s didn't send blocks %d-%d in time", w.peer.Address, w.from, w.to)
+				w.failed[w.peer] = true
+				w.peer = nil
+				hs.queue = append(hs.queue, w)
+				continue
+			}
+			inflight = append(inflight, w)
+		}
+		hs.inflight = inflight
+		headerWait := hs.headerWait
+		hs.Unlock()
+
+		if headersStalled || headerWait {
+			n.requestHeaders()
+		}
+		n.scheduleBodies()
+	}
+}
+
+// finishHeadersSync ends the running sync, falling back to StartIBD when
+// no peer served headers
+func (n *Network) finishHeadersSync() {
+	hs := n.headerSync
+	hs.Lock()
+	if !hs.active {
+		hs.Unlock()
+		return
+	}
+	hs.active = false
+	gotHeaders := hs.gotHeaders
+	hs.queue, hs.inflight, hs.bodies = nil, nil, nil
+	hs.Unlock()
+
+	localHeight := n.nodeHandler.LocalHeight()
+	if !gotHeaders {
+		log.Printf("[sync] no peer served headers, falling back to batched IBD")
+		n.StartIBD(localHeight + 1)
+		return
+	}
+	log.Printf("[sync] headers-first sync finished at height %d", localHeight)
+}
+
+// sourceOf returns the span of the headers of this sync holding height
+// (caller must hold lock)
+func (hs *headerSync) sourceOf(height uint64) headerSpan {
+	for _, span := range hs.sources {
+		if span.from <= height && height <= span.to {
+			return span
+		}
+	}
+	return headerSpan{from: height, to: height}
+}
+
+// peerSnapshot returns the connected peers ordered by address
+func (n *Network) peerSnapshot() []*Peer {
+	n.RLock()
+	peers := make([]*Peer, 0, len(n.peers))
+	for _, peer := range n.peers {
+		peers = append(peers, peer)
+	}
+	n.RUnlock()
+	sort.Slice(peers, func(i, j int) bool { return peers[i].Address < peers[j].Address })
+	return peers
+}
+
+// allFailed reports whether every peer is in failed
+func allFailed(peers []*Peer, failed map[*Peer]bool) bool {
+	for _, p := range peers {
+		if !failed[p] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,254 @@
+package p2p
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testChainBlock is the block format of testChain
+type testChainBlock struct {
+	Height uint64 `json:"height"`
+	Bad    bool   `json:"bad"` // Body that fails validation
+}
+
+// testChain is a NodeHandler holding a chain of numbered blocks
+type testChain struct {
+	sync.Mutex
+	tip      uint64                      // Connected height
+	headers  uint64                      // Validated header height
+	bad      map[uint64]bool             // Blocks served with an invalid body
+	served   int                         // Bodies served to peers
+	lowest   uint64                      // Lowest height of a body served
+	headed   int                         // Headers served to peers
+	rejected int                         // Bodies that failed to connect
+	commit   uint64                      // First height whose header commits to its body
+	objects  map[invItem]json.RawMessage // Inventory, hashed with sha256
+}
+
+func (c *testChain) OnNewBlock(height uint64, hash [32]byte, fromPeer string) {}
+func (c *testChain) OnBlockRequest(height uint64) (interface{}, error) {
+	return nil, fmt.Errorf("not supported")
+}
+func (c *testChain) GetStatus() (uint64, uint64, [32]byte) {
+	c.Lock()
+	defer c.Unlock()
+	return c.tip, 1, [32]byte{}
+}
+func (c *testChain) LocalHeight() uint64 {
+	c.Lock()
+	defer c.Unlock()
+	return c.tip
+}
+func (c *testChain) HasBlock(height uint64) bool { return height <= c.LocalHeight() }
+func (c *testChain) VerifyAndApplyBlock(blockJSON json.RawMessage) error {
+	return fmt.Errorf("not supported")
+}
+
+func (c *testChain) OnBlocksRangeRequest(fromHeight uint64, maxBlocks uint32) ([]json.RawMessage, uint64, bool, error) {
+	c.Lock()
+	defer c.Unlock()
+	blocks := []json.RawMessage{}
+	for h := fromHeight; h <= c.tip && len(blocks) < int(maxBlocks); h++ {
+		data, _ := json.Marshal(testChainBlock{Height: h, Bad: c.bad[h]})
+		blocks = append(blocks, data)
+	}
+	c.served += len(blocks)
+	if len(blocks) > 0 && (c.lowest == 0 || fromHeight < c.lowest) {
+		c.lowest = fromHeight
+	}
+	return blocks, c.tip, fromHeight+uint64(len(blocks)) > c.tip, nil
+}
+
+func (c *testChain) OnHeadersRequest(fromHeight uint64, maxHeaders uint32) ([]json.RawMessage, uint64, error) {
+	c.Lock()
+	defer c.Unlock()
+	headers := []json.RawMessage{}
+	for h := fromHeight; h <= c.tip && len(headers) < int(maxHeaders); h++ {
+		data, _ := json.Marshal(testChainBlock{Height: h})
+		headers = append(headers, data)
+	}
+	c.headed += len(headers)
+	return headers, c.tip, nil
+}
+
+func (c *testChain) HeaderHeight() uint64 {
+	c.Lock()
+	defer c.Unlock()
+	return max(c.tip, c.headers)
+}
+
+func (c *testChain) ConnectHeaders(headers []json.RawMessage) (uint64, error) {
+	c.Lock()
+	defer c.Unlock()
+	c.headers = max(c.tip, c.headers)
+	for i, data := range headers {
+		var header testChainBlock
+		json.Unmarshal(data, &header)
+		if i == 0 && header.Height > c.tip && header.Height <= c.headers {
+			c.headers = header.Height - 1
+		}
+		if header.Height != c.headers+1 {
+			return c.headers, fmt.Errorf("header %d out of order", header.Height)
+		}
+		c.headers++
+	}
+	return c.headers, nil
+}
+
+func (c *testChain) ConnectBody(blockJSON json.RawMessage) error {
+	c.Lock()
+	defer c.Unlock()
+	var block testChainBlock
+	json.Unmarshal(blockJSON, &block)
+	if block.Height != c.tip+1 || block.Height > c.headers {
+		return fmt.Errorf("no header for block %d", block.Height)
+	}
+	if block.Bad {
+		c.rejected++
+		return fmt.Errorf("invalid block %d", block.Height)
+	}
+	c.tip++
+	return nil
+}
+
+func (c *testChain) BodyCommitHeight() uint64 { return c.commit }
+
+func (c *testChain) HasObject(invType string, hash [32]byte) bool {
+	_, ok := c.GetObject(invType, hash)
+	return ok
+}
+
+func (c *testChain) GetObject(invType string, hash [32]byte) (json.RawMessage, bool) {
+	c.Lock()
+	defer c.Unlock()
+	data, ok := c.objects[invItem{invType, hash}]
+	return data, ok
+}
+
+func (c *testChain) AcceptObject(invType string, hash [32]byte, data json.RawMessage) error {
+	if sha256.Sum256(data) != hash || strings.Contains(string(data), "bad") {
+		if invType == InvBlock {
+			return ErrInvalidBlock
+		}
+		return ErrInvalidTx
+	}
+	c.Lock()
+	defer c.Unlock()
+	if c.objects == nil {
+		c.objects = make(map[invItem]json.RawMessage)
+	}
+	c.objects[invItem{invType, hash}] = data
+	return nil
+}
+
+func TestHeadersFirstSync(t *testing.T) {
+	// Two peers with the same 100 blocks, each serving one invalid body
+	servers := []*testChain{
+		{tip: 100, bad: map[uint64]bool{15: true}},
+		{tip: 100, bad: map[uint64]bool{37: true}},
+	}
+	client := &testChain{}
+	clientNet := NewNetwork("127.0.0.1:0", client)
+	clientNet.ibdBatchSize = 10
+
+	for _, server := range servers {
+		serverNet := NewNetwork("127.0.0.1:0", server)
+		if err := serverNet.Start(); err != nil {
+			t.Fatal(err)
+		}
+		defer serverNet.Stop()
+		if err := clientNet.ConnectPeer(serverNet.listener.Addr().String()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Wait for both peers' heights
+	for _, peer := range clientNet.peerSnapshot() {
+		clientNet.SendMessage(peer, MsgTypeGetStatus, GetStatusMessage{})
+	}
+	waitFor(t, func() bool {
+		for _, peer := range clientNet.peerSnapshot() {
+			if peer.Height() != 100 {
+				return false
+			}
+		}
+		return true
+	})
+
+	clientNet.StartHeadersSync()
+	waitFor(t, func() bool { return client.LocalHeight() == 100 })
+
+	for i, server := range servers {
+		server.Lock()
+		served := server.served
+		server.Unlock()
+		if served == 0 {
+			t.Errorf("expected peer %d to serve bodies", i)
+		}
+	}
+	waitFor(t, func() bool {
+		clientNet.headerSync.Lock()
+		defer clientNet.headerSync.Unlock()
+		return !clientNet.headerSync.active
+	})
+}
+
+func TestHeadersFirstSyncUncommittedBodies(t *testing.T) {
+	// Below height 51 headers don't commit to bodies, which must then come
+	// from the peer that served the headers
+	servers := []*testChain{{tip: 100}, {tip: 100}}
+	client := &testChain{commit: 51}
+	clientNet := NewNetwork("127.0.0.1:0", client)
+	clientNet.ibdBatchSize = 10
+
+	for _, server := range servers {
+		serverNet := NewNetwork("127.0.0.1:0", server)
+		if err := serverNet.Start(); err != nil {
+			t.Fatal(err)
+		}
+		defer serverNet.Stop()
+		if err := clientNet.ConnectPeer(serverNet.listener.Addr().String()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, peer := range clientNet.peerSnapshot() {
+		clientNet.SendMessage(peer, MsgTypeGetStatus, GetStatusMessage{})
+	}
+	waitFor(t, func() bool {
+		for _, peer := range clientNet.peerSnapshot() {
+			if peer.Height() != 100 {
+				return false
+			}
+		}
+		return true
+	})
+
+	clientNet.StartHeadersSync()
+	waitFor(t, func() bool { return client.LocalHeight() == 100 })
+
+	for i, server := range servers {
+		server.Lock()
+		headed, served, lowest := server.headed, server.served, server.lowest
+		server.Unlock()
+		if headed == 0 && served > 0 && lowest < client.commit {
+			t.Errorf("peer %d served body %d without serving its header", i, lowest)
+		}
+	}
+}
+
+// waitFor polls cond until it holds or the test times out
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -2,6 +2,7 @@ package p2p
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"time"
 
@@ -13,7 +14,7 @@ import (
 func (n *Network) handleRequestBlocks(peer *Peer, payload json.RawMessage) {
 	var req RequestBlocksMessage
 	if err := json.Unmarshal(payload, &req); err != nil {
-		log.Printf("[p2p] invalid REQUEST_BLOCKS from %s: %v", peer.Address, err)
+		n.misbehaving(peer, PenaltyMalformed, "invalid REQUEST_BLOCKS")
 		return
 	}
 
@@ -102,7 +103,12 @@ func (n *Network) handleRequestBlocks(peer *Peer, payload json.RawMessage) {
 func (n *Network) handleBlocksBatch(peer *Peer, payload json.RawMessage) {
 	var batch BlocksBatchMessage
 	if err := json.Unmarshal(payload, &batch); err != nil {
-		log.Printf("[p2p] invalid BLOCKS_BATCH from %s: %v", peer.Address, err)
+		n.misbehaving(peer, PenaltyMalformed, "invalid BLOCKS_BATCH")
+		return
+	}
+
+	// v1.3.0: Batches answering headers-first body windows
+	if n.handleBodyBatch(peer, &batch) {
 		return
 	}
 
@@ -133,6 +139,9 @@ func (n *Network) handleBlocksBatch(peer *Peer, payload json.RawMessage) {
 		// Apply block
 		if err := n.nodeHandler.VerifyAndApplyBlock(blockJSON); err != nil {
 			log.Printf("[p2p] failed to apply block %d: %v", expectedHeight, err)
+			if errors.Is(err, ErrInvalidBlock) {
+				n.misbehaving(peer, PenaltyInvalidBlock, err.Error())
+			}
 			break
 		}
 
@@ -0,0 +1,302 @@
+package p2p
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// Inventory
+//
+// Blocks and transactions are announced with Inv messages listing their
+// type and hash. Every connection remembers the objects known to be on the
+// other side, whether announced, requested or sent over it, and nothing is
+// announced to a peer that already knows it. A node lacking an announced
+// object asks the announcer for it with a Req and gets it back in a Res. A
+// request that isn't answered within invRequestTimeout, or that is answered
+// with an invalid object, is retried from the next peer that announced the
+// object. At most maxInvRequests objects are requested at once, and at most
+// maxPeerInvRequests from one peer; announcements past those limits are
+// ignored. Accepted blocks are announced onwards here; transactions are
+// announced by the node once they are in its mempool.
+
+// Inventory types
+const (
+	InvBlock = "block"
+	InvTx    = "tx"
+)
+
+const (
+	maxKnownInv       = 8192             // Objects remembered per connection
+	maxInvHashes      = 1000             // Hashes per Inv or Req
+	invRequestTimeout = 15 * time.Second // Wait for a Res before asking another peer
+
+	maxInvRequests     = 4096 // Objects requested at once from all peers
+	maxPeerInvRequests = 1000 // Objects requested at once from one peer
+)
+
+// invItem identifies an object by type and hash
+type invItem struct {
+	typ  string
+	hash [32]byte
+}
+
+// invRequest is an object requested from a peer
+type invRequest struct {
+	peer    *Peer     // Peer asked last
+	sentAt  time.Time // When it was asked
+	holders []*Peer   // Other peers that announced the object, not yet asked
+}
+
+// seenSet is a bounded set of objects that forgets the oldest past its limit
+type seenSet struct {
+	sync.Mutex
+	set   map[invItem]bool
+	order []invItem
+}
+
+// add records item, reporting whether it is new
+func (s *seenSet) add(item invItem) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.set == nil {
+		s.set = make(map[invItem]bool)
+	}
+	if s.set[item] {
+		return false
+	}
+	s.set[item] = true
+	s.order = append(s.order, item)
+	if len(s.order) > maxKnownInv {
+		delete(s.set, s.order[0])
+		s.order = s.order[1:]
+	}
+	return true
+}
+
+// Announce announces an object to every peer that doesn't know it yet
+func (n *Network) Announce(invType string, hash [32]byte) {
+	item := invItem{invType, hash}
+	msg := InvMessage{Type: invType, Hashes: []string{hex.EncodeToString(hash[:])}}
+	for _, peer := range n.peerSnapshot() {
+		if !peer.knownInv.add(item) {
+			continue
+		}
+		if err := n.SendMessage(peer, MsgTypeInv, msg); err != nil {
+			log.Printf("[p2p] failed to announce %s %s to %s: %v", invType, msg.Hashes[0], peer.Address, err)
+		}
+	}
+}
+
+// handleInv requests the announced objects the node doesn't have
+func (n *Network) handleInv(peer *Peer, payload json.RawMessage) {
+	var inv InvMessage
+	if err := json.Unmarshal(payload, &inv); err != nil || len(inv.Hashes) > maxInvHashes || !validInvType(inv.Type) {
+		n.misbehaving(peer, PenaltyMalformed, "invalid INV")
+		return
+	}
+
+	var wanted []string
+	for _, h := range inv.Hashes {
+		hash, err := parseInvHash(h)
+		if err != nil {
+			n.misbehaving(peer, PenaltyMalformed, err.Error())
+			return
+		}
+		item := invItem{inv.Type, hash}
+		peer.knownInv.add(item)
+		if n.nodeHandler.HasObject(inv.Type, hash) || !n.claimRequest(item, peer) {
+			continue
+		}
+		wanted = append(wanted, h)
+	}
+	if len(wanted) > 0 {
+		n.SendMessage(peer, MsgTypeReq, ReqMessage{Type: inv.Type, Hashes: wanted})
+	}
+}
+
+// claimRequest records that item is about to be requested from peer. If it
+// is already being requested from another peer, peer is kept to retry from
+// and false is returned, as it is when too many requests are pending.
+func (n *Network) claimRequest(item invItem, peer *Peer) bool {
+	n.Lock()
+	defer n.Unlock()
+
+	if req := n.invRequests[item]; req != nil {
+		if req.peer == peer {
+			return false
+		}
+		for _, p := range req.holders {
+			if p == peer {
+				return false
+			}
+		}
+		req.holders = append(req.holders, peer)
+		return false
+	}
+	if len(n.invRequests) >= maxInvRequests || peer.invRequested >= maxPeerInvRequests {
+		return false
+	}
+	n.invRequests[item] = &invRequest{peer: peer, sentAt: time.Now()}
+	peer.invRequested++
+	time.AfterFunc(invRequestTimeout, func() { n.retryRequest(item, false) })
+	return true
+}
+
+// retryRequest asks the next connected peer that announced item for it,
+// either because the pending request timed out or, with failed set, because
+// it was answered with an invalid object. The request is dropped once no
+// peer is left.
+func (n *Network) retryRequest(item invItem, failed bool) {
+	n.Lock()
+	req := n.invRequests[item]
+	if req == nil || (!failed && time.Since(req.sentAt) < invRequestTimeout) {
+		n.Unlock()
+		return // Answered, or asked again since the timer was set
+	}
+	if !failed {
+		log.Printf("[p2p] peer %s didn't send %s %x in time", req.peer.Address, item.typ, item.hash[:8])
+	}
+	req.peer.invRequested--
+	var next *Peer
+	for next == nil && len(req.holders) > 0 {
+		if p := req.holders[0]; n.peers[p.Address] == p && p.invRequested < maxPeerInvRequests {
+			next = p
+		}
+		req.holders = req.holders[1:]
+	}
+	if next == nil {
+		delete(n.invRequests, item)
+		n.Unlock()
+		return
+	}
+	req.peer, req.sentAt = next, time.Now()
+	next.invRequested++
+	n.Unlock()
+
+	time.AfterFunc(invRequestTimeout, func() { n.retryRequest(item, false) })
+	n.SendMessage(next, MsgTypeReq, ReqMessage{Type: item.typ, Hashes: []string{hex.EncodeToString(item.hash[:])}})
+}
+
+// handleReq serves requested objects the node has; unknown ones are skipped
+// and the requester retries elsewhere
+func (n *Network) handleReq(peer *Peer, payload json.RawMessage) {
+	var req ReqMessage
+	if err := json.Unmarshal(payload, &req); err != nil || len(req.Hashes) > maxInvHashes || !validInvType(req.Type) {
+		n.misbehaving(peer, PenaltyMalformed, "invalid REQ")
+		return
+	}
+
+	for _, h := range req.Hashes {
+		hash, err := parseInvHash(h)
+		if err != nil {
+			n.misbehaving(peer, PenaltyMalformed, err.Error())
+			return
+		}
+		data, ok := n.nodeHandler.GetObject(req.Type, hash)
+		if !ok {
+			continue
+		}
+		peer.knownInv.add(invItem{req.Type, hash})
+		if err := n.SendMessage(peer, MsgTypeRes, ResMessage{Type: req.Type, Hash: h, Data: data}); err != nil {
+			log.Printf("[p2p] failed to send %s %s to %s: %v", req.Type, h, peer.Address, err)
+			return
+		}
+	}
+}
+
+// handleRes hands a requested object to the node
+func (n *Network) handleRes(peer *Peer, payload json.RawMessage) {
+	var res ResMessage
+	if err := json.Unmarshal(payload, &res); err != nil || !validInvType(res.Type) {
+		n.misbehaving(peer, PenaltyMalformed, "invalid RES")
+		return
+	}
+	hash, err := parseInvHash(res.Hash)
+	if err != nil {
+		n.misbehaving(peer, PenaltyMalformed, err.Error())
+		return
+	}
+	item := invItem{res.Type, hash}
+	peer.knownInv.add(item)
+
+	n.RLock()
+	requested := n.invRequests[item] != nil
+	n.RUnlock()
+	if !requested {
+		return // Unsolicited, or already received from another peer
+	}
+
+	if res.Type == InvBlock && n.distrusted(peer) {
+		n.retryRequest(item, true)
+		return
+	}
+	if res.Type == InvBlock && n.blockAhead(peer, hash, res.Data) {
+		n.dropRequest(item)
+		return
+	}
+
+	err = n.nodeHandler.AcceptObject(res.Type, hash, res.Data)
+	if errors.Is(err, ErrInvalidBlock) || errors.Is(err, ErrInvalidTx) {
+		penalty := PenaltyInvalidTx
+		if res.Type == InvBlock {
+			penalty = PenaltyInvalidBlock
+		}
+		n.misbehaving(peer, penalty, err.Error())
+		n.retryRequest(item, true)
+		return
+	}
+	n.dropRequest(item)
+	if err != nil {
+		log.Printf("[p2p] %s %s from %s not accepted: %v", res.Type, res.Hash, peer.Address, err)
+		return
+	}
+	if res.Type == InvBlock {
+		n.Announce(InvBlock, hash)
+	}
+}
+
+// blockAhead reports whether a requested block is beyond the node's next
+// height, in which case the node catches up the way it does for a NEW_BLOCK
+func (n *Network) blockAhead(peer *Peer, hash [32]byte, data json.RawMessage) bool {
+	var block struct{ Height uint64 }
+	if err := json.Unmarshal(data, &block); err != nil {
+		return false // Left to the node to reject
+	}
+	peer.raiseHeight(block.Height)
+	if block.Height <= n.nodeHandler.LocalHeight()+1 {
+		return false
+	}
+	n.nodeHandler.OnNewBlock(block.Height, hash, peer.Address)
+	return true
+}
+
+// dropRequest forgets a request once its object has been handled
+func (n *Network) dropRequest(item invItem) {
+	n.Lock()
+	if req := n.invRequests[item]; req != nil {
+		req.peer.invRequested--
+		delete(n.invRequests, item)
+	}
+	n.Unlock()
+}
+
+// validInvType reports whether t is a known inventory type
+func validInvType(t string) bool {
+	return t == InvBlock || t == InvTx
+}
+
+// parseInvHash decodes a hex object hash
+func parseInvHash(s string) ([32]byte, error) {
+	var hash [32]byte
+	raw, err := hex.DecodeString(s)
+	if err != nil || len(raw) != len(hash) {
+		return hash, errors.New("invalid inventory hash")
+	}
+	copy(hash[:], raw)
+	return hash, nil
+}
@@ -0,0 +1,144 @@
+package p2p
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// inventoryLine starts three networks a - b - c, where a and c are only
+// connected through b
+func inventoryLine(t *testing.T) ([]*Network, []*testChain) {
+	t.Helper()
+	chains := []*testChain{{}, {}, {}}
+	nets := make([]*Network, len(chains))
+	for i, chain := range chains {
+		nets[i] = NewNetwork("127.0.0.1:0", chain)
+		if err := nets[i].Start(); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { nets[i].Stop() })
+	}
+	bAddr := nets[1].listener.Addr().String()
+	for _, i := range []int{0, 2} {
+		if err := nets[i].ConnectPeer(bAddr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor(t, func() bool { return nets[1].GetPeerCount() == 2 })
+	return nets, chains
+}
+
+// addObject stores an object in a testChain, returning its hash
+func addObject(c *testChain, invType, data string) [32]byte {
+	hash := sha256.Sum256([]byte(data))
+	c.Lock()
+	defer c.Unlock()
+	if c.objects == nil {
+		c.objects = make(map[invItem]json.RawMessage)
+	}
+	c.objects[invItem{invType, hash}] = json.RawMessage(data)
+	return hash
+}
+
+func TestInventoryRelay(t *testing.T) {
+	nets, chains := inventoryLine(t)
+
+	// b fetches an announced tx from a; the node relays it to c only
+	tx := addObject(chains[0], InvTx, `{"amount":5}`)
+	nets[0].Announce(InvTx, tx)
+	waitFor(t, func() bool { return chains[1].HasObject(InvTx, tx) })
+	nets[1].Announce(InvTx, tx)
+	waitFor(t, func() bool { return chains[2].HasObject(InvTx, tx) })
+	for _, peer := range nets[1].peerSnapshot() {
+		if peer.knownInv.add(invItem{InvTx, tx}) {
+			t.Fatalf("b didn't record that %s has the tx", peer.Address)
+		}
+	}
+
+	// Accepted blocks are relayed by the network itself
+	block := addObject(chains[0], InvBlock, `{"height":1}`)
+	nets[0].Announce(InvBlock, block)
+	waitFor(t, func() bool { return chains[2].HasObject(InvBlock, block) })
+
+	// An invalid object counts against its sender
+	bad := addObject(chains[0], InvTx, `{"bad":true}`)
+	nets[0].Announce(InvTx, bad)
+	waitFor(t, func() bool {
+		nets[1].RLock()
+		defer nets[1].RUnlock()
+		score := nets[1].scores["127.0.0.1"]
+		return score != nil && score.points == -PenaltyInvalidTx
+	})
+	if chains[1].HasObject(InvTx, bad) {
+		t.Fatal("invalid tx was accepted")
+	}
+}
+
+func TestInventoryRequestRetry(t *testing.T) {
+	nets, chains := inventoryLine(t)
+	b := nets[1]
+
+	// a announces a tx it can't serve, then c announces it too
+	data := `{"amount":7}`
+	hash := addObject(chains[2], InvTx, data)
+	item := invItem{InvTx, hash}
+	nets[0].Announce(InvTx, hash)
+	waitFor(t, func() bool {
+		b.RLock()
+		defer b.RUnlock()
+		return b.invRequests[item] != nil
+	})
+	nets[2].Announce(InvTx, hash)
+	waitFor(t, func() bool {
+		b.RLock()
+		defer b.RUnlock()
+		return len(b.invRequests[item].holders) == 1
+	})
+
+	// Once the request to a times out, c is asked instead
+	b.Lock()
+	b.invRequests[item].sentAt = time.Now().Add(-invRequestTimeout)
+	b.Unlock()
+	b.retryRequest(item, false)
+	waitFor(t, func() bool { return chains[1].HasObject(InvTx, hash) })
+	waitFor(t, func() bool {
+		b.RLock()
+		defer b.RUnlock()
+		return b.invRequests[item] == nil
+	})
+}
+
+func TestInventoryRequestLimits(t *testing.T) {
+	n := NewNetwork("127.0.0.1:0", &testChain{})
+	a, b := &Peer{Address: "a:1"}, &Peer{Address: "b:1"}
+	item := func(i int) invItem { return invItem{InvTx, sha256.Sum256([]byte{byte(i), byte(i >> 8)})} }
+
+	// One peer can't have more than its share of requests outstanding
+	for i := 0; i < maxPeerInvRequests; i++ {
+		if !n.claimRequest(item(i), a) {
+			t.Fatalf("request %d refused", i)
+		}
+	}
+	if n.claimRequest(item(maxPeerInvRequests), a) {
+		t.Fatal("request past the per-peer limit claimed")
+	}
+	if !n.claimRequest(item(maxPeerInvRequests), b) {
+		t.Fatal("request to another peer refused")
+	}
+
+	// Answered requests free their slot
+	n.dropRequest(item(0))
+	if !n.claimRequest(item(maxPeerInvRequests+1), a) {
+		t.Fatal("request refused after one was answered")
+	}
+
+	// The overall limit holds across peers
+	for i := 0; len(n.invRequests) < maxInvRequests; i++ {
+		n.claimRequest(item(10000+i), &Peer{Address: "c:1"})
+	}
+	if n.claimRequest(item(9999), b) {
+		t.Fatal("request past the overall limit claimed")
+	}
+}
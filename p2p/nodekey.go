@@ -0,0 +1,63 @@
+package p2p
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Node identity keys
+//
+// A node is identified by a persistent ed25519 key, proven to peers by the
+// encrypted transport handshake (see noise.go). Its node ID is the hex
+// public key. A peer address may pin the key expected at that address as
+// "<node ID>@host:port"; such addresses work in -peer, the whitelist and
+// the peer store.
+
+// LoadOrCreateNodeKey reads the node identity key at path, creating it on
+// first use
+func LoadOrCreateNodeKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		seed := hex.EncodeToString(key.Seed()) + "\n"
+		if err := os.WriteFile(path, []byte(seed), 0600); err != nil {
+			return nil, fmt.Errorf("failed to save node key: %w", err)
+		}
+		return key, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	seed, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("invalid node key in %s", path)
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// NodeID returns the node ID of an identity key
+func NodeID(key ed25519.PublicKey) string {
+	return hex.EncodeToString(key)
+}
+
+// SplitPeerAddr splits "<node ID>@host:port" into the address and the
+// pinned identity key. Addresses without a node ID have no pinned key.
+func SplitPeerAddr(s string) (addr string, key ed25519.PublicKey, err error) {
+	id, addr, ok := strings.Cut(s, "@")
+	if !ok {
+		return s, nil, nil
+	}
+	raw, err := hex.DecodeString(id)
+	if err != nil || len(raw) != ed25519.PublicKeySize {
+		return "", nil, fmt.Errorf("invalid node ID in peer address %q", s)
+	}
+	return addr, ed25519.PublicKey(raw), nil
+}
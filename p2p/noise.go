@@ -0,0 +1,382 @@
+package p2p
+
+import (
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+)
+
+// Encrypted transport
+//
+// Before the handshake, both sides run Noise_XX_25519_ChaChaPoly_SHA256:
+//
+//	-> e
+//	<- e, ee, s, es, payload
+//	-> s, se, payload
+//
+// The static X25519 keys are per process; each payload is the sender's
+// ed25519 identity key and its signature over the sender's static key, so
+// the session is bound to the node identity. Every byte after the exchange,
+// handshake included, is sent in ChaChaPoly records of at most
+// noiseMaxMessage bytes, each prefixed with its 2-byte length.
+
+const (
+	noiseProtocol    = "Noise_XX_25519_ChaChaPoly_SHA256"
+	noisePrologue    = "archivas-p2p/1"
+	noiseSigContext  = "archivas-noise-static-key:"
+	noiseMaxMessage  = 65535
+	noiseTagSize     = chacha20poly1305.Overhead
+	noiseMaxPlain    = noiseMaxMessage - noiseTagSize
+	noisePayloadSize = ed25519.PublicKeySize + ed25519.SignatureSize
+)
+
+// ErrNoiseHandshake is returned when a peer breaks the key exchange or
+// proves an identity it isn't allowed to have
+var ErrNoiseHandshake = errors.New("encrypted transport handshake failed")
+
+// errHTTPRequest is returned for HTTP clients that reach the P2P port, such
+// as RPC-based IBD pointed at it. They are dropped without a penalty.
+var errHTTPRequest = errors.New("HTTP request on the P2P port")
+
+// noiseKeys are the keys this node authenticates with
+type noiseKeys struct {
+	identity ed25519.PrivateKey
+	static   [32]byte // X25519 private key
+	public   [32]byte // X25519 public key
+	sig      []byte   // identity signature over public
+}
+
+// newNoiseKeys generates a static key for identity
+func newNoiseKeys(identity ed25519.PrivateKey) *noiseKeys {
+	k := &noiseKeys{identity: identity}
+	copy(k.public[:], newX25519Key(k.static[:]))
+	k.sig = ed25519.Sign(identity, append([]byte(noiseSigContext), k.public[:]...))
+	return k
+}
+
+// ephemeralNoiseKeys returns keys for a random identity, used until
+// SetHandshakeConfig supplies the node's persistent one
+func ephemeralNoiseKeys() *noiseKeys {
+	_, identity, _ := ed25519.GenerateKey(rand.Reader)
+	return newNoiseKeys(identity)
+}
+
+// newX25519Key fills priv with a random private key and returns its public key
+func newX25519Key(priv []byte) []byte {
+	rand.Read(priv)
+	pub, _ := curve25519.X25519(priv, curve25519.Basepoint) // Fails only for low-order points
+	return pub
+}
+
+// noiseCipher is a Noise CipherState
+type noiseCipher struct {
+	aead  cipher.AEAD
+	nonce uint64
+}
+
+func newNoiseCipher(key []byte) *noiseCipher {
+	aead, _ := chacha20poly1305.New(key) // Key is always 32 bytes
+	return &noiseCipher{aead: aead}
+}
+
+func (c *noiseCipher) nextNonce() []byte {
+	var nonce [chacha20poly1305.NonceSize]byte
+	binary.LittleEndian.PutUint64(nonce[4:], c.nonce)
+	c.nonce++
+	return nonce[:]
+}
+
+func (c *noiseCipher) encrypt(ad, plaintext []byte) []byte {
+	return c.aead.Seal(nil, c.nextNonce(), plaintext, ad)
+}
+
+func (c *noiseCipher) decrypt(ad, ciphertext []byte) ([]byte, error) {
+	return c.aead.Open(nil, c.nextNonce(), ciphertext, ad)
+}
+
+// noiseState is a Noise SymmetricState
+type noiseState struct {
+	h, ck  [32]byte
+	cipher *noiseCipher // nil until the first MixKey
+}
+
+func newNoiseState() *noiseState {
+	s := &noiseState{}
+	copy(s.h[:], noiseProtocol)
+	s.ck = s.h
+	s.mixHash([]byte(noisePrologue))
+	return s
+}
+
+func (s *noiseState) mixHash(data []byte) {
+	hash := sha256.New()
+	hash.Write(s.h[:])
+	hash.Write(data)
+	copy(s.h[:], hash.Sum(nil))
+}
+
+func (s *noiseState) mixKey(ikm []byte) {
+	ck, key := noiseHKDF(s.ck[:], ikm)
+	s.ck = ck
+	s.cipher = newNoiseCipher(key[:])
+}
+
+func (s *noiseState) encryptAndHash(plaintext []byte) []byte {
+	out := plaintext
+	if s.cipher != nil {
+		out = s.cipher.encrypt(s.h[:], plaintext)
+	}
+	s.mixHash(out)
+	return out
+}
+
+func (s *noiseState) decryptAndHash(data []byte) ([]byte, error) {
+	out := data
+	if s.cipher != nil {
+		var err error
+		if out, err = s.cipher.decrypt(s.h[:], data); err != nil {
+			return nil, err
+		}
+	}
+	s.mixHash(data)
+	return out, nil
+}
+
+// split returns the initiator-to-responder and responder-to-initiator ciphers
+func (s *noiseState) split() (*noiseCipher, *noiseCipher) {
+	k1, k2 := noiseHKDF(s.ck[:], nil)
+	return newNoiseCipher(k1[:]), newNoiseCipher(k2[:])
+}
+
+// noiseHKDF is the two-output HKDF of the Noise spec
+func noiseHKDF(chainingKey, ikm []byte) (out1, out2 [32]byte) {
+	mac := hmac.New(sha256.New, chainingKey)
+	mac.Write(ikm)
+	temp := mac.Sum(nil)
+
+	mac = hmac.New(sha256.New, temp)
+	mac.Write([]byte{1})
+	copy(out1[:], mac.Sum(nil))
+
+	mac = hmac.New(sha256.New, temp)
+	mac.Write(out1[:])
+	mac.Write([]byte{2})
+	copy(out2[:], mac.Sum(nil))
+	return out1, out2
+}
+
+func x25519(priv, pub []byte) ([]byte, error) {
+	shared, err := curve25519.X25519(priv, pub)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNoiseHandshake, err)
+	}
+	return shared, nil
+}
+
+// secureConn carries a stream over Noise transport messages
+type secureConn struct {
+	conn    net.Conn
+	send    *noiseCipher
+	recv    *noiseCipher
+	pending []byte // Decrypted bytes not yet read
+}
+
+// secureHandshake runs the Noise XX exchange on conn and returns the
+// encrypted stream and the peer's proven identity key
+func secureHandshake(conn net.Conn, keys *noiseKeys, initiator bool) (*secureConn, ed25519.PublicKey, error) {
+	s := newNoiseState()
+	var ephemeral [32]byte
+	ephemeralPub := newX25519Key(ephemeral[:])
+	payload := append(append([]byte{}, keys.identity.Public().(ed25519.PublicKey)...), keys.sig...)
+
+	var remoteEphemeral, remoteStatic []byte
+	var remoteID ed25519.PublicKey
+	if initiator {
+		// -> e
+		s.mixHash(ephemeralPub)
+		s.mixHash(nil) // Empty payload
+		if err := writeNoiseMessage(conn, ephemeralPub); err != nil {
+			return nil, nil, err
+		}
+
+		// <- e, ee, s, es, payload
+		msg, err := readNoiseMessage(conn, 32+32+noiseTagSize+noisePayloadSize+noiseTagSize)
+		if err != nil {
+			return nil, nil, err
+		}
+		remoteEphemeral = msg[:32]
+		s.mixHash(remoteEphemeral)
+		if err := mixDH(s, ephemeral[:], remoteEphemeral); err != nil {
+			return nil, nil, err
+		}
+		if remoteStatic, err = s.decryptAndHash(msg[32 : 64+noiseTagSize]); err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrNoiseHandshake, err)
+		}
+		if err := mixDH(s, ephemeral[:], remoteStatic); err != nil {
+			return nil, nil, err
+		}
+		if remoteID, err = openNoisePayload(s, msg[64+noiseTagSize:], remoteStatic); err != nil {
+			return nil, nil, err
+		}
+
+		// -> s, se, payload
+		out := s.encryptAndHash(keys.public[:])
+		if err := mixDH(s, keys.static[:], remoteEphemeral); err != nil {
+			return nil, nil, err
+		}
+		out = append(out, s.encryptAndHash(payload)...)
+		if err := writeNoiseMessage(conn, out); err != nil {
+			return nil, nil, err
+		}
+		send, recv := s.split()
+		return &secureConn{conn: conn, send: send, recv: recv}, remoteID, nil
+	}
+
+	// -> e
+	msg, err := readNoiseMessage(conn, 32)
+	if err != nil {
+		return nil, nil, err
+	}
+	remoteEphemeral = msg
+	s.mixHash(remoteEphemeral)
+	s.mixHash(nil)
+
+	// <- e, ee, s, es, payload
+	s.mixHash(ephemeralPub)
+	out := append([]byte{}, ephemeralPub...)
+	if err := mixDH(s, ephemeral[:], remoteEphemeral); err != nil {
+		return nil, nil, err
+	}
+	out = append(out, s.encryptAndHash(keys.public[:])...)
+	if err := mixDH(s, keys.static[:], remoteEphemeral); err != nil {
+		return nil, nil, err
+	}
+	out = append(out, s.encryptAndHash(payload)...)
+	if err := writeNoiseMessage(conn, out); err != nil {
+		return nil, nil, err
+	}
+
+	// -> s, se, payload
+	msg, err = readNoiseMessage(conn, 32+noiseTagSize+noisePayloadSize+noiseTagSize)
+	if err != nil {
+		return nil, nil, err
+	}
+	if remoteStatic, err = s.decryptAndHash(msg[:32+noiseTagSize]); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrNoiseHandshake, err)
+	}
+	if err := mixDH(s, ephemeral[:], remoteStatic); err != nil {
+		return nil, nil, err
+	}
+	if remoteID, err = openNoisePayload(s, msg[32+noiseTagSize:], remoteStatic); err != nil {
+		return nil, nil, err
+	}
+	recv, send := s.split()
+	return &secureConn{conn: conn, send: send, recv: recv}, remoteID, nil
+}
+
+func mixDH(s *noiseState, priv, pub []byte) error {
+	shared, err := x25519(priv, pub)
+	if err != nil {
+		return err
+	}
+	s.mixKey(shared)
+	return nil
+}
+
+// openNoisePayload decrypts a handshake payload and checks that its
+// identity key signed the sender's static key
+func openNoisePayload(s *noiseState, data, remoteStatic []byte) (ed25519.PublicKey, error) {
+	payload, err := s.decryptAndHash(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNoiseHandshake, err)
+	}
+	id := ed25519.PublicKey(payload[:ed25519.PublicKeySize])
+	sig := payload[ed25519.PublicKeySize:]
+	if !ed25519.Verify(id, append([]byte(noiseSigContext), remoteStatic...), sig) {
+		return nil, fmt.Errorf("%w: identity signature invalid", ErrNoiseHandshake)
+	}
+	return id, nil
+}
+
+// writeNoiseMessage writes one length-prefixed Noise message
+func writeNoiseMessage(w io.Writer, msg []byte) error {
+	buf := make([]byte, 2+len(msg))
+	binary.BigEndian.PutUint16(buf, uint16(len(msg)))
+	copy(buf[2:], msg)
+	_, err := w.Write(buf)
+	return err
+}
+
+// readNoiseMessage reads one length-prefixed Noise message. Handshake
+// messages have a fixed size, so any other size is a protocol error.
+func readNoiseMessage(r io.Reader, size int) ([]byte, error) {
+	var prefix [2]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return nil, err
+	}
+	if n := int(binary.BigEndian.Uint16(prefix[:])); n != size {
+		if isUpper(prefix[0]) && isUpper(prefix[1]) { // "GET ", "POST", ...
+			return nil, errHTTPRequest
+		}
+		return nil, fmt.Errorf("%w: message of %d bytes, expected %d", ErrNoiseHandshake, n, size)
+	}
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// Write encrypts p into as many transport messages as it needs
+func (c *secureConn) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > noiseMaxPlain {
+			chunk = chunk[:noiseMaxPlain]
+		}
+		if err := writeNoiseMessage(c.conn, c.send.encrypt(nil, chunk)); err != nil {
+			return written, err
+		}
+		written += len(chunk)
+		p = p[len(chunk):]
+	}
+	return written, nil
+}
+
+// Read returns decrypted bytes, reading the next transport message when
+// none are pending
+func (c *secureConn) Read(p []byte) (int, error) {
+	for len(c.pending) == 0 {
+		var prefix [2]byte
+		if _, err := io.ReadFull(c.conn, prefix[:]); err != nil {
+			return 0, err
+		}
+		msg := make([]byte, binary.BigEndian.Uint16(prefix[:]))
+		if _, err := io.ReadFull(c.conn, msg); err != nil {
+			return 0, err
+		}
+		plain, err := c.recv.decrypt(nil, msg)
+		if err != nil {
+			return 0, fmt.Errorf("failed to decrypt transport message: %w", err)
+		}
+		c.pending = plain
+	}
+	n := copy(p, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+func isUpper(c byte) bool {
+	return c >= 'A' && c <= 'Z'
+}
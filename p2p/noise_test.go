@@ -0,0 +1,144 @@
+package p2p
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// securePair runs the key exchange over an in-memory connection
+func securePair(t *testing.T, clientKeys, serverKeys *noiseKeys) (client, server *secureConn, serverSaw, clientSaw ed25519.PublicKey) {
+	t.Helper()
+	a, b := net.Pipe()
+	t.Cleanup(func() { a.Close(); b.Close() })
+
+	type result struct {
+		conn *secureConn
+		id   ed25519.PublicKey
+		err  error
+	}
+	done := make(chan result)
+	go func() {
+		conn, id, err := secureHandshake(b, serverKeys, false)
+		done <- result{conn, id, err}
+	}()
+	client, clientSaw, err := secureHandshake(a, clientKeys, true)
+	if err != nil {
+		t.Fatalf("initiator failed: %v", err)
+	}
+	r := <-done
+	if r.err != nil {
+		t.Fatalf("responder failed: %v", r.err)
+	}
+	return client, r.conn, r.id, clientSaw
+}
+
+func TestSecureHandshake(t *testing.T) {
+	clientKeys, serverKeys := ephemeralNoiseKeys(), ephemeralNoiseKeys()
+	client, server, serverSaw, clientSaw := securePair(t, clientKeys, serverKeys)
+
+	if !serverSaw.Equal(clientKeys.identity.Public()) || !clientSaw.Equal(serverKeys.identity.Public()) {
+		t.Fatal("peers did not learn each other's identity keys")
+	}
+
+	// Messages larger than one transport record arrive intact both ways
+	msg := bytes.Repeat([]byte("archivas"), 20000)
+	go client.Write(msg)
+	got := make([]byte, len(msg))
+	if _, err := io.ReadFull(server, got); err != nil || !bytes.Equal(got, msg) {
+		t.Fatalf("server read %d bytes, err %v", len(got), err)
+	}
+	go server.Write([]byte("pong"))
+	got = make([]byte, 4)
+	if _, err := io.ReadFull(client, got); err != nil || string(got) != "pong" {
+		t.Fatalf("client read %q, err %v", got, err)
+	}
+
+	// A record altered in transit is rejected
+	record := client.send.encrypt(nil, []byte("hello"))
+	record[0] ^= 1
+	go writeNoiseMessage(client.conn, record)
+	if _, err := server.Read(make([]byte, 16)); err == nil {
+		t.Fatal("tampered record was accepted")
+	}
+}
+
+func TestSecureHandshakeForgedIdentity(t *testing.T) {
+	// The static key is signed by an identity other than the one presented
+	forged := ephemeralNoiseKeys()
+	_, other, _ := ed25519.GenerateKey(nil)
+	forged.identity = other
+
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+	go secureHandshake(b, forged, false)
+	if _, _, err := secureHandshake(a, ephemeralNoiseKeys(), true); !errors.Is(err, ErrNoiseHandshake) {
+		t.Fatalf("expected forged identity to be rejected, got %v", err)
+	}
+}
+
+func TestPinnedIdentity(t *testing.T) {
+	serverKey, err := LoadOrCreateNodeKey(filepath.Join(t.TempDir(), "node_key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewNetwork("127.0.0.1:0", &testChain{})
+	server.SetHandshakeConfig(HandshakeConfig{NodeKey: serverKey})
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+	addr := server.listener.Addr().String()
+
+	_, wrong, _ := ed25519.GenerateKey(nil)
+	client := NewNetwork("127.0.0.1:0", &testChain{})
+	if err := client.ConnectPeer(NodeID(wrong.Public().(ed25519.PublicKey)) + "@" + addr); err == nil {
+		t.Fatal("connected to a peer with the wrong identity key")
+	}
+
+	if err := client.ConnectPeer(server.NodeID() + "@" + addr); err != nil {
+		t.Fatalf("connect with pinned key failed: %v", err)
+	}
+	peer := client.peerSnapshot()[0]
+	if peer.Address != addr || NodeID(peer.IdentityKey) != server.NodeID() {
+		t.Fatalf("unexpected peer %s with node %s", peer.Address, NodeID(peer.IdentityKey))
+	}
+
+	// Whitelist entries pin keys too
+	pinned := NewNetwork("127.0.0.1:0", &testChain{})
+	pinned.SetIsolationConfig(IsolationConfig{PeerWhitelist: []string{NodeID(wrong.Public().(ed25519.PublicKey)) + "@" + addr}})
+	if err := pinned.ConnectPeer(addr); err == nil || !strings.Contains(err.Error(), "expected") {
+		t.Fatalf("expected whitelist pin to reject the server, got %v", err)
+	}
+}
+
+func TestLoadOrCreateNodeKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "node_key")
+	first, err := LoadOrCreateNodeKey(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := LoadOrCreateNodeKey(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !first.Equal(second) {
+		t.Fatal("node key changed between loads")
+	}
+}
+
+func TestSecureHandshakeHTTPProbe(t *testing.T) {
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+	go a.Write([]byte("GET /blocks/range HTTP/1.1\r\n\r\n"))
+	if _, _, err := secureHandshake(b, ephemeralNoiseKeys(), false); !errors.Is(err, errHTTPRequest) {
+		t.Fatalf("expected HTTP probe to be recognized, got %v", err)
+	}
+}
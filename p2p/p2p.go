@@ -2,13 +2,18 @@ package p2p
 
 import (
 	"bufio"
+	"crypto/ed25519"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/ArchivasNetwork/archivas/network"
 )
 
 // Peer represents a connected peer
@@ -16,10 +21,44 @@ type Peer struct {
 	Address    string
 	Conn       net.Conn
 	LastSeen   time.Time
-	Height     uint64
 	Reader     *bufio.Reader
 	Writer     *bufio.Writer
 	writeMutex sync.Mutex
+
+	// Advertised in the peer's handshake
+	Version  string
+	NodeName string
+	RPCPort  int
+
+	// Proven by the encrypted transport handshake
+	IdentityKey ed25519.PublicKey
+
+	// Message rate, tracked by the connection's read loop
+	floodStart time.Time
+	floodCount int
+
+	// Objects known to be on the other side, and the number of objects
+	// requested from it (guarded by the Network lock; see inventory.go)
+	knownInv     seenSet
+	invRequested int
+
+	// Best height the peer reported, set by its read loop and read by sync
+	height atomic.Uint64
+}
+
+// Height returns the best height the peer has reported
+func (p *Peer) Height() uint64 {
+	return p.height.Load()
+}
+
+// raiseHeight records that the peer has a block at height h
+func (p *Peer) raiseHeight(h uint64) {
+	for {
+		cur := p.height.Load()
+		if h <= cur || p.height.CompareAndSwap(cur, h) {
+			return
+		}
+	}
 }
 
 // Network handles peer-to-peer networking
@@ -55,6 +94,28 @@ type Network struct {
 	checkpointHeight uint64            // Chain checkpoint height
 	checkpointHash   [32]byte          // Chain checkpoint hash
 	genesisHash      [32]byte          // Genesis block hash for validation
+
+	// v1.3.0: Headers-first sync state
+	headerSync *headerSync
+
+	// Handshake identity: peers must match profile and genesisHash
+	profile     network.NetworkProfile
+	nodeVersion string
+	nodeName    string
+	rpcPort     int
+	noise       *noiseKeys
+
+	// Identity keys pinned by whitelist entries, keyed like peerWhitelist
+	pinnedKeys map[string]ed25519.PublicKey
+
+	// Misbehavior scores and bans, keyed by host
+	banThreshold int
+	banDuration  time.Duration
+	scores       map[string]*hostScore
+	bans         map[string]Ban
+
+	// Announced objects being requested from peers
+	invRequests map[invItem]*invRequest
 }
 
 // NodeHandler interface for node callbacks
@@ -68,6 +129,18 @@ type NodeHandler interface {
 	VerifyAndApplyBlock(blockJSON json.RawMessage) error
 	// v1.1.1: Batch block requests for IBD
 	OnBlocksRangeRequest(fromHeight uint64, maxBlocks uint32) (blocks []json.RawMessage, tipHeight uint64, eof bool, err error)
+	// v1.3.0: Headers-first sync
+	OnHeadersRequest(fromHeight uint64, maxHeaders uint32) (headers []json.RawMessage, tipHeight uint64, err error)
+	HeaderHeight() uint64
+	ConnectHeaders(headers []json.RawMessage) (headerHeight uint64, err error)
+	ConnectBody(blockJSON json.RawMessage) error
+	BodyCommitHeight() uint64 // First height whose header commits to the block's transactions
+	// Inventory: objects by type (InvBlock or InvTx) and hash. AcceptObject
+	// validates a block and connects it, or a transaction and adds it to the
+	// mempool.
+	HasObject(invType string, hash [32]byte) bool
+	GetObject(invType string, hash [32]byte) (data json.RawMessage, ok bool)
+	AcceptObject(invType string, hash [32]byte, data json.RawMessage) error
 }
 
 // GossipConfig holds configuration for peer gossip
@@ -103,10 +176,20 @@ func NewNetwork(listenAddr string, handler NodeHandler) *Network {
 		ibdInflight:      0,
 		ibdMaxConcurrent: 2,
 		ibdBatchSize:     512,
+		headerSync:       newHeaderSync(),
 
 		// v1.2.0: Peer isolation (default: disabled)
 		noPeerDiscovery: false,
 		peerWhitelist:   make(map[string]bool),
+		pinnedKeys:      make(map[string]ed25519.PublicKey),
+		noise:           ephemeralNoiseKeys(),
+
+		banThreshold: DefaultBanThreshold,
+		banDuration:  DefaultBanDuration,
+		scores:       make(map[string]*hostScore),
+		bans:         make(map[string]Ban),
+
+		invRequests: make(map[invItem]*invRequest),
 	}
 }
 
@@ -180,15 +263,26 @@ func (n *Network) SetIsolationConfig(cfg IsolationConfig) {
 	}
 }
 
-// addToWhitelistLocked adds an address to the whitelist (must be called with lock held)
-func (n *Network) addToWhitelistLocked(addr string) {
-	addr = strings.TrimSpace(addr)
+// addToWhitelistLocked adds an address to the whitelist, pinning the identity
+// key of a "<node ID>@host:port" entry (must be called with lock held)
+func (n *Network) addToWhitelistLocked(entry string) {
+	addr, key, err := SplitPeerAddr(strings.TrimSpace(entry))
+	if err != nil {
+		log.Printf("[p2p] ignoring whitelist entry: %v", err)
+		return
+	}
 	if addr == "" {
 		return
 	}
+	allow := func(a string) {
+		n.peerWhitelist[a] = true
+		if key != nil {
+			n.pinnedKeys[a] = key
+		}
+	}
 
 	// Add the original address
-	n.peerWhitelist[addr] = true
+	allow(addr)
 
 	// Try to resolve DNS and add resolved IPs
 	host, port, err := net.SplitHostPort(addr)
@@ -200,7 +294,7 @@ func (n *Network) addToWhitelistLocked(addr string) {
 
 	// Add the host (without port)
 	if host != "" {
-		n.peerWhitelist[host] = true
+		allow(host)
 	}
 
 	// Resolve hostname to IPs
@@ -208,14 +302,27 @@ func (n *Network) addToWhitelistLocked(addr string) {
 	if err == nil {
 		for _, ip := range ips {
 			ipStr := ip.String()
-			n.peerWhitelist[ipStr] = true
+			allow(ipStr)
 			if port != "" {
-				n.peerWhitelist[net.JoinHostPort(ipStr, port)] = true
+				allow(net.JoinHostPort(ipStr, port))
 			}
 		}
 	}
 
-	log.Printf("[p2p] whitelisted: %s", addr)
+	if key != nil {
+		log.Printf("[p2p] whitelisted: %s (node %s)", addr, NodeID(key))
+	} else {
+		log.Printf("[p2p] whitelisted: %s", addr)
+	}
+}
+
+// pinnedKeyLocked returns the identity key the whitelist pins for an address
+// or its host, if any (must be called with lock held)
+func (n *Network) pinnedKeyLocked(addr string) ed25519.PublicKey {
+	if key, ok := n.pinnedKeys[addr]; ok {
+		return key
+	}
+	return n.pinnedKeys[peerHost(addr)]
 }
 
 // shouldAllowConnection checks if a connection should be allowed based on whitelist
@@ -256,6 +363,10 @@ func (n *Network) gateOutbound(addr string) bool {
 		log.Printf("[GATER] rejected dial to %s: not whitelisted", addr)
 		return false
 	}
+	if n.isBannedLocked(addr) {
+		log.Printf("[GATER] rejected dial to %s: banned", addr)
+		return false
+	}
 	return true
 }
 
@@ -269,6 +380,10 @@ func (n *Network) gateInbound(conn net.Conn) bool {
 		log.Printf("[GATER] rejected inbound from %s: not whitelisted", remoteAddr)
 		return false
 	}
+	if n.isBannedLocked(remoteAddr) {
+		log.Printf("[GATER] rejected inbound from %s: banned", remoteAddr)
+		return false
+	}
 	return true
 }
 
@@ -281,6 +396,9 @@ func (n *Network) SetPeerStore(store PeerStore) {
 	n.Lock()
 	defer n.Unlock()
 	n.peerStore = store
+	if store != nil {
+		n.loadBansLocked(store)
+	}
 	
 	// Auto-dial stored peers (unless discovery is disabled)
 	if store != nil && !noPeerDiscovery {
@@ -394,31 +512,41 @@ func (n *Network) Stop() error {
 	return nil
 }
 
-// ConnectPeer connects to a remote peer
+// ConnectPeer connects to a remote peer. An address of the form
+// "<node ID>@host:port" only accepts the peer with that identity key.
 func (n *Network) ConnectPeer(address string) error {
+	addr, pinned, err := SplitPeerAddr(address)
+	if err != nil {
+		return err
+	}
+
 	// Gate outbound connections
-	if !n.gateOutbound(address) {
-		return fmt.Errorf("peer not whitelisted: %s", address)
+	if !n.gateOutbound(addr) {
+		return fmt.Errorf("peer not allowed: %s", addr)
 	}
 
-	log.Printf("[p2p] connecting to peer %s", address)
+	log.Printf("[p2p] connecting to peer %s", addr)
 
-	conn, err := net.DialTimeout("tcp", address, 10*time.Second)
+	conn, err := net.DialTimeout("tcp", addr, 10*time.Second)
 	if err != nil {
 		return fmt.Errorf("failed to connect to peer: %w", err)
 	}
 
 	peer := &Peer{
-		Address:  address,
+		Address:  addr,
 		Conn:     conn,
 		LastSeen: time.Now(),
-		Reader:   bufio.NewReader(conn),
-		Writer:   bufio.NewWriter(conn),
+	}
+
+	// Peers with the wrong identity, chain or protocol version are dropped before use
+	if err := n.handshake(peer, true, pinned); err != nil {
+		conn.Close()
+		return fmt.Errorf("handshake with %s failed: %w", addr, err)
 	}
 
 	// CRITICAL: Register peer BEFORE starting handler
 	n.Lock()
-	n.peers[address] = peer
+	n.peers[addr] = peer
 	peerCount := len(n.peers)
 	
 	// Persist to peer store
@@ -427,7 +555,7 @@ func (n *Network) ConnectPeer(address string) error {
 	}
 	n.Unlock()
 
-	log.Printf("[p2p] connected to peer %s (total peers: %d, persisted)", address, peerCount)
+	log.Printf("[p2p] connected to peer %s (total peers: %d, persisted)", addr, peerCount)
 
 	// Start handling messages from this peer
 	go n.handlePeer(peer)
@@ -460,19 +588,26 @@ func (n *Network) acceptLoop() {
 			Address:  conn.RemoteAddr().String(),
 			Conn:     conn,
 			LastSeen: time.Now(),
-			Reader:   bufio.NewReader(conn),
-			Writer:   bufio.NewWriter(conn),
 		}
 
-		// CRITICAL: Register peer BEFORE starting handler
-		n.Lock()
-		n.peers[peer.Address] = peer
-		peerCount := len(n.peers)
-		n.Unlock()
+		go func() {
+			// Peers with the wrong identity, chain or protocol version are dropped before use
+			if err := n.handshake(peer, false, nil); err != nil {
+				log.Printf("[p2p] rejected inbound %s: handshake failed: %v", peer.Address, err)
+				conn.Close()
+				return
+			}
+
+			// CRITICAL: Register peer BEFORE starting handler
+			n.Lock()
+			n.peers[peer.Address] = peer
+			peerCount := len(n.peers)
+			n.Unlock()
 
-		log.Printf("[p2p] accepted connection from %s (total peers: %d)", peer.Address, peerCount)
+			log.Printf("[p2p] accepted connection from %s (total peers: %d)", peer.Address, peerCount)
 
-		go n.handlePeer(peer)
+			n.handlePeer(peer)
+		}()
 	}
 }
 
@@ -489,56 +624,24 @@ func (n *Network) handlePeer(peer *Peer) {
 		log.Printf("[p2p] peer %s disconnected (remaining peers: %d)", peer.Address, peerCount)
 	}()
 
-	// Peek at first bytes to detect HTTP requests
-	peekBytes, err := peer.Reader.Peek(4)
-	if err == nil && len(peekBytes) >= 4 {
-		// Check if it looks like an HTTP request (GET, POST, HEAD, etc.)
-		firstBytes := string(peekBytes[:4])
-		if firstBytes == "GET " || firstBytes == "POST" || firstBytes == "HEAD" ||
-			firstBytes == "PUT " || firstBytes == "DELE" || firstBytes == "OPTI" ||
-			firstBytes == "PATC" || firstBytes == "HTTP" {
-			// This is an HTTP request, not a P2P message - close connection silently
-			// Read a bit more to consume the request and avoid errors
-			buf := make([]byte, 512)
-			peer.Reader.Read(buf)
-			return
-		}
-	}
-
 	for {
-		// Read message (newline-delimited JSON)
-		line, err := peer.Reader.ReadBytes('\n')
+		// Any framing error (HTTP probes, oversized or corrupt frames) drops the peer
+		msg, err := readFrame(peer.Reader)
 		if err != nil {
 			log.Printf("[p2p] read error from %s: %v", peer.Address, err)
+			if isFrameError(err) {
+				n.misbehaving(peer, PenaltyMalformed, err.Error())
+			}
 			return
 		}
-
-		// Check if line starts with HTTP method (additional safety check)
-		lineStr := string(line)
-		if len(lineStr) >= 4 && (lineStr[:4] == "GET " || lineStr[:4] == "POST" ||
-			lineStr[:4] == "HEAD" || lineStr[:4] == "HTTP") {
-			// HTTP request detected - close connection
-			return
-		}
-
-		var msg Message
-		if err := json.Unmarshal(line, &msg); err != nil {
-			// Check if error is due to HTTP request
-			errStr := err.Error()
-			if strings.Contains(errStr, "invalid character 'G'") ||
-				strings.Contains(errStr, "invalid character 'H'") ||
-				strings.Contains(errStr, "invalid character 'P'") {
-				// Likely an HTTP request - close connection silently
-				return
-			}
-			log.Printf("[p2p] invalid message from %s: %v", peer.Address, err)
+		if n.flooding(peer) {
 			continue
 		}
 
 		peer.LastSeen = time.Now()
 
 		// Handle message
-		n.handleMessage(peer, &msg)
+		n.handleMessage(peer, msg)
 	}
 }
 
@@ -549,60 +652,27 @@ func (n *Network) SendMessage(peer *Peer, msgType MessageType, payload interface
 		return err
 	}
 
-	msg := Message{
-		Type:    msgType,
-		Payload: payloadJSON,
-	}
-
-	data, err := json.Marshal(msg)
-	if err != nil {
-		return err
-	}
-
 	peer.writeMutex.Lock()
 	defer peer.writeMutex.Unlock()
 
-	// Write newline-delimited JSON
-	if _, err := peer.Writer.Write(append(data, '\n')); err != nil {
+	if err := writeFrame(peer.Writer, msgType, payloadJSON); err != nil {
 		return err
 	}
 
 	return peer.Writer.Flush()
 }
 
-// BroadcastNewBlock announces a new block to all peers
+// BroadcastNewBlock announces a new block to all peers (see inventory.go)
 func (n *Network) BroadcastNewBlock(height uint64, hash [32]byte) {
-	msg := NewBlockMessage{
-		Height: height,
-		Hash:   hash,
-	}
-
-	// CRITICAL: Use snapshot to avoid holding lock during sends
-	n.RLock()
-	peers := make([]*Peer, 0, len(n.peers))
-	for _, peer := range n.peers {
-		peers = append(peers, peer)
-	}
-	peerCount := len(n.peers)
-	n.RUnlock()
-
-	// Log peer count BEFORE sending
-	log.Printf("[p2p] broadcasting block %d to %d peers (map has %d entries)", height, len(peers), peerCount)
-
-	for _, peer := range peers {
-		if err := n.SendMessage(peer, MsgTypeNewBlock, msg); err != nil {
-			log.Printf("[p2p] failed to send NEW_BLOCK to %s: %v", peer.Address, err)
-		} else {
-			log.Printf("[p2p] sent NEW_BLOCK height=%d to %s", height, peer.Address)
-		}
-	}
-
-	log.Printf("[p2p] broadcast complete: block %d sent to %d/%d peers", height, len(peers), peerCount)
+	log.Printf("[p2p] announcing block %d %x to %d peers", height, hash[:8], n.GetPeerCount())
+	n.Announce(InvBlock, hash)
 }
 
 // handleMessage processes incoming messages
 func (n *Network) handleMessage(peer *Peer, msg *Message) {
 	switch msg.Type {
+	case MsgTypeHandshake:
+		n.misbehaving(peer, PenaltySpam, "repeated handshake")
 	case MsgTypePing:
 		n.handlePing(peer, msg.Payload)
 	case MsgTypePong:
@@ -623,6 +693,16 @@ func (n *Network) handleMessage(peer *Peer, msg *Message) {
 		n.handleRequestBlocks(peer, msg.Payload)
 	case MsgTypeBlocksBatch:
 		n.handleBlocksBatch(peer, msg.Payload)
+	case MsgTypeGetHeaders:
+		n.handleGetHeaders(peer, msg.Payload)
+	case MsgTypeHeaders:
+		n.handleHeaders(peer, msg.Payload)
+	case MsgTypeInv:
+		n.handleInv(peer, msg.Payload)
+	case MsgTypeReq:
+		n.handleReq(peer, msg.Payload)
+	case MsgTypeRes:
+		n.handleRes(peer, msg.Payload)
 	default:
 		log.Printf("[p2p] unknown message type %d from %s", msg.Type, peer.Address)
 	}
@@ -632,7 +712,7 @@ func (n *Network) handleMessage(peer *Peer, msg *Message) {
 func (n *Network) handleGossipPeers(peer *Peer, payload json.RawMessage) {
 	var gossip GossipPeersMessage
 	if err := json.Unmarshal(payload, &gossip); err != nil {
-		log.Printf("[p2p] invalid GOSSIP_PEERS from %s", peer.Address)
+		n.misbehaving(peer, PenaltyMalformed, "invalid GOSSIP_PEERS")
 		return
 	}
 	
@@ -678,8 +758,9 @@ func (n *Network) handleGossipPeers(peer *Peer, payload json.RawMessage) {
 	
 	// Try connecting to new addresses with rate limiting
 	for _, addr := range gossip.Addrs {
+		plain, _, _ := SplitPeerAddr(addr) // Peers are registered without their node ID
 		n.RLock()
-		_, connected := n.peers[addr]
+		_, connected := n.peers[plain]
 		_, dialing := n.dialing[addr]
 		peerCount := len(n.peers)
 		n.RUnlock()
@@ -720,7 +801,10 @@ func (n *Network) handleGossipPeers(peer *Peer, payload json.RawMessage) {
 
 func (n *Network) handlePing(peer *Peer, payload json.RawMessage) {
 	var ping PingMessage
-	json.Unmarshal(payload, &ping)
+	if err := json.Unmarshal(payload, &ping); err != nil {
+		n.misbehaving(peer, PenaltyMalformed, "invalid PING")
+		return
+	}
 
 	pong := PongMessage{Timestamp: time.Now().Unix()}
 	n.SendMessage(peer, MsgTypePong, pong)
@@ -734,11 +818,12 @@ func (n *Network) handlePong(peer *Peer, payload json.RawMessage) {
 func (n *Network) handleNewBlock(peer *Peer, payload json.RawMessage) {
 	var newBlock NewBlockMessage
 	if err := json.Unmarshal(payload, &newBlock); err != nil {
-		log.Printf("[p2p] invalid NEW_BLOCK from %s", peer.Address)
+		n.misbehaving(peer, PenaltyMalformed, "invalid NEW_BLOCK")
 		return
 	}
 
 	log.Printf("[p2p] received NEW_BLOCK height=%d from %s", newBlock.Height, peer.Address)
+	peer.raiseHeight(newBlock.Height)
 
 	// Notify node
 	if n.nodeHandler != nil {
@@ -749,7 +834,7 @@ func (n *Network) handleNewBlock(peer *Peer, payload json.RawMessage) {
 func (n *Network) handleGetBlock(peer *Peer, payload json.RawMessage) {
 	var getBlock GetBlockMessage
 	if err := json.Unmarshal(payload, &getBlock); err != nil {
-		log.Printf("[p2p] invalid GET_BLOCK from %s", peer.Address)
+		n.misbehaving(peer, PenaltyMalformed, "invalid GET_BLOCK")
 		return
 	}
 
@@ -776,15 +861,23 @@ func (n *Network) handleGetBlock(peer *Peer, payload json.RawMessage) {
 func (n *Network) handleBlockData(peer *Peer, payload json.RawMessage) {
 	var blockData BlockDataMessage
 	if err := json.Unmarshal(payload, &blockData); err != nil {
-		log.Printf("[p2p] invalid BLOCK_DATA from %s", peer.Address)
+		n.misbehaving(peer, PenaltyMalformed, "invalid BLOCK_DATA")
 		return
 	}
 
 	log.Printf("[p2p] received BLOCK_DATA height=%d from %s", blockData.Height, peer.Address)
+	if n.distrusted(peer) {
+		log.Printf("[p2p] ignoring block %d from distrusted peer %s", blockData.Height, peer.Address)
+		return
+	}
 	
 	// Try to apply the block
 	if err := n.nodeHandler.VerifyAndApplyBlock(blockData.BlockJSON); err != nil {
 		log.Printf("[p2p] failed to apply block %d: %v", blockData.Height, err)
+		if errors.Is(err, ErrInvalidBlock) {
+			n.misbehaving(peer, PenaltyInvalidBlock, err.Error())
+			return
+		}
 		
 		// If block is out of order, queue it and request missing blocks
 		localHeight := n.nodeHandler.LocalHeight()
@@ -823,7 +916,7 @@ func (n *Network) handleBlockData(peer *Peer, payload json.RawMessage) {
 	
 	// If peer is still ahead, request next block
 	localHeight := n.nodeHandler.LocalHeight()
-	if peer.Height > localHeight {
+	if peer.Height() > localHeight {
 		nextHeight := localHeight + 1
 		if n.syncState.WantBlock(nextHeight) {
 			req := GetBlockMessage{Height: nextHeight}
@@ -847,12 +940,12 @@ func (n *Network) handleGetStatus(peer *Peer, payload json.RawMessage) {
 func (n *Network) handleStatus(peer *Peer, payload json.RawMessage) {
 	var status StatusMessage
 	if err := json.Unmarshal(payload, &status); err != nil {
-		log.Printf("[p2p] invalid STATUS from %s", peer.Address)
+		n.misbehaving(peer, PenaltyMalformed, "invalid STATUS")
 		return
 	}
 
 	log.Printf("[p2p] peer %s status: height=%d difficulty=%d", peer.Address, status.Height, status.Difficulty)
-	peer.Height = status.Height
+	peer.height.Store(status.Height)
 }
 
 // GetPeerCount returns number of connected peers
@@ -907,8 +1000,8 @@ func (n *Network) SyncFromPeers(currentHeight uint64) (highestPeer uint64, err e
 
 	// Find highest peer
 	for _, peer := range n.peers {
-		if peer.Height > highest {
-			highest = peer.Height
+		if peer.Height() > highest {
+			highest = peer.Height()
 		}
 	}
 
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"os"
 	"sync"
+	"time"
 )
 
 // PeerStore interface for peer persistence
@@ -11,6 +12,11 @@ type PeerStore interface {
 	Add(addr string) error
 	Remove(addr string) error
 	List() ([]string, error)
+
+	// Bans survive restarts until they expire
+	Ban(ban Ban) error
+	Unban(host string) error
+	Bans() ([]Ban, error)
 }
 
 // FilePeerStore implements PeerStore using a JSON file
@@ -22,6 +28,7 @@ type FilePeerStore struct {
 
 type peerStoreData struct {
 	Peers []string `json:"peers"`
+	Bans  []Ban    `json:"bans,omitempty"`
 }
 
 // NewFilePeerStore creates a new file-based peer store
@@ -87,6 +94,48 @@ func (s *FilePeerStore) List() ([]string, error) {
 	return peers, nil
 }
 
+// Ban records a ban, replacing any earlier ban of the same host
+func (s *FilePeerStore) Ban(ban Ban) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.Bans = append(s.activeBans(ban.Host), ban)
+	return s.save()
+}
+
+// Unban removes the ban of a host, or every ban if host is empty
+func (s *FilePeerStore) Unban(host string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if host == "" {
+		s.data.Bans = nil
+	} else {
+		s.data.Bans = s.activeBans(host)
+	}
+	return s.save()
+}
+
+// Bans returns the bans that haven't expired
+func (s *FilePeerStore) Bans() ([]Ban, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.activeBans(""), nil
+}
+
+// activeBans returns unexpired bans other than those of host
+func (s *FilePeerStore) activeBans(host string) []Ban {
+	now := time.Now()
+	bans := make([]Ban, 0, len(s.data.Bans))
+	for _, b := range s.data.Bans {
+		if b.Host != host && now.Before(b.Until) {
+			bans = append(bans, b)
+		}
+	}
+	return bans
+}
+
 // load reads peers from disk
 func (s *FilePeerStore) load() error {
 	data, err := os.ReadFile(s.path)
@@ -25,6 +25,9 @@ const (
 	// v1.1.1: Efficient IBD
 	MsgTypeRequestBlocks MessageType = 13 // Request block range
 	MsgTypeBlocksBatch   MessageType = 14 // Batch of blocks
+	// v1.3.0: Headers-first sync
+	MsgTypeGetHeaders MessageType = 15 // Request header range
+	MsgTypeHeaders    MessageType = 16 // Batch of headers
 )
 
 // Message represents a P2P protocol message
@@ -92,6 +95,7 @@ type ReqMessage struct {
 // ResMessage contains requested data
 type ResMessage struct {
 	Type string          `json:"type"` // "block" or "tx"
+	Hash string          `json:"hash"` // hex-encoded hash of the data
 	Data json.RawMessage `json:"data"` // actual data
 }
 
@@ -118,6 +122,21 @@ type BlocksBatchMessage struct {
 	EOF        bool              `json:"eof"`        // true if this is the last batch (caught up)
 }
 
+// GetHeadersMessage requests a range of block headers
+// v1.3.0: Headers-first sync
+type GetHeadersMessage struct {
+	FromHeight uint64 `json:"fromHeight"` // Starting height (inclusive)
+	MaxHeaders uint32 `json:"maxHeaders"` // Batch size hint (capped by the sender)
+}
+
+// HeadersMessage contains a batch of block headers (blocks without transactions)
+// v1.3.0: Response to GetHeaders
+type HeadersMessage struct {
+	FromHeight uint64            `json:"fromHeight"` // First header height in this batch
+	Headers    []json.RawMessage `json:"headers"`    // Header data (JSON serialized)
+	TipHeight  uint64            `json:"tipHeight"`  // Sender's current tip
+}
+
 // HandshakeMessage validates peer compatibility before allowing connection
 // v1.1.1: Prevents incompatible nodes from connecting
 // Phase 3: Enhanced with chain identity fields
@@ -136,4 +155,5 @@ type HandshakeMessage struct {
 	// Informational fields
 	NodeVersion string `json:"nodeVersion"` // For logging/debugging
 	NodeName    string `json:"nodeName"`    // Optional node name
+	RPCPort     int    `json:"rpcPort"`     // RPC port on the peer's host (0: not served)
 }
@@ -0,0 +1,227 @@
+package p2p
+
+import (
+	"errors"
+	"log"
+	"net"
+	"sort"
+	"time"
+)
+
+// Peer scoring and bans
+//
+// Every host starts at a score of 0 and loses points when one of its
+// connections misbehaves: invalid blocks and transactions, failed
+// handshakes, malformed messages and message floods. Scores are kept per
+// host (not per connection), so reconnecting doesn't reset them, and
+// recover a point every scoreRecovery back up to 0, so occasional mistakes
+// by an honest host don't add up to a ban. A host whose score falls to the
+// ban threshold is disconnected and refused for the ban duration. The
+// default threshold takes more than one invalid block to reach. Blocks and
+// headers from a host halfway to a ban are ignored rather than validated.
+// Bans are persisted in the peer store and survive restarts.
+
+const (
+	PenaltyInvalidBlock = 20 // Block or header that fails validation
+	PenaltyInvalidTx    = 10 // Transaction that can never be valid
+	PenaltyBadHandshake = 10 // Handshake for another chain or protocol, or none
+	PenaltyMalformed    = 10 // Corrupt frame or undecodable payload
+	PenaltySpam         = 5  // Message flood
+
+	DefaultBanThreshold = -60
+	DefaultBanDuration  = 30 * time.Minute
+
+	scoreRecovery = time.Minute // A host regains one point per interval
+
+	floodWindow      = 10 * time.Second
+	floodMaxMessages = 1000 // Messages accepted per floodWindow per connection
+)
+
+// ErrInvalidBlock marks NodeHandler errors for blocks and headers that fail
+// validation, as opposed to ones that merely can't be connected yet. Only
+// these count against the peer that sent them.
+var ErrInvalidBlock = errors.New("invalid block")
+
+// ErrInvalidTx marks NodeHandler errors for transactions that can never be
+// valid, such as bad signatures, as opposed to ones that merely don't apply
+// to the current state. Only these count against the peer that sent them.
+var ErrInvalidTx = errors.New("invalid transaction")
+
+// Ban refuses connections to and from a host until it expires
+type Ban struct {
+	Host   string    `json:"host"`
+	Until  time.Time `json:"until"`
+	Reason string    `json:"reason"`
+}
+
+// hostScore is the misbehavior score of a host
+type hostScore struct {
+	points    int       // Zero or negative
+	recovered time.Time // When points last recovered
+}
+
+// penalize recovers the points due since the last recovery, then takes
+// penalty points
+func (s *hostScore) penalize(penalty int, now time.Time) int {
+	intervals := now.Sub(s.recovered) / scoreRecovery
+	s.points = min(s.points+int(intervals), 0)
+	s.recovered = s.recovered.Add(intervals * scoreRecovery)
+	s.points -= penalty
+	return s.points
+}
+
+// BanConfig sets when and for how long misbehaving hosts are banned
+type BanConfig struct {
+	Threshold int           // Ban at or below this score (negative)
+	Duration  time.Duration // How long a ban lasts
+}
+
+// SetBanConfig updates the ban threshold and duration
+func (n *Network) SetBanConfig(cfg BanConfig) {
+	n.Lock()
+	defer n.Unlock()
+
+	n.banThreshold = cfg.Threshold
+	n.banDuration = cfg.Duration
+}
+
+// misbehaving takes penalty points from the peer's host, banning and
+// disconnecting it once its score reaches the ban threshold
+func (n *Network) misbehaving(peer *Peer, penalty int, reason string) {
+	host := peerHost(peer.Address)
+
+	n.Lock()
+	now := time.Now()
+	if n.scores[host] == nil {
+		n.scores[host] = &hostScore{recovered: now}
+	}
+	score := n.scores[host].penalize(penalty, now)
+	if score > n.banThreshold {
+		n.Unlock()
+		log.Printf("[p2p] peer %s misbehaving (%s): score %d", peer.Address, reason, score)
+		return
+	}
+
+	ban := Ban{Host: host, Until: now.Add(n.banDuration), Reason: reason}
+	n.bans[host] = ban
+	delete(n.scores, host)
+	var conns []net.Conn
+	for _, p := range n.peers {
+		if peerHost(p.Address) == host {
+			conns = append(conns, p.Conn)
+		}
+	}
+	store := n.peerStore
+	n.Unlock()
+
+	log.Printf("[p2p] banning %s until %s: %s (score %d)", host, ban.Until.Format(time.RFC3339), reason, score)
+	if store != nil {
+		if err := store.Ban(ban); err != nil {
+			log.Printf("[p2p] failed to persist ban of %s: %v", host, err)
+		}
+	}
+
+	// Closing the connections ends their handlePeer loops, which unregister them
+	peer.Conn.Close()
+	for _, conn := range conns {
+		conn.Close()
+	}
+}
+
+// distrusted reports whether the peer's host has lost half the points that
+// lead to a ban. Blocks and headers from such a peer aren't validated, since
+// each can cost a VDF verification.
+func (n *Network) distrusted(peer *Peer) bool {
+	n.Lock()
+	defer n.Unlock()
+
+	score := n.scores[peerHost(peer.Address)]
+	return score != nil && score.penalize(0, time.Now()) <= n.banThreshold/2
+}
+
+// isBannedLocked reports whether addr's host is banned (must be called with lock held)
+func (n *Network) isBannedLocked(addr string) bool {
+	ban, ok := n.bans[peerHost(addr)]
+	return ok && time.Now().Before(ban.Until)
+}
+
+// Bans returns the hosts currently banned
+func (n *Network) Bans() []Ban {
+	n.Lock()
+	defer n.Unlock()
+
+	now := time.Now()
+	bans := make([]Ban, 0, len(n.bans))
+	for host, ban := range n.bans {
+		if !now.Before(ban.Until) {
+			delete(n.bans, host)
+			continue
+		}
+		bans = append(bans, ban)
+	}
+	sort.Slice(bans, func(i, j int) bool { return bans[i].Host < bans[j].Host })
+	return bans
+}
+
+// ClearBans lifts the ban of a host, or every ban if host is empty, and
+// returns how many were lifted
+func (n *Network) ClearBans(host string) int {
+	n.Lock()
+	cleared := 0
+	for h := range n.bans {
+		if host == "" || h == host {
+			delete(n.bans, h)
+			delete(n.scores, h)
+			cleared++
+		}
+	}
+	store := n.peerStore
+	n.Unlock()
+
+	if store != nil {
+		if err := store.Unban(host); err != nil {
+			log.Printf("[p2p] failed to persist unban: %v", err)
+		}
+	}
+	log.Printf("[p2p] cleared %d bans", cleared)
+	return cleared
+}
+
+// loadBansLocked restores persisted bans (must be called with lock held)
+func (n *Network) loadBansLocked(store PeerStore) {
+	bans, err := store.Bans()
+	if err != nil {
+		log.Printf("[p2p] failed to load bans: %v", err)
+		return
+	}
+	for _, ban := range bans {
+		n.bans[ban.Host] = ban
+	}
+	if len(bans) > 0 {
+		log.Printf("[p2p] loaded %d active bans", len(bans))
+	}
+}
+
+// flooding counts a message from peer and reports whether it exceeds the
+// per-connection rate; only the connection's own read loop calls it
+func (n *Network) flooding(peer *Peer) bool {
+	now := time.Now()
+	if now.Sub(peer.floodStart) > floodWindow {
+		peer.floodStart, peer.floodCount = now, 0
+	}
+	peer.floodCount++
+	if peer.floodCount == floodMaxMessages+1 {
+		n.misbehaving(peer, PenaltySpam, "message flood")
+	}
+	return peer.floodCount > floodMaxMessages
+}
+
+// peerHost returns the host part of a peer address, which bans and scores
+// are keyed by
+func peerHost(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
@@ -0,0 +1,104 @@
+package p2p
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMisbehavingPeerBanned(t *testing.T) {
+	storePath := filepath.Join(t.TempDir(), "peers.json")
+	store, err := NewFilePeerStore(storePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := NewNetwork("127.0.0.1:0", &testChain{})
+	server.SetPeerStore(store)
+	server.SetBanConfig(BanConfig{Threshold: -15, Duration: time.Hour})
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer server.Stop()
+	addr := server.listener.Addr().String()
+
+	// One malformed frame costs points but is below the threshold
+	sendGarbage := func() {
+		client := NewNetwork("127.0.0.1:0", &testChain{})
+		if err := client.ConnectPeer(addr); err != nil {
+			t.Fatalf("connect failed: %v", err)
+		}
+		waitFor(t, func() bool { return server.GetPeerCount() == 1 })
+		peer := client.peerSnapshot()[0]
+		peer.writeMutex.Lock()
+		peer.Writer.WriteString("GET / HTTP/1.1\r\nHost: x\r\n\r\n")
+		peer.Writer.Flush()
+		peer.writeMutex.Unlock()
+		waitFor(t, func() bool { return server.GetPeerCount() == 0 })
+	}
+	sendGarbage()
+	if bans := server.Bans(); len(bans) != 0 {
+		t.Fatalf("banned after one malformed frame: %+v", bans)
+	}
+
+	// The score is kept per host, so a second connection reaches the threshold
+	sendGarbage()
+	bans := server.Bans()
+	if len(bans) != 1 || bans[0].Host != "127.0.0.1" {
+		t.Fatalf("expected 127.0.0.1 to be banned, got %+v", bans)
+	}
+	if err := NewNetwork("127.0.0.1:0", &testChain{}).ConnectPeer(addr); err == nil {
+		t.Fatal("banned host was able to connect")
+	}
+
+	// The ban is persisted
+	reloaded, err := NewFilePeerStore(storePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored, _ := reloaded.Bans(); len(stored) != 1 || stored[0].Host != "127.0.0.1" {
+		t.Fatalf("ban not persisted: %+v", stored)
+	}
+
+	// Clearing it lets the host back in
+	if cleared := server.ClearBans(""); cleared != 1 {
+		t.Fatalf("expected 1 ban cleared, got %d", cleared)
+	}
+	if err := NewNetwork("127.0.0.1:0", &testChain{}).ConnectPeer(addr); err != nil {
+		t.Fatalf("connect after clearing ban failed: %v", err)
+	}
+	reloaded, err = NewFilePeerStore(storePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored, _ := reloaded.Bans(); len(stored) != 0 {
+		t.Fatalf("ban still persisted after clearing: %+v", stored)
+	}
+}
+
+func TestScoreRecovery(t *testing.T) {
+	start := time.Now()
+	score := &hostScore{recovered: start}
+	if got := score.penalize(PenaltyInvalidBlock, start); got != -PenaltyInvalidBlock {
+		t.Fatalf("expected score %d, got %d", -PenaltyInvalidBlock, got)
+	}
+
+	// A point is recovered per interval, partial intervals carry over
+	later := start.Add(5*scoreRecovery + scoreRecovery/2)
+	if got := score.penalize(PenaltySpam, later); got != -PenaltyInvalidBlock+5-PenaltySpam {
+		t.Fatalf("expected score %d, got %d", -PenaltyInvalidBlock+5-PenaltySpam, got)
+	}
+	if got := score.penalize(0, later.Add(scoreRecovery/2)); got != -PenaltyInvalidBlock+6-PenaltySpam {
+		t.Fatalf("expected score %d, got %d", -PenaltyInvalidBlock+6-PenaltySpam, got)
+	}
+
+	// Scores never recover above 0
+	if got := score.penalize(PenaltySpam, later.Add(24*time.Hour)); got != -PenaltySpam {
+		t.Fatalf("expected score %d, got %d", -PenaltySpam, got)
+	}
+
+	// One invalid block doesn't reach the default threshold
+	if -PenaltyInvalidBlock <= DefaultBanThreshold {
+		t.Fatal("a single invalid block reaches the default ban threshold")
+	}
+}
@@ -0,0 +1,162 @@
+package p2p
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Wire format
+//
+// Every message travels in a frame:
+//
+//	magic    4 bytes  "ARCV"
+//	version  1 byte   wireVersion
+//	type     1 byte   MessageType
+//	flags    1 byte   flagCompact: payload is compact-encoded (see compact.go)
+//	length   4 bytes  payload length, big endian
+//	checksum 4 bytes  first 4 bytes of sha256(payload)
+//	payload  length bytes, JSON unless flagCompact is set
+//
+// Each message type has a maximum payload size, checked before the payload
+// is read. A frame with a bad magic, version, type, size or checksum is an
+// error, and the peer that sent it is disconnected.
+
+const (
+	wireVersion     = 1
+	frameHeaderSize = 15
+	flagCompact     = 1 << 0
+)
+
+var wireMagic = [4]byte{'A', 'R', 'C', 'V'}
+
+var (
+	ErrBadMagic      = errors.New("bad frame magic")
+	ErrWireVersion   = errors.New("unsupported wire version")
+	ErrUnknownType   = errors.New("unknown message type")
+	ErrFrameTooLarge = errors.New("frame exceeds maximum size for its type")
+	ErrBadChecksum   = errors.New("frame checksum mismatch")
+	ErrBadPayload    = errors.New("malformed frame payload")
+)
+
+// maxPayloadSize is the largest payload accepted for each message type
+var maxPayloadSize = map[MessageType]uint32{
+	MsgTypeHandshake:     4 << 10,
+	MsgTypePing:          256,
+	MsgTypePong:          256,
+	MsgTypeNewBlock:      1 << 10,
+	MsgTypeGetBlock:      256,
+	MsgTypeBlockData:     4 << 20,
+	MsgTypeGetStatus:     256,
+	MsgTypeStatus:        1 << 10,
+	MsgTypeGossipPeers:   256 << 10,
+	MsgTypeInv:           1 << 20,
+	MsgTypeReq:           1 << 20,
+	MsgTypeRes:           4 << 20,
+	MsgTypeTxBroadcast:   128 << 10,
+	MsgTypeRequestBlocks: 256,
+	MsgTypeBlocksBatch:   32 << 20,
+	MsgTypeGetHeaders:    256,
+	MsgTypeHeaders:       8 << 20,
+}
+
+// compactTypes are the block-carrying messages sent compact-encoded
+var compactTypes = map[MessageType]bool{
+	MsgTypeBlockData:   true,
+	MsgTypeBlocksBatch: true,
+	MsgTypeHeaders:     true,
+	MsgTypeRes:         true,
+}
+
+// writeFrame writes msgType with its JSON payload as one frame
+func writeFrame(w io.Writer, msgType MessageType, payload []byte) error {
+	var flags byte
+	if compactTypes[msgType] {
+		compact, err := encodeCompact(payload)
+		if err != nil {
+			return fmt.Errorf("failed to compact message type %d: %w", msgType, err)
+		}
+		payload, flags = compact, flagCompact
+	}
+
+	max, ok := maxPayloadSize[msgType]
+	if !ok {
+		return fmt.Errorf("%w: %d", ErrUnknownType, msgType)
+	}
+	if uint64(len(payload)) > uint64(max) {
+		return fmt.Errorf("%w: type %d, %d bytes", ErrFrameTooLarge, msgType, len(payload))
+	}
+
+	var header [frameHeaderSize]byte
+	copy(header[0:4], wireMagic[:])
+	header[4] = wireVersion
+	header[5] = byte(msgType)
+	header[6] = flags
+	binary.BigEndian.PutUint32(header[7:11], uint32(len(payload)))
+	sum := sha256.Sum256(payload)
+	copy(header[11:15], sum[:4])
+
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+// readFrame reads one frame and returns its message with a JSON payload
+func readFrame(r io.Reader) (*Message, error) {
+	var header [frameHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(header[0:4], wireMagic[:]) {
+		return nil, ErrBadMagic
+	}
+	if header[4] != wireVersion {
+		return nil, fmt.Errorf("%w: %d", ErrWireVersion, header[4])
+	}
+	msgType := MessageType(header[5])
+	max, ok := maxPayloadSize[msgType]
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownType, msgType)
+	}
+	length := binary.BigEndian.Uint32(header[7:11])
+	if length > max {
+		return nil, fmt.Errorf("%w: type %d, %d bytes", ErrFrameTooLarge, msgType, length)
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+	if sum := sha256.Sum256(payload); !bytes.Equal(sum[:4], header[11:15]) {
+		return nil, ErrBadChecksum
+	}
+
+	if header[6]&flagCompact != 0 {
+		decoded, err := decodeCompact(payload)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrBadPayload, err)
+		}
+		payload = decoded
+	}
+	if !json.Valid(payload) {
+		return nil, fmt.Errorf("%w: message type %d is not JSON", ErrBadPayload, msgType)
+	}
+	return &Message{Type: msgType, Payload: payload}, nil
+}
+
+// isFrameError reports whether a readFrame error was caused by what the
+// peer sent rather than by the connection
+func isFrameError(err error) bool {
+	for _, e := range []error{ErrBadMagic, ErrWireVersion, ErrUnknownType, ErrFrameTooLarge, ErrBadChecksum, ErrBadPayload} {
+		if errors.Is(err, e) {
+			return true
+		}
+	}
+	return false
+}
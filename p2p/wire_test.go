@@ -0,0 +1,120 @@
+package p2p
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFrameRoundTrip(t *testing.T) {
+	block := `{"height":42,"hash":"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",` +
+		`"prevHash":[1,2,3,255,0,128,64,32,16,8,4,2,1,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,7],` +
+		`"difficulty":1000000,"timestamp":-5,"ratio":0.25,"farmer":"arcv1xyz","txs":[],"meta":null,"ok":true}`
+
+	tests := []struct {
+		msgType MessageType
+		payload string
+	}{
+		{MsgTypePing, `{"timestamp":1700000000}`},
+		{MsgTypeBlockData, block},
+		{MsgTypeBlocksBatch, `{"from":1,"blocks":[` + block + `,` + block + `],"eof":false}`},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := writeFrame(&buf, tt.msgType, []byte(tt.payload)); err != nil {
+			t.Fatalf("type %d: write failed: %v", tt.msgType, err)
+		}
+		if compactTypes[tt.msgType] && buf.Len()-frameHeaderSize >= len(tt.payload) {
+			t.Errorf("type %d: compact payload is %d bytes, JSON is %d", tt.msgType, buf.Len()-frameHeaderSize, len(tt.payload))
+		}
+
+		msg, err := readFrame(&buf)
+		if err != nil {
+			t.Fatalf("type %d: read failed: %v", tt.msgType, err)
+		}
+		if msg.Type != tt.msgType {
+			t.Fatalf("expected type %d, got %d", tt.msgType, msg.Type)
+		}
+		var want, got interface{}
+		json.Unmarshal([]byte(tt.payload), &want)
+		if err := json.Unmarshal(msg.Payload, &got); err != nil {
+			t.Fatalf("type %d: decoded payload is not JSON: %v", tt.msgType, err)
+		}
+		if !reflect.DeepEqual(want, got) {
+			t.Fatalf("type %d: payload changed:\nwant %s\ngot  %s", tt.msgType, tt.payload, msg.Payload)
+		}
+	}
+}
+
+func TestFrameRejected(t *testing.T) {
+	frame := func(msgType MessageType, payload string) []byte {
+		var buf bytes.Buffer
+		if err := writeFrame(&buf, msgType, []byte(payload)); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+
+	corrupt := frame(MsgTypePing, `{"timestamp":1}`)
+	corrupt[len(corrupt)-2] ^= 0xff
+
+	oversized := frame(MsgTypePing, `{}`)
+	binary.BigEndian.PutUint32(oversized[7:11], 1<<20)
+
+	unknown := frame(MsgTypePing, `{}`)
+	unknown[5] = 200
+
+	// A compact object claiming a key it doesn't carry, with a valid checksum
+	badPayload := []byte{tagObject, 1, 5, 'h'}
+	badCompact := frame(MsgTypePing, `{}`)[:frameHeaderSize]
+	badCompact[5] = byte(MsgTypeBlockData)
+	badCompact[6] = flagCompact
+	binary.BigEndian.PutUint32(badCompact[7:11], uint32(len(badPayload)))
+	sum := sha256.Sum256(badPayload)
+	copy(badCompact[11:15], sum[:4])
+	badCompact = append(badCompact, badPayload...)
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"http", []byte("GET / HTTP/1.1\r\nHost: x\r\n\r\n"), ErrBadMagic},
+		{"checksum", corrupt, ErrBadChecksum},
+		{"oversized", oversized, ErrFrameTooLarge},
+		{"unknown type", unknown, ErrUnknownType},
+		{"malformed compact", badCompact, errCompactTruncated},
+	}
+	for _, tt := range tests {
+		_, err := readFrame(bytes.NewReader(tt.data))
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, err)
+		}
+	}
+
+	if err := writeFrame(&bytes.Buffer{}, MsgTypePing, []byte(`"`+strings.Repeat("x", 300)+`"`)); !errors.Is(err, ErrFrameTooLarge) {
+		t.Errorf("expected oversized write to fail, got %v", err)
+	}
+}
+
+func TestDecodeCompactMalformed(t *testing.T) {
+	inputs := [][]byte{
+		{},
+		{tagString, 10, 'a'},
+		{tagArray, 200, 1, tagNull},
+		{tagNumber, 3, 'a', 'b', 'c'},
+		{99},
+		{tagNull, tagNull},
+		bytes.Repeat([]byte{tagArray, 1}, maxCompactDepth+2),
+	}
+	for _, in := range inputs {
+		if out, err := decodeCompact(in); err == nil {
+			t.Errorf("decodeCompact(%v) = %s, expected error", in, out)
+		}
+	}
+}
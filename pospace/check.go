@@ -0,0 +1,124 @@
+package pospace
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// ValidateHeader checks that a plot's header is consistent with its contents:
+// the k size and entry count are in range, the plot ID is derived from the
+// header fields and the file has the expected size.
+func (p *PlotFile) ValidateHeader() error {
+	h := &p.Header
+
+	info, err := p.file.Stat()
+	if err != nil {
+		return fmt.Errorf("stat failed: %w", err)
+	}
+
+	switch h.Version {
+	case PlotVersionV1:
+		if h.KSize == 0 || h.KSize > maxKSizeV1 {
+			return fmt.Errorf("k size %d out of range", h.KSize)
+		}
+		if h.NumHashes != uint64(1)<<h.KSize {
+			return fmt.Errorf("entry count %d does not match k=%d", h.NumHashes, h.KSize)
+		}
+		if sha256.Sum256(h.FarmerPubKey[:]) != h.PlotID {
+			return fmt.Errorf("plot ID %x not derived from farmer key", h.PlotID[:8])
+		}
+		if want := h.Size() + int64(h.NumHashes)*32; info.Size() != want {
+			return fmt.Errorf("unexpected plot size %d (expected %d)", info.Size(), want)
+		}
+	case PlotVersion:
+		if h.KSize < MinKSize || h.KSize > MaxKSize {
+			return fmt.Errorf("k size %d out of range", h.KSize)
+		}
+		if h.NumHashes == 0 || h.NumHashes > uint64(1)<<h.KSize {
+			return fmt.Errorf("entry count %d out of range for k=%d", h.NumHashes, h.KSize)
+		}
+		if ComputePlotID(h.FarmerPubKey[:], h.PoolAddress, h.PlotSeed) != h.PlotID {
+			return fmt.Errorf("plot ID %x not derived from farmer key, pool and seed", h.PlotID[:8])
+		}
+		// The file size was already checked against the index when the plot was opened
+	default:
+		return fmt.Errorf("unsupported plot version %d", h.Version)
+	}
+
+	return nil
+}
+
+// VerifyEntry recomputes entry i of the plot and compares it with what is on
+// disk. v1 entries are rehashed from their index; v2 entries are re-evaluated
+// from their x values, and index keys and sort order are checked as well.
+func (p *PlotFile) VerifyEntry(i uint64) error {
+	if i >= p.Header.NumHashes {
+		return fmt.Errorf("entry %d out of range (%d entries)", i, p.Header.NumHashes)
+	}
+
+	if p.Header.Version != PlotVersion {
+		var hash [32]byte
+		r := io.NewSectionReader(p.file, p.Header.Size()+int64(i)*32, 32)
+		if _, err := io.ReadFull(r, hash[:]); err != nil {
+			return fmt.Errorf("read hash %d failed: %w", i, err)
+		}
+		if expected := computePlotHash(p.Header.FarmerPubKey[:], p.Header.PlotID[:], i); hash != expected {
+			return fmt.Errorf("entry %d: hash mismatch (plot=%x, expected=%x)", i, hash[:8], expected[:8])
+		}
+		return nil
+	}
+
+	// Read the entry together with its successor to check ordering
+	entries, err := p.readEntriesV2(i, 2)
+	if err != nil {
+		return fmt.Errorf("entry %d: %w", i, err)
+	}
+	entry := entries[0]
+
+	output, err := evaluateProofV2(p.Header.FarmerPubKey[:], p.Header.PlotID[:], p.Header.KSize, entry.XValues[:])
+	if err != nil {
+		return fmt.Errorf("entry %d: %w", i, err)
+	}
+	if output != entry.Output {
+		return fmt.Errorf("entry %d: output mismatch (plot=%x, expected=%x)", i, entry.Output[:8], output[:8])
+	}
+
+	if p.index != nil {
+		if len(entries) > 1 && entryKey(entries[1].Output) < entryKey(entry.Output) {
+			return fmt.Errorf("entry %d: entries out of order", i)
+		}
+		if i%IndexInterval == 0 && p.index[i/IndexInterval] != entryKey(entry.Output) {
+			return fmt.Errorf("entry %d: index key mismatch", i)
+		}
+	}
+
+	return nil
+}
+
+// SimulateChallenges runs n deterministic pseudo-random challenges against the
+// plot and returns how many of them produce a proof meeting difficultyTarget.
+// Every proof found is checked with VerifyProof.
+func (p *PlotFile) SimulateChallenges(n int, difficultyTarget uint64) (int, error) {
+	wins := 0
+	for i := 0; i < n; i++ {
+		var seed [40]byte
+		copy(seed[:32], p.Header.PlotID[:])
+		binary.LittleEndian.PutUint64(seed[32:], uint64(i))
+		challenge := sha256.Sum256(seed[:])
+
+		proof, err := p.CheckChallenge(challenge, difficultyTarget)
+		if err != nil {
+			return wins, err
+		}
+		if proof == nil || proof.Quality > difficultyTarget {
+			continue
+		}
+		if !VerifyProof(proof, challenge, difficultyTarget) {
+			return wins, fmt.Errorf("challenge %x: plot produced an invalid proof", challenge[:8])
+		}
+		wins++
+	}
+	return wins, nil
+}
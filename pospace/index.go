@@ -0,0 +1,133 @@
+package pospace
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Sorted v2 layout
+//
+// GeneratePlot writes the final table sorted by output, followed by a sparse
+// index holding the 64-bit output prefix of the first entry of every
+// IndexInterval-entry block. The index is loaded into memory by OpenPlot, so a
+// challenge lookup is a binary search in memory plus one or two block reads.
+// Plots without an index (v1, or v2 written before the index existed) are
+// still scanned linearly.
+
+// IndexInterval is the number of final table entries covered by one index key
+const IndexInterval = 1024
+
+// entryKey returns the challenge-comparable sort key of an output
+func entryKey(out [32]byte) uint64 {
+	return binary.BigEndian.Uint64(out[:8])
+}
+
+// sortEntriesV2 orders final table entries by output
+func sortEntriesV2(entries []plotEntryV2) {
+	sort.Slice(entries, func(i, j int) bool {
+		return bytes.Compare(entries[i].Output[:], entries[j].Output[:]) < 0
+	})
+}
+
+// buildIndexV2 builds the sparse index for sorted entries
+func buildIndexV2(entries []plotEntryV2) []uint64 {
+	index := make([]uint64, 0, (len(entries)+IndexInterval-1)/IndexInterval)
+	for i := 0; i < len(entries); i += IndexInterval {
+		index = append(index, entryKey(entries[i].Output))
+	}
+	return index
+}
+
+// indexLen returns the number of index keys for a plot with n entries
+func indexLen(n uint64) uint64 {
+	return (n + IndexInterval - 1) / IndexInterval
+}
+
+// entriesOffsetV2 returns the file offset of the first final table entry
+func (p *PlotFile) entriesOffsetV2() int64 {
+	return p.Header.Size()
+}
+
+// loadIndexV2 loads the sparse index if the plot has one
+func (p *PlotFile) loadIndexV2() error {
+	info, err := p.file.Stat()
+	if err != nil {
+		return fmt.Errorf("stat failed: %w", err)
+	}
+
+	entriesEnd := p.entriesOffsetV2() + int64(p.Header.NumHashes)*entrySizeV2
+	n := indexLen(p.Header.NumHashes)
+
+	switch info.Size() {
+	case entriesEnd:
+		// Unindexed plot, fall back to a linear scan
+		return nil
+	case entriesEnd + int64(n)*8:
+	default:
+		return fmt.Errorf("unexpected plot size %d (entries end at %d)", info.Size(), entriesEnd)
+	}
+
+	index := make([]uint64, n)
+	r := io.NewSectionReader(p.file, entriesEnd, int64(n)*8)
+	if err := binary.Read(r, binary.LittleEndian, index); err != nil {
+		return fmt.Errorf("failed to read index: %w", err)
+	}
+	p.index = index
+	return nil
+}
+
+// readEntriesV2 reads count final table entries starting at entry i
+func (p *PlotFile) readEntriesV2(i, count uint64) ([]plotEntryV2, error) {
+	if i+count > p.Header.NumHashes {
+		count = p.Header.NumHashes - i
+	}
+	entries := make([]plotEntryV2, count)
+	r := io.NewSectionReader(p.file, p.entriesOffsetV2()+int64(i)*entrySizeV2, int64(count)*entrySizeV2)
+	if err := binary.Read(r, binary.LittleEndian, entries); err != nil {
+		return nil, fmt.Errorf("read entries failed: %w", err)
+	}
+	return entries, nil
+}
+
+// lookupV2 returns all final table entries eligible for a challenge using the index
+func (p *PlotFile) lookupV2(challenge [32]byte) ([]plotEntryV2, error) {
+	k := p.Header.KSize
+	lo := challengeKey(challenge, k) << (64 - k)
+	hi := lo | (^uint64(0) >> k)
+
+	// The first block that may hold lo is the one before the first key >= lo
+	block := sort.Search(len(p.index), func(i int) bool { return p.index[i] >= lo })
+	if block > 0 {
+		block--
+	}
+
+	var matches []plotEntryV2
+	for ; block < len(p.index) && p.index[block] <= hi; block++ {
+		entries, err := p.readEntriesV2(uint64(block)*IndexInterval, IndexInterval)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			key := entryKey(e.Output)
+			if key > hi {
+				return matches, nil
+			}
+			if key >= lo {
+				matches = append(matches, e)
+			}
+		}
+	}
+
+	return matches, nil
+}
+
+// writeIndexV2 appends the sparse index to a plot being written
+func writeIndexV2(w io.Writer, index []uint64) error {
+	if err := binary.Write(w, binary.LittleEndian, index); err != nil {
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,475 @@
+package pospace
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// Plotter builds a v2 plot with several workers and checkpoints its progress
+// after every table, so an interrupted run can be resumed. Nothing is written
+// to the final path until the plot is complete: the plot is assembled in
+// <path>.tmp and renamed into place, and the checkpoint lives in
+// <path>.progress plus one <path>.tN.tmp file per completed table and the
+// outputs of the last one in <path>.tN.out.tmp.
+type Plotter struct {
+	Path    string
+	Threads int
+
+	// Progress, if set, is called after each table is built
+	Progress func(table int, entries int)
+
+	progress plotProgress
+
+	// Table state restored from / saved to the checkpoint
+	xs      []uint32
+	links   [][]tableLink
+	outputs [][32]byte
+}
+
+// plotProgress is the checkpoint metadata stored in <path>.progress
+type plotProgress struct {
+	KSize          uint32 `json:"kSize"`
+	FarmerPubKey   string `json:"farmerPubKey"`
+	PoolAddress    string `json:"poolAddress"`
+	PlotSeed       string `json:"plotSeed"`
+	CompletedTable int    `json:"completedTable"`
+}
+
+// ProgressSuffix is appended to a plot path to name its checkpoint file
+const ProgressSuffix = ".progress"
+
+// NewPlotter prepares a new plot. threads <= 0 uses one worker per CPU.
+func NewPlotter(path string, kSize uint32, farmerPubKey []byte, poolAddress [20]byte, plotSeed [32]byte, threads int) (*Plotter, error) {
+	if len(farmerPubKey) != 33 {
+		return nil, fmt.Errorf("farmer public key must be 33 bytes (compressed)")
+	}
+	if kSize < MinKSize || kSize > MaxKSize {
+		return nil, fmt.Errorf("k size must be between %d and %d", MinKSize, MaxKSize)
+	}
+	if _, err := os.Stat(path + ProgressSuffix); err == nil {
+		return nil, fmt.Errorf("plot %s has an unfinished checkpoint, resume it instead", path)
+	}
+
+	return &Plotter{
+		Path:    path,
+		Threads: workerCount(threads),
+		progress: plotProgress{
+			KSize:        kSize,
+			FarmerPubKey: hex.EncodeToString(farmerPubKey),
+			PoolAddress:  hex.EncodeToString(poolAddress[:]),
+			PlotSeed:     hex.EncodeToString(plotSeed[:]),
+		},
+		links: make([][]tableLink, NumTables+1),
+	}, nil
+}
+
+// ResumePlotter loads the checkpoint of an interrupted plot
+func ResumePlotter(path string, threads int) (*Plotter, error) {
+	data, err := os.ReadFile(path + ProgressSuffix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+
+	p := &Plotter{
+		Path:    path,
+		Threads: workerCount(threads),
+		links:   make([][]tableLink, NumTables+1),
+	}
+	if err := json.Unmarshal(data, &p.progress); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint: %w", err)
+	}
+	if err := p.loadCheckpoint(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// FindUnfinishedPlots returns the paths of plots in dir that have a checkpoint
+func FindUnfinishedPlots(dir string) ([]string, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var paths []string
+	for _, f := range files {
+		if !f.IsDir() && strings.HasSuffix(f.Name(), ProgressSuffix) {
+			paths = append(paths, filepath.Join(dir, strings.TrimSuffix(f.Name(), ProgressSuffix)))
+		}
+	}
+	return paths, nil
+}
+
+// UnfinishedPlotID returns the plot ID of the unfinished plot at path, as
+// named by its checkpoint
+func UnfinishedPlotID(path string) ([32]byte, error) {
+	data, err := os.ReadFile(path + ProgressSuffix)
+	if err != nil {
+		return [32]byte{}, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+	p := &Plotter{Path: path}
+	if err := json.Unmarshal(data, &p.progress); err != nil {
+		return [32]byte{}, fmt.Errorf("failed to parse checkpoint: %w", err)
+	}
+	farmerPubKey, poolAddress, plotSeed, err := p.params()
+	if err != nil {
+		return [32]byte{}, err
+	}
+	return ComputePlotID(farmerPubKey, poolAddress, plotSeed), nil
+}
+
+// CompletedTables returns how many tables are already built
+func (p *Plotter) CompletedTables() int {
+	return p.progress.CompletedTable
+}
+
+// Run builds the remaining tables and writes the finished plot
+func (p *Plotter) Run() error {
+	for t := p.progress.CompletedTable + 1; t <= NumTables; t++ {
+		if err := p.buildTable(t); err != nil {
+			return err
+		}
+		if err := p.saveCheckpoint(t); err != nil {
+			return err
+		}
+	}
+	return p.finish()
+}
+
+// buildTable computes table t from the previous table. Every table except the
+// last is sorted for matching.
+func (p *Plotter) buildTable(t int) error {
+	farmerPubKey, poolAddress, plotSeed, err := p.params()
+	if err != nil {
+		return err
+	}
+	kSize := p.progress.KSize
+	plotID := ComputePlotID(farmerPubKey, poolAddress, plotSeed)
+	numEntries := uint64(1) << kSize
+
+	// Table 1: f1(x) for every x
+	if t == 1 {
+		outputs := make([][32]byte, numEntries)
+		parallelFor(int(numEntries), p.Threads, func(start, end int) {
+			for x := start; x < end; x++ {
+				outputs[x] = computeF1(farmerPubKey, plotID[:], kSize, uint32(x))
+			}
+		})
+		order := sortOutputs(outputs, kSize)
+		p.xs = make([]uint32, numEntries)
+		p.outputs = make([][32]byte, numEntries)
+		for i, idx := range order {
+			p.xs[i] = idx
+			p.outputs[i] = outputs[idx]
+		}
+		p.reportProgress(1, len(p.outputs))
+		return nil
+	}
+
+	// Tables 2..n: match colliding entries of the previous table
+	links := findMatches(p.outputs, kSize, numEntries)
+	next := make([][32]byte, len(links))
+	parallelFor(len(links), p.Threads, func(start, end int) {
+		for i := start; i < end; i++ {
+			next[i] = computeFx(uint8(t), plotID[:], p.outputs[links[i].Left], p.outputs[links[i].Right])
+		}
+	})
+
+	if t < NumTables {
+		order := sortOutputs(next, kSize)
+		sortedOut := make([][32]byte, len(next))
+		sortedLinks := make([]tableLink, len(next))
+		for i, idx := range order {
+			sortedOut[i] = next[idx]
+			sortedLinks[i] = links[idx]
+		}
+		next, links = sortedOut, sortedLinks
+	}
+	p.outputs = next
+	p.links[t] = links
+	p.reportProgress(t, len(next))
+	return nil
+}
+
+// reportProgress passes a built table to the Progress callback
+func (p *Plotter) reportProgress(table, entries int) {
+	if p.Progress != nil {
+		p.Progress(table, entries)
+	}
+}
+
+// finish writes the plot from the final table and removes the checkpoint
+func (p *Plotter) finish() error {
+	farmerPubKey, poolAddress, plotSeed, err := p.params()
+	if err != nil {
+		return err
+	}
+
+	// Expand every final entry back to its table 1 x values
+	entries := make([]plotEntryV2, len(p.outputs))
+	parallelFor(len(entries), p.Threads, func(start, end int) {
+		for i := start; i < end; i++ {
+			entries[i].Output = p.outputs[i]
+			collectXValues(p.links, p.xs, NumTables, uint32(i), entries[i].XValues[:0])
+		}
+	})
+
+	// Sort by output so challenges can be looked up through the index
+	sortEntriesV2(entries)
+
+	header := PlotHeader{
+		Magic:       PlotMagic,
+		Version:     PlotVersion,
+		KSize:       p.progress.KSize,
+		PlotID:      ComputePlotID(farmerPubKey, poolAddress, plotSeed),
+		NumHashes:   uint64(len(entries)),
+		PlotSeed:    plotSeed,
+		PoolAddress: poolAddress,
+	}
+	copy(header.FarmerPubKey[:], farmerPubKey)
+
+	// Write to a temp file and rename, so the plot path only ever holds a complete plot
+	tmpPath := p.Path + ".tmp"
+	if err := writePlotV2(tmpPath, &header, entries); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, p.Path); err != nil {
+		return fmt.Errorf("failed to move plot into place: %w", err)
+	}
+
+	p.removeCheckpoint()
+	return nil
+}
+
+// params decodes the plot parameters from the checkpoint metadata
+func (p *Plotter) params() (farmerPubKey []byte, poolAddress [20]byte, plotSeed [32]byte, err error) {
+	farmerPubKey, err = hex.DecodeString(p.progress.FarmerPubKey)
+	if err != nil || len(farmerPubKey) != 33 {
+		return nil, poolAddress, plotSeed, fmt.Errorf("invalid farmer public key in checkpoint")
+	}
+	pool, err := hex.DecodeString(p.progress.PoolAddress)
+	if err != nil || len(pool) != len(poolAddress) {
+		return nil, poolAddress, plotSeed, fmt.Errorf("invalid pool address in checkpoint")
+	}
+	seed, err := hex.DecodeString(p.progress.PlotSeed)
+	if err != nil || len(seed) != len(plotSeed) {
+		return nil, poolAddress, plotSeed, fmt.Errorf("invalid plot seed in checkpoint")
+	}
+	copy(poolAddress[:], pool)
+	copy(plotSeed[:], seed)
+	return farmerPubKey, poolAddress, plotSeed, nil
+}
+
+// tablePath returns the checkpoint file of table t
+func (p *Plotter) tablePath(t int) string {
+	return fmt.Sprintf("%s.t%d.tmp", p.Path, t)
+}
+
+// outputsPath returns the checkpoint file of the outputs of table t
+func (p *Plotter) outputsPath(t int) string {
+	return fmt.Sprintf("%s.t%d.out.tmp", p.Path, t)
+}
+
+// saveCheckpoint persists table t. The progress file is written last and the
+// previous table's outputs are only removed after it, so a crash
+// mid-checkpoint resumes from the previous table with its own outputs.
+func (p *Plotter) saveCheckpoint(t int) error {
+	var err error
+	if t == 1 {
+		err = writeSliceFile(p.tablePath(1), p.xs)
+	} else {
+		err = writeSliceFile(p.tablePath(t), p.links[t])
+	}
+	if err != nil {
+		return err
+	}
+	if err := writeSliceFile(p.outputsPath(t), p.outputs); err != nil {
+		return err
+	}
+
+	progress := p.progress
+	progress.CompletedTable = t
+	data, err := json.MarshalIndent(progress, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(p.Path+ProgressSuffix, data); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	p.progress = progress
+	if t > 1 {
+		os.Remove(p.outputsPath(t - 1))
+	}
+	return nil
+}
+
+// loadCheckpoint restores the tables listed in the progress file
+func (p *Plotter) loadCheckpoint() error {
+	completed := p.progress.CompletedTable
+	if completed < 1 {
+		return nil
+	}
+	if completed > NumTables {
+		return fmt.Errorf("invalid checkpoint: %d tables completed", completed)
+	}
+
+	if err := readSliceFile(p.tablePath(1), 4, func(n int) interface{} {
+		p.xs = make([]uint32, n)
+		return p.xs
+	}); err != nil {
+		return err
+	}
+	for t := 2; t <= completed; t++ {
+		t := t
+		if err := readSliceFile(p.tablePath(t), 8, func(n int) interface{} {
+			p.links[t] = make([]tableLink, n)
+			return p.links[t]
+		}); err != nil {
+			return err
+		}
+	}
+	return readSliceFile(p.outputsPath(completed), 32, func(n int) interface{} {
+		p.outputs = make([][32]byte, n)
+		return p.outputs
+	})
+}
+
+// removeCheckpoint deletes all checkpoint files of a finished plot
+func (p *Plotter) removeCheckpoint() {
+	os.Remove(p.Path + ProgressSuffix)
+	for t := 1; t <= NumTables; t++ {
+		os.Remove(p.tablePath(t))
+		os.Remove(p.outputsPath(t))
+	}
+}
+
+// writePlotV2 writes a complete v2 plot file
+func writePlotV2(path string, header *PlotHeader, entries []plotEntryV2) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create plot file: %w", err)
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	if err := writeHeader(w, header); err != nil {
+		return fmt.Errorf("failed to write header: %w", err)
+	}
+
+	// Write final table entries
+	for i := range entries {
+		if err := binary.Write(w, binary.LittleEndian, &entries[i]); err != nil {
+			return fmt.Errorf("failed to write entry %d: %w", i, err)
+		}
+	}
+
+	if err := writeIndexV2(w, buildIndexV2(entries)); err != nil {
+		return err
+	}
+
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to flush plot: %w", err)
+	}
+	return f.Sync()
+}
+
+// writeSliceFile atomically writes a slice of fixed-size values
+func writeSliceFile(path string, data interface{}) error {
+	tmpPath := path + ".new"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", tmpPath, err)
+	}
+	w := bufio.NewWriter(f)
+	if err := binary.Write(w, binary.LittleEndian, data); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write %s: %w", tmpPath, err)
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write %s: %w", tmpPath, err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// readSliceFile reads a file written by writeSliceFile. alloc receives the
+// element count and returns the slice to fill.
+func readSliceFile(path string, elemSize int, alloc func(n int) interface{}) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open checkpoint: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size()%int64(elemSize) != 0 {
+		return fmt.Errorf("checkpoint %s is truncated", path)
+	}
+
+	dst := alloc(int(info.Size() / int64(elemSize)))
+	if err := binary.Read(bufio.NewReader(f), binary.LittleEndian, dst); err != nil {
+		return fmt.Errorf("failed to read checkpoint %s: %w", path, err)
+	}
+	return nil
+}
+
+// writeFileAtomic writes data to a temp file and renames it over path
+func writeFileAtomic(path string, data []byte) error {
+	tmpPath := path + ".new"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// workerCount resolves the number of plotting workers
+func workerCount(threads int) int {
+	if threads <= 0 {
+		return runtime.NumCPU()
+	}
+	return threads
+}
+
+// parallelFor splits [0, n) into contiguous chunks processed by up to threads goroutines
+func parallelFor(n int, threads int, fn func(start, end int)) {
+	if threads > n {
+		threads = n
+	}
+	if threads <= 1 {
+		fn(0, n)
+		return
+	}
+
+	chunk := (n + threads - 1) / threads
+	var wg sync.WaitGroup
+	for start := 0; start < n; start += chunk {
+		end := start + chunk
+		if end > n {
+			end = n
+		}
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			fn(start, end)
+		}(start, end)
+	}
+	wg.Wait()
+}
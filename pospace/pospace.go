@@ -1,6 +1,8 @@
 package pospace
 
 import (
+	"bufio"
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/binary"
 	"fmt"
@@ -55,8 +57,15 @@ func SelfTest() error {
 const (
 	// PlotMagic is the magic number at the start of plot files
 	PlotMagic = uint32(0x41524356) // "ARCV" in hex
-	// PlotVersion is the current plot format version
-	PlotVersion = uint32(1)
+	// PlotVersionV1 is the legacy linear format (one cheap hash per index)
+	PlotVersionV1 = uint32(1)
+	// PlotVersion is the current plot format version (multi-table, see
+	// tables.go, with the plot seed and pool address in the header)
+	PlotVersion = uint32(3)
+
+	// plotVersionUnseeded is the multi-table format before its header carried
+	// the plot seed and pool address; such plots have to be re-plotted
+	plotVersionUnseeded = uint32(2)
 )
 
 // PlotHeader contains metadata about a plot file
@@ -66,7 +75,98 @@ type PlotHeader struct {
 	KSize        uint32   // K parameter (plot size = 2^k hashes)
 	FarmerPubKey [33]byte // Compressed secp256k1 public key
 	PlotID       [32]byte // Unique plot identifier
-	NumHashes    uint64   // Total number of hashes in plot
+	NumHashes    uint64   // Total number of entries in plot
+	PlotSeed     [32]byte // Random seed the plot ID is derived from (PlotVersion only)
+	PoolAddress  [20]byte // Pool payout address the plot commits to, zero = solo (PlotVersion only)
+}
+
+// plotHeaderV1 is the on-disk header layout shared by all versions, and the
+// whole header of those before PlotVersion
+type plotHeaderV1 struct {
+	Magic        uint32
+	Version      uint32
+	KSize        uint32
+	FarmerPubKey [33]byte
+	PlotID       [32]byte
+	NumHashes    uint64
+}
+
+// Size returns the on-disk size of the header
+func (h *PlotHeader) Size() int64 {
+	size := int64(binary.Size(plotHeaderV1{}))
+	if h.Version >= PlotVersion {
+		size += int64(len(h.PlotSeed) + len(h.PoolAddress))
+	}
+	return size
+}
+
+// writeHeader writes a plot header in the layout of its version
+func writeHeader(w io.Writer, h *PlotHeader) error {
+	base := plotHeaderV1{
+		Magic:        h.Magic,
+		Version:      h.Version,
+		KSize:        h.KSize,
+		FarmerPubKey: h.FarmerPubKey,
+		PlotID:       h.PlotID,
+		NumHashes:    h.NumHashes,
+	}
+	if err := binary.Write(w, binary.LittleEndian, &base); err != nil {
+		return err
+	}
+	if h.Version >= PlotVersion {
+		if _, err := w.Write(h.PlotSeed[:]); err != nil {
+			return err
+		}
+		if _, err := w.Write(h.PoolAddress[:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readHeader reads a plot header in the layout of its version
+func readHeader(r io.Reader) (PlotHeader, error) {
+	var base plotHeaderV1
+	if err := binary.Read(r, binary.LittleEndian, &base); err != nil {
+		return PlotHeader{}, err
+	}
+	h := PlotHeader{
+		Magic:        base.Magic,
+		Version:      base.Version,
+		KSize:        base.KSize,
+		FarmerPubKey: base.FarmerPubKey,
+		PlotID:       base.PlotID,
+		NumHashes:    base.NumHashes,
+	}
+	if h.Magic == PlotMagic && h.Version >= PlotVersion {
+		if _, err := io.ReadFull(r, h.PlotSeed[:]); err != nil {
+			return PlotHeader{}, err
+		}
+		if _, err := io.ReadFull(r, h.PoolAddress[:]); err != nil {
+			return PlotHeader{}, err
+		}
+	}
+	return h, nil
+}
+
+// NewPlotSeed returns a random plot seed
+func NewPlotSeed() ([32]byte, error) {
+	var seed [32]byte
+	if _, err := rand.Read(seed[:]); err != nil {
+		return seed, fmt.Errorf("failed to generate plot seed: %w", err)
+	}
+	return seed, nil
+}
+
+// ComputePlotID derives a v2 plot ID from the farmer key, pool address and plot seed
+func ComputePlotID(farmerPubKey []byte, poolAddress [20]byte, plotSeed [32]byte) [32]byte {
+	h := sha256.New()
+	h.Write(farmerPubKey)
+	h.Write(poolAddress[:])
+	h.Write(plotSeed[:])
+	var id [32]byte
+	copy(id[:], h.Sum(nil))
+	return id
 }
 
 // PlotFile represents a Proof-of-Space plot
@@ -74,6 +174,7 @@ type PlotFile struct {
 	Header PlotHeader
 	Path   string
 	file   *os.File
+	index  []uint64 // Sparse index of sorted v2 plots (nil if unindexed)
 }
 
 // Proof represents a Proof-of-Space proof
@@ -84,10 +185,41 @@ type Proof struct {
 	Hash         [32]byte // The hash itself
 	Quality      uint64   // Quality value (lower is better)
 	FarmerPubKey [33]byte // Farmer's public key
+
+	// v2 fields (zero for legacy v1 proofs)
+	Version     uint32   `json:",omitempty"` // Plot format the proof comes from
+	KSize       uint32   `json:",omitempty"` // K parameter of the plot
+	XValues     []uint32 `json:",omitempty"` // Table 1 leaves of the proof tree
+	PlotSeed    [32]byte `json:",omitzero"`  // Seed the plot ID is derived from
+	PoolAddress [20]byte `json:",omitzero"`  // Pool payout address the plot commits to (zero = solo)
+}
+
+// HasPool reports whether the proof's plot pays part of the reward to a pool
+func (p *Proof) HasPool() bool {
+	return p.PoolAddress != [20]byte{}
+}
+
+// FormatVersion returns the plot format version of the proof
+func (p *Proof) FormatVersion() uint32 {
+	if p.Version == 0 {
+		return PlotVersionV1
+	}
+	return p.Version
+}
+
+// GeneratePlot creates a new v2 plot file for the given pool address and plot seed.
+// A zero pool address creates a solo plot. Use NewPlotter directly to control
+// the worker count or resume an interrupted plot.
+func GeneratePlot(path string, kSize uint32, farmerPubKey []byte, poolAddress [20]byte, plotSeed [32]byte) error {
+	plotter, err := NewPlotter(path, kSize, farmerPubKey, poolAddress, plotSeed, 0)
+	if err != nil {
+		return err
+	}
+	return plotter.Run()
 }
 
-// GeneratePlot creates a new plot file with precomputed hashes
-func GeneratePlot(path string, kSize uint32, farmerPubKey []byte) error {
+// GeneratePlotV1 creates a legacy v1 plot file with precomputed hashes
+func GeneratePlotV1(path string, kSize uint32, farmerPubKey []byte) error {
 	if len(farmerPubKey) != 33 {
 		return fmt.Errorf("farmer public key must be 33 bytes (compressed)")
 	}
@@ -108,14 +240,14 @@ func GeneratePlot(path string, kSize uint32, farmerPubKey []byte) error {
 	// Write header
 	header := PlotHeader{
 		Magic:     PlotMagic,
-		Version:   PlotVersion,
+		Version:   PlotVersionV1,
 		KSize:     kSize,
 		PlotID:    plotIDHash,
 		NumHashes: numHashes,
 	}
 	copy(header.FarmerPubKey[:], farmerPubKey)
 
-	if err := binary.Write(f, binary.LittleEndian, &header); err != nil {
+	if err := writeHeader(f, &header); err != nil {
 		return fmt.Errorf("failed to write header: %w", err)
 	}
 
@@ -152,8 +284,8 @@ func OpenPlot(path string) (*PlotFile, error) {
 	}
 
 	// Read header
-	var header PlotHeader
-	if err := binary.Read(f, binary.LittleEndian, &header); err != nil {
+	header, err := readHeader(f)
+	if err != nil {
 		f.Close()
 		return nil, fmt.Errorf("failed to read header: %w", err)
 	}
@@ -164,11 +296,35 @@ func OpenPlot(path string) (*PlotFile, error) {
 		return nil, fmt.Errorf("invalid plot magic: expected %x, got %x", PlotMagic, header.Magic)
 	}
 
-	return &PlotFile{
+	// Validate version
+	if header.Version == plotVersionUnseeded {
+		f.Close()
+		return nil, fmt.Errorf("plot version %d has no plot seed, re-plot it", header.Version)
+	}
+	if header.Version != PlotVersionV1 && header.Version != PlotVersion {
+		f.Close()
+		return nil, fmt.Errorf("unsupported plot version %d", header.Version)
+	}
+
+	plot := &PlotFile{
 		Header: header,
 		Path:   path,
 		file:   f,
-	}, nil
+	}
+
+	if header.Version == PlotVersion {
+		if err := plot.loadIndexV2(); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+
+	return plot, nil
+}
+
+// Indexed reports whether challenge lookups use the sorted index
+func (p *PlotFile) Indexed() bool {
+	return p.index != nil
 }
 
 // Close closes the plot file
@@ -181,6 +337,10 @@ func (p *PlotFile) Close() error {
 
 // CheckChallenge checks if this plot has a winning proof for the given challenge
 func (p *PlotFile) CheckChallenge(challenge [32]byte, difficultyTarget uint64) (*Proof, error) {
+	if p.Header.Version == PlotVersion {
+		return p.checkChallengeV2(challenge, difficultyTarget)
+	}
+
 	// Search through the plot for qualifying hashes
 	// In a real implementation, this would use a more efficient lookup structure
 	// For devnet, we'll do a simple scan
@@ -194,7 +354,7 @@ func (p *PlotFile) CheckChallenge(challenge [32]byte, difficultyTarget uint64) (
 	// Read through all hashes
 	for i := uint64(0); i < p.Header.NumHashes; i++ {
 		// Seek to hash position
-		hashOffset := int64(binary.Size(p.Header)) + int64(i*32)
+		hashOffset := p.Header.Size() + int64(i*32)
 		if _, err := p.file.Seek(hashOffset, io.SeekStart); err != nil {
 			return nil, fmt.Errorf("seek failed: %w", err)
 		}
@@ -231,6 +391,75 @@ func (p *PlotFile) CheckChallenge(challenge [32]byte, difficultyTarget uint64) (
 	return bestProof, nil
 }
 
+// checkChallengeV2 finds the best eligible entry of a v2 plot
+func (p *PlotFile) checkChallengeV2(challenge [32]byte, difficultyTarget uint64) (*Proof, error) {
+	if p.index == nil {
+		return p.scanChallengeV2(challenge)
+	}
+
+	matches, err := p.lookupV2(challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	var bestProof *Proof
+	for i := range matches {
+		quality := computeQualityV2(challenge, matches[i].Output, p.Header.KSize)
+		if bestProof == nil || quality < bestProof.Quality {
+			bestProof = p.proofFromEntryV2(challenge, &matches[i], quality)
+		}
+	}
+
+	// Return best eligible proof even if it doesn't meet difficulty (nil if none)
+	return bestProof, nil
+}
+
+// scanChallengeV2 scans the final table of an unindexed v2 plot
+func (p *PlotFile) scanChallengeV2(challenge [32]byte) (*Proof, error) {
+	if _, err := p.file.Seek(p.Header.Size(), io.SeekStart); err != nil {
+		return nil, fmt.Errorf("seek failed: %w", err)
+	}
+	r := bufio.NewReader(p.file)
+
+	target := challengeKey(challenge, p.Header.KSize)
+	var bestProof *Proof
+
+	for i := uint64(0); i < p.Header.NumHashes; i++ {
+		var entry plotEntryV2
+		if err := binary.Read(r, binary.LittleEndian, &entry); err != nil {
+			return nil, fmt.Errorf("read entry failed: %w", err)
+		}
+
+		if challengeKey(entry.Output, p.Header.KSize) != target {
+			continue
+		}
+
+		quality := computeQualityV2(challenge, entry.Output, p.Header.KSize)
+		if bestProof == nil || quality < bestProof.Quality {
+			bestProof = p.proofFromEntryV2(challenge, &entry, quality)
+		}
+	}
+
+	// Return best eligible proof even if it doesn't meet difficulty (nil if none)
+	return bestProof, nil
+}
+
+// proofFromEntryV2 builds a proof from a final table entry
+func (p *PlotFile) proofFromEntryV2(challenge [32]byte, entry *plotEntryV2, quality uint64) *Proof {
+	return &Proof{
+		Challenge:    challenge,
+		PlotID:       p.Header.PlotID,
+		Hash:         entry.Output,
+		Quality:      quality,
+		FarmerPubKey: p.Header.FarmerPubKey,
+		Version:      PlotVersion,
+		KSize:        p.Header.KSize,
+		XValues:      append([]uint32(nil), entry.XValues[:]...),
+		PlotSeed:     p.Header.PlotSeed,
+		PoolAddress:  p.Header.PoolAddress,
+	}
+}
+
 const (
 	// QMAX defines the maximum quality value (1 trillion)
 	// Quality and Difficulty operate in the same domain: [0, QMAX]
@@ -263,6 +492,25 @@ func VerifyProof(proof *Proof, challenge [32]byte, difficultyTarget uint64) bool
 		return false
 	}
 
+	switch proof.FormatVersion() {
+	case PlotVersionV1:
+		return verifyProofV1(proof, challenge, difficultyTarget)
+	case PlotVersion:
+		return verifyProofV2(proof, challenge, difficultyTarget)
+	default:
+		log.Printf("[PoSpace] REJECT: unknown plot version %d", proof.Version)
+		return false
+	}
+}
+
+// verifyProofV1 verifies a proof from a legacy v1 plot
+func verifyProofV1(proof *Proof, challenge [32]byte, difficultyTarget uint64) bool {
+	// v1 plots don't commit to a pool, so nothing binds a pool address to them
+	if proof.HasPool() {
+		log.Printf("[PoSpace] REJECT: v1 proof names a pool address")
+		return false
+	}
+
 	// Recompute the hash from farmer pubkey and index
 	expectedHash := computePlotHash(proof.FarmerPubKey[:], proof.PlotID[:], proof.Index)
 	if expectedHash != proof.Hash {
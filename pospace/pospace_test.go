@@ -1,8 +1,13 @@
 package pospace
 
 import (
+	"bytes"
 	"crypto/sha256"
+	"encoding/binary"
 	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -46,6 +51,13 @@ func TestVerifyComparison(t *testing.T) {
 		t.Fatalf("expected (q > difficulty) to fail: q=%d, diff=%d", q, q-1000)
 	}
 
+	// v1 plots don't commit to a pool, so a v1 proof can't name one
+	pooled := *proof
+	pooled.PoolAddress = [20]byte{0xaa}
+	if VerifyProof(&pooled, challenge, q) {
+		t.Fatal("expected v1 proof with a pool address to fail")
+	}
+
 	// Log the quality value for reference
 	t.Logf("Quality: %d (should be < QMAX=%d)", q, QMAX)
 }
@@ -126,3 +138,312 @@ func TestGoldenVectors(t *testing.T) {
 	}
 }
 
+
+func TestPlotV2ProofRoundTrip(t *testing.T) {
+	farmerPubKey := [33]byte{}
+	copy(farmerPubKey[:], []byte("test-farmer-pubkey-0123456789012"))
+
+	path := filepath.Join(t.TempDir(), "plot-v2.arcv")
+	if err := GeneratePlot(path, 12, farmerPubKey[:], [20]byte{}, [32]byte{1}); err != nil {
+		t.Fatalf("GeneratePlot: %v", err)
+	}
+
+	plot, err := OpenPlot(path)
+	if err != nil {
+		t.Fatalf("OpenPlot: %v", err)
+	}
+	defer plot.Close()
+
+	if plot.Header.Version != PlotVersion {
+		t.Fatalf("expected plot version %d, got %d", PlotVersion, plot.Header.Version)
+	}
+
+	// Find a challenge with at least one eligible entry
+	var proof *Proof
+	var challenge [32]byte
+	for i := 0; i < 64 && proof == nil; i++ {
+		challenge = sha256.Sum256([]byte{byte(i)})
+		proof, err = plot.CheckChallenge(challenge, QMAX)
+		if err != nil {
+			t.Fatalf("CheckChallenge: %v", err)
+		}
+	}
+	if proof == nil {
+		t.Fatal("no eligible entry found for 64 challenges")
+	}
+
+	if len(proof.XValues) != ProofSize {
+		t.Fatalf("expected %d x values, got %d", ProofSize, len(proof.XValues))
+	}
+	if !VerifyProof(proof, challenge, proof.Quality) {
+		t.Fatal("expected v2 proof to verify")
+	}
+
+	// Wrong challenge must fail
+	if VerifyProof(proof, sha256.Sum256([]byte("other")), QMAX) {
+		t.Fatal("expected proof to fail for a different challenge")
+	}
+
+	// Tampered x value must fail
+	tampered := *proof
+	tampered.XValues = append([]uint32(nil), proof.XValues...)
+	tampered.XValues[0] ^= 1
+	if VerifyProof(&tampered, challenge, QMAX) {
+		t.Fatal("expected tampered proof to fail")
+	}
+}
+
+func TestPlotV2IndexMatchesScan(t *testing.T) {
+	farmerPubKey := [33]byte{}
+	copy(farmerPubKey[:], []byte("test-farmer-pubkey-0123456789012"))
+
+	path := filepath.Join(t.TempDir(), "plot-v2.arcv")
+	if err := GeneratePlot(path, 12, farmerPubKey[:], [20]byte{}, [32]byte{1}); err != nil {
+		t.Fatalf("GeneratePlot: %v", err)
+	}
+
+	plot, err := OpenPlot(path)
+	if err != nil {
+		t.Fatalf("OpenPlot: %v", err)
+	}
+	defer plot.Close()
+
+	if !plot.Indexed() {
+		t.Fatal("expected generated plot to be indexed")
+	}
+
+	for i := 0; i < 256; i++ {
+		challenge := sha256.Sum256([]byte{byte(i), 0x42})
+
+		indexed, err := plot.CheckChallenge(challenge, QMAX)
+		if err != nil {
+			t.Fatalf("indexed lookup: %v", err)
+		}
+		scanned, err := plot.scanChallengeV2(challenge)
+		if err != nil {
+			t.Fatalf("linear scan: %v", err)
+		}
+
+		if (indexed == nil) != (scanned == nil) {
+			t.Fatalf("challenge %d: indexed=%v scanned=%v", i, indexed != nil, scanned != nil)
+		}
+		if indexed != nil && (indexed.Hash != scanned.Hash || indexed.Quality != scanned.Quality) {
+			t.Fatalf("challenge %d: indexed and scanned proofs differ", i)
+		}
+	}
+}
+
+func TestPlotV2SeedAndPoolBinding(t *testing.T) {
+	farmerPubKey := [33]byte{}
+	copy(farmerPubKey[:], []byte("test-farmer-pubkey-0123456789012"))
+
+	seedA, seedB := [32]byte{1}, [32]byte{2}
+	pool := [20]byte{0xaa}
+	if ComputePlotID(farmerPubKey[:], pool, seedA) == ComputePlotID(farmerPubKey[:], pool, seedB) {
+		t.Fatal("different seeds must give different plot IDs")
+	}
+
+	path := filepath.Join(t.TempDir(), "plot-v2.arcv")
+	if err := GeneratePlot(path, 12, farmerPubKey[:], pool, seedA); err != nil {
+		t.Fatalf("GeneratePlot: %v", err)
+	}
+
+	plot, err := OpenPlot(path)
+	if err != nil {
+		t.Fatalf("OpenPlot: %v", err)
+	}
+	defer plot.Close()
+
+	if plot.Header.PlotSeed != seedA || plot.Header.PoolAddress != pool ||
+		plot.Header.PlotID != ComputePlotID(farmerPubKey[:], pool, seedA) {
+		t.Fatal("plot header does not carry the seed, pool and derived plot ID")
+	}
+
+	var proof *Proof
+	var challenge [32]byte
+	for i := 0; i < 64 && proof == nil; i++ {
+		challenge = sha256.Sum256([]byte{byte(i)})
+		proof, err = plot.CheckChallenge(challenge, QMAX)
+		if err != nil {
+			t.Fatalf("CheckChallenge: %v", err)
+		}
+	}
+	if proof == nil {
+		t.Fatal("no eligible entry found for 64 challenges")
+	}
+	if !VerifyProof(proof, challenge, QMAX) {
+		t.Fatal("expected proof to verify")
+	}
+
+	// A proof claiming another seed must not verify
+	forged := *proof
+	forged.PlotSeed = seedB
+	if VerifyProof(&forged, challenge, QMAX) {
+		t.Fatal("expected proof with wrong seed to fail")
+	}
+
+	// Redirecting the pool share to another address must not verify
+	forged = *proof
+	forged.PoolAddress = [20]byte{0xbb}
+	if VerifyProof(&forged, challenge, QMAX) {
+		t.Fatal("expected proof with wrong pool address to fail")
+	}
+}
+
+func TestUnseededPlotHeader(t *testing.T) {
+	// Multi-table plots from before the seed was added keep the short header
+	h := PlotHeader{Magic: PlotMagic, Version: plotVersionUnseeded, KSize: 12, NumHashes: 7}
+	var buf bytes.Buffer
+	if err := writeHeader(&buf, &h); err != nil {
+		t.Fatalf("writeHeader: %v", err)
+	}
+	if int64(buf.Len()) != h.Size() || h.Size() != int64(binary.Size(plotHeaderV1{})) {
+		t.Fatalf("expected %d byte header, wrote %d", binary.Size(plotHeaderV1{}), buf.Len())
+	}
+	buf.Write(bytes.Repeat([]byte{0xff}, 64)) // First entries follow the header
+	file := bytes.Clone(buf.Bytes())
+	read, err := readHeader(&buf)
+	if err != nil {
+		t.Fatalf("readHeader: %v", err)
+	}
+	if read != h {
+		t.Fatal("unseeded header read with the seed and pool layout")
+	}
+
+	path := filepath.Join(t.TempDir(), "unseeded.arcv")
+	if err := os.WriteFile(path, file, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenPlot(path); err == nil || !strings.Contains(err.Error(), "re-plot") {
+		t.Fatalf("expected unseeded plot to be rejected, got %v", err)
+	}
+}
+
+func TestPlotterResume(t *testing.T) {
+	farmerPubKey := [33]byte{}
+	copy(farmerPubKey[:], []byte("test-farmer-pubkey-0123456789012"))
+	dir := t.TempDir()
+
+	// Reference plot generated in one go
+	fullPath := filepath.Join(dir, "full.arcv")
+	if err := GeneratePlot(fullPath, 12, farmerPubKey[:], [20]byte{}, [32]byte{7}); err != nil {
+		t.Fatalf("GeneratePlot: %v", err)
+	}
+
+	// Build two tables, checkpoint, then "crash"
+	path := filepath.Join(dir, "resumed.arcv")
+	plotter, err := NewPlotter(path, 12, farmerPubKey[:], [20]byte{}, [32]byte{7}, 2)
+	if err != nil {
+		t.Fatalf("NewPlotter: %v", err)
+	}
+	for table := 1; table <= 2; table++ {
+		if err := plotter.buildTable(table); err != nil {
+			t.Fatalf("buildTable(%d): %v", table, err)
+		}
+		if err := plotter.saveCheckpoint(table); err != nil {
+			t.Fatalf("saveCheckpoint(%d): %v", table, err)
+		}
+	}
+
+
+	// Crash while checkpointing table 3: its outputs are written but the
+	// progress file still names table 2
+	if err := plotter.buildTable(3); err != nil {
+		t.Fatalf("buildTable(3): %v", err)
+	}
+	if err := writeSliceFile(plotter.outputsPath(3), plotter.outputs); err != nil {
+		t.Fatalf("writeSliceFile: %v", err)
+	}
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatal("unfinished plot must not exist at its final path")
+	}
+	unfinished, err := FindUnfinishedPlots(dir)
+	if err != nil || len(unfinished) != 1 || unfinished[0] != path {
+		t.Fatalf("expected %s to be unfinished, got %v (%v)", path, unfinished, err)
+	}
+	if _, err := NewPlotter(path, 12, farmerPubKey[:], [20]byte{}, [32]byte{7}, 2); err == nil {
+		t.Fatal("expected NewPlotter to refuse a path with a checkpoint")
+	}
+	if id, err := UnfinishedPlotID(path); err != nil || id != ComputePlotID(farmerPubKey[:], [20]byte{}, [32]byte{7}) {
+		t.Fatalf("expected the checkpoint to name the plot ID, got %x (%v)", id, err)
+	}
+
+	resumed, err := ResumePlotter(path, 3)
+	if err != nil {
+		t.Fatalf("ResumePlotter: %v", err)
+	}
+	if resumed.CompletedTables() != 2 {
+		t.Fatalf("expected 2 completed tables, got %d", resumed.CompletedTables())
+	}
+	var built []int
+	resumed.Progress = func(table, entries int) { built = append(built, table) }
+	if err := resumed.Run(); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(built) != 2 || built[0] != 3 || built[1] != 4 {
+		t.Fatalf("expected progress for tables 3 and 4, got %v", built)
+	}
+
+	want, _ := os.ReadFile(fullPath)
+	got, _ := os.ReadFile(path)
+	if !bytes.Equal(want, got) {
+		t.Fatal("resumed plot differs from plot generated in one go")
+	}
+
+	files, _ := os.ReadDir(dir)
+	if len(files) != 2 {
+		t.Fatalf("expected only the two plots to remain, found %d files", len(files))
+	}
+}
+
+func TestPlotCheckDetectsCorruption(t *testing.T) {
+	farmerPubKey := [33]byte{}
+	copy(farmerPubKey[:], []byte("test-farmer-pubkey-0123456789012"))
+
+	path := filepath.Join(t.TempDir(), "plot-v2.arcv")
+	if err := GeneratePlot(path, 12, farmerPubKey[:], [20]byte{}, [32]byte{1}); err != nil {
+		t.Fatalf("GeneratePlot: %v", err)
+	}
+
+	plot, err := OpenPlot(path)
+	if err != nil {
+		t.Fatalf("OpenPlot: %v", err)
+	}
+	if err := plot.ValidateHeader(); err != nil {
+		t.Fatalf("ValidateHeader: %v", err)
+	}
+	for i := uint64(0); i < plot.Header.NumHashes; i += 97 {
+		if err := plot.VerifyEntry(i); err != nil {
+			t.Fatalf("VerifyEntry(%d): %v", i, err)
+		}
+	}
+	if wins, err := plot.SimulateChallenges(16, QMAX); err != nil || wins == 0 {
+		t.Fatalf("SimulateChallenges: wins=%d err=%v", wins, err)
+	}
+	offset := plot.Header.Size() + 5*entrySizeV2 + 32
+	plot.Close()
+
+	// Flip a bit in the x values of entry 5
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b [1]byte
+	f.ReadAt(b[:], offset)
+	b[0] ^= 1
+	f.WriteAt(b[:], offset)
+	f.Close()
+
+	plot, err = OpenPlot(path)
+	if err != nil {
+		t.Fatalf("OpenPlot: %v", err)
+	}
+	defer plot.Close()
+	if err := plot.VerifyEntry(5); err == nil {
+		t.Fatal("expected corrupted entry to fail verification")
+	}
+	if err := plot.VerifyEntry(6); err != nil {
+		t.Fatalf("VerifyEntry(6): %v", err)
+	}
+}
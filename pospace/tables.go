@@ -0,0 +1,220 @@
+package pospace
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"sort"
+)
+
+// Plot format v2: multi-table matching construction
+//
+// Table 1 holds f1(x) for every x in [0, 2^k). Each following table is built by
+// pairing entries of the previous table whose outputs collide in their top k-1
+// bits, so finding table entries requires building and sorting every table in
+// full. Only the final table is written to disk, together with the 2^(n-1)
+// table-1 x values each entry was derived from. Those x values are the proof:
+// a verifier recomputes the tree from them with a handful of hashes.
+
+const (
+	// NumTables is the number of tables in a v2 plot
+	NumTables = 4
+	// ProofSize is the number of x values in a v2 proof
+	ProofSize = 1 << (NumTables - 1)
+	// MinKSize and MaxKSize bound the k parameter accepted for v2 plots. The
+	// plotter holds every table in memory, about 2^k * 32 bytes of outputs
+	// plus their links, so k is capped at what it can build (~4 GiB at 26).
+	MinKSize = 10
+	MaxKSize = 26
+	// maxKSizeV1 bounds legacy v1 plots, which are streamed to disk
+	maxKSizeV1 = 32
+
+	// entrySizeV2 is the on-disk size of a final table entry (output + x values)
+	entrySizeV2 = 32 + ProofSize*4
+)
+
+// tableLink points at the two entries of the previous table an entry was built from
+type tableLink struct {
+	Left  uint32
+	Right uint32
+}
+
+// plotEntryV2 is a single final table entry as stored in a v2 plot file
+type plotEntryV2 struct {
+	Output  [32]byte
+	XValues [ProofSize]uint32
+}
+
+// computeF1 computes the table 1 output for x
+func computeF1(farmerPubKey []byte, plotID []byte, kSize uint32, x uint32) [32]byte {
+	h := sha256.New()
+	h.Write([]byte{1})
+	h.Write(farmerPubKey)
+	h.Write(plotID)
+	binary.Write(h, binary.LittleEndian, kSize)
+	binary.Write(h, binary.LittleEndian, x)
+	var out [32]byte
+	copy(out[:], h.Sum(nil))
+	return out
+}
+
+// computeFx computes the output of a table entry from its two matched children
+func computeFx(table uint8, plotID []byte, left, right [32]byte) [32]byte {
+	h := sha256.New()
+	h.Write([]byte{table})
+	h.Write(plotID)
+	h.Write(left[:])
+	h.Write(right[:])
+	var out [32]byte
+	copy(out[:], h.Sum(nil))
+	return out
+}
+
+// matchKey returns the bucket an output falls in for matching (top k-1 bits)
+func matchKey(out [32]byte, kSize uint32) uint64 {
+	return binary.BigEndian.Uint64(out[:8]) >> (64 - (kSize - 1))
+}
+
+// challengeKey returns the top k bits of a hash, used to select which final
+// entries are eligible for a challenge
+func challengeKey(h [32]byte, kSize uint32) uint64 {
+	return binary.BigEndian.Uint64(h[:8]) >> (64 - kSize)
+}
+
+// computeQualityV2 scales the quality of an eligible v2 entry by the plot size.
+// A plot has on average one eligible entry per challenge, so dividing by 2^k
+// gives the same win probability as taking the best of 2^k v1 entries.
+func computeQualityV2(challenge [32]byte, hash [32]byte, kSize uint32) uint64 {
+	return computeQuality(challenge, hash) >> kSize
+}
+
+// outputsMatch reports whether two entries of the same table form a valid pair
+func outputsMatch(left, right [32]byte, kSize uint32) bool {
+	return matchKey(left, kSize) == matchKey(right, kSize) && bytes.Compare(left[:], right[:]) < 0
+}
+
+// sortOutputs returns the permutation that orders outputs by match key, then by value
+func sortOutputs(outputs [][32]byte, kSize uint32) []uint32 {
+	order := make([]uint32, len(outputs))
+	for i := range order {
+		order[i] = uint32(i)
+	}
+	sort.Slice(order, func(i, j int) bool {
+		a, b := outputs[order[i]], outputs[order[j]]
+		ka, kb := matchKey(a, kSize), matchKey(b, kSize)
+		if ka != kb {
+			return ka < kb
+		}
+		return bytes.Compare(a[:], b[:]) < 0
+	})
+	return order
+}
+
+// findMatches pairs colliding entries of a sorted table. The result is
+// capped at maxEntries so table sizes stay around 2^k.
+func findMatches(outputs [][32]byte, kSize uint32, maxEntries uint64) []tableLink {
+	var links []tableLink
+
+	for start := 0; start < len(outputs); {
+		end := start + 1
+		key := matchKey(outputs[start], kSize)
+		for end < len(outputs) && matchKey(outputs[end], kSize) == key {
+			end++
+		}
+
+		for l := start; l < end; l++ {
+			for r := l + 1; r < end; r++ {
+				if uint64(len(links)) >= maxEntries {
+					return links
+				}
+				links = append(links, tableLink{Left: uint32(l), Right: uint32(r)})
+			}
+		}
+		start = end
+	}
+
+	return links
+}
+
+// collectXValues appends the table 1 x values under an entry, left to right
+func collectXValues(links [][]tableLink, xs []uint32, table int, idx uint32, dst []uint32) []uint32 {
+	if table == 1 {
+		return append(dst, xs[idx])
+	}
+	link := links[table][idx]
+	dst = collectXValues(links, xs, table-1, link.Left, dst)
+	return collectXValues(links, xs, table-1, link.Right, dst)
+}
+
+// evaluateProofV2 recomputes the final output from a proof's x values,
+// checking every pair along the way
+func evaluateProofV2(farmerPubKey []byte, plotID []byte, kSize uint32, xValues []uint32) ([32]byte, error) {
+	if kSize < MinKSize || kSize > MaxKSize {
+		return [32]byte{}, fmt.Errorf("k size %d out of range", kSize)
+	}
+	if len(xValues) != ProofSize {
+		return [32]byte{}, fmt.Errorf("expected %d x values, got %d", ProofSize, len(xValues))
+	}
+
+	level := make([][32]byte, ProofSize)
+	for i, x := range xValues {
+		if uint64(x) >= uint64(1)<<kSize {
+			return [32]byte{}, fmt.Errorf("x value %d out of range for k=%d", x, kSize)
+		}
+		level[i] = computeF1(farmerPubKey, plotID, kSize, x)
+	}
+
+	for t := 2; t <= NumTables; t++ {
+		next := make([][32]byte, len(level)/2)
+		for i := range next {
+			left, right := level[2*i], level[2*i+1]
+			if !outputsMatch(left, right, kSize) {
+				return [32]byte{}, fmt.Errorf("table %d pair %d does not match", t-1, i)
+			}
+			next[i] = computeFx(uint8(t), plotID, left, right)
+		}
+		level = next
+	}
+
+	return level[0], nil
+}
+
+// verifyProofV2 verifies a proof from a v2 plot
+func verifyProofV2(proof *Proof, challenge [32]byte, difficultyTarget uint64) bool {
+	// The plot ID must be derived from the farmer key, pool address and plot seed
+	if ComputePlotID(proof.FarmerPubKey[:], proof.PoolAddress, proof.PlotSeed) != proof.PlotID {
+		log.Printf("[PoSpace] REJECT: plot ID not bound to farmer key, pool and seed (plotID=%x)", proof.PlotID[:8])
+		return false
+	}
+
+	output, err := evaluateProofV2(proof.FarmerPubKey[:], proof.PlotID[:], proof.KSize, proof.XValues)
+	if err != nil {
+		log.Printf("[PoSpace] REJECT: invalid v2 proof: %v", err)
+		return false
+	}
+	if output != proof.Hash {
+		log.Printf("[PoSpace] REJECT: hash mismatch (proof=%x, expected=%x)", proof.Hash[:8], output[:8])
+		return false
+	}
+
+	// Only entries whose output shares the challenge's top k bits are eligible
+	if challengeKey(output, proof.KSize) != challengeKey(challenge, proof.KSize) {
+		log.Printf("[PoSpace] REJECT: proof not eligible for challenge %x", challenge[:8])
+		return false
+	}
+
+	quality := computeQualityV2(challenge, output, proof.KSize)
+	if quality != proof.Quality {
+		log.Printf("[PoSpace] REJECT: quality mismatch (proof=%d, computed=%d)", proof.Quality, quality)
+		return false
+	}
+
+	if quality > difficultyTarget {
+		log.Printf("[PoSpace] REJECT: quality too high (quality=%d, target=%d)", quality, difficultyTarget)
+		return false
+	}
+
+	return true
+}
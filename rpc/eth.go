@@ -386,7 +386,7 @@ func (h *ETHHandler) getBlockByNumber_handler(params json.RawMessage) (interface
 
 	// Try to convert to types.Block
 	if typedBlock, ok := blockRaw.(*types.Block); ok {
-		return convertTypesBlockToEthBlock(typedBlock, fullTx), nil
+		return convertTypesBlockToEthBlock(typedBlock, fullTx)
 	}
 
 	return nil, fmt.Errorf("unexpected block type")
@@ -445,7 +445,7 @@ func (h *ETHHandler) getBlockByHash_handler(params json.RawMessage) (interface{}
 
 	// Try to convert to types.Block
 	if typedBlock, ok := blockRaw.(*types.Block); ok {
-		return convertTypesBlockToEthBlock(typedBlock, fullTx), nil
+		return convertTypesBlockToEthBlock(typedBlock, fullTx)
 	}
 
 	return nil, fmt.Errorf("unexpected block type")
@@ -861,7 +861,7 @@ func convertLegacyBlockToEthBlock(legacyBlock map[string]interface{}, fullTx boo
 }
 
 // convertTypesBlockToEthBlock converts types.Block to Ethereum format
-func convertTypesBlockToEthBlock(block *types.Block, fullTx bool) map[string]interface{} {
+func convertTypesBlockToEthBlock(block *types.Block, fullTx bool) (map[string]interface{}, error) {
 	// Build transaction list
 	transactions := make([]interface{}, 0)
 	if !fullTx {
@@ -885,7 +885,15 @@ func convertTypesBlockToEthBlock(block *types.Block, fullTx bool) map[string]int
 	}
 
 	// Compute block hash
-	blockHash := block.Hash()
+	blockHash, err := block.Hash()
+	if err != nil {
+		return nil, fmt.Errorf("block %d: %w", block.Height, err)
+	}
+
+	totalWork := block.CumulativeWork
+	if totalWork == nil {
+		totalWork = new(big.Int)
+	}
 	
 	// Compute transactions root (use helper or compute from block)
 	txRoot := [32]byte{} // Simplified - would need proper merkle tree
@@ -906,7 +914,7 @@ func convertTypesBlockToEthBlock(block *types.Block, fullTx bool) map[string]int
 		"receiptsRoot":     "0x" + hex.EncodeToString(block.ReceiptsRoot[:]),
 		"miner":            ensureValidMinerAddress(block.FarmerAddr.Hex()),
 		"difficulty":       fmt.Sprintf("0x%x", block.Difficulty),
-		"totalDifficulty":  fmt.Sprintf("0x%x", block.CumulativeWork),
+		"totalDifficulty":  fmt.Sprintf("0x%x", totalWork),
 		"extraData":        "0x",
 		"size":             "0x400", // Placeholder - block size not tracked
 		"gasLimit":         fmt.Sprintf("0x%x", block.GasLimit),
@@ -916,7 +924,7 @@ func convertTypesBlockToEthBlock(block *types.Block, fullTx bool) map[string]int
 		"uncles":           []interface{}{},
 	}
 
-	return ethBlock
+	return ethBlock, nil
 }
 
 // ensureHexPrefix adds 0x prefix if not present
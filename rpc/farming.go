@@ -3,8 +3,10 @@ package rpc
 import (
 	"context"
 	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math/big"
@@ -32,7 +34,7 @@ import (
 
 // NodeState interface for farming operations
 type NodeState interface {
-	AcceptBlock(proof *pospace.Proof, farmerAddr string, farmerPubKey []byte) error
+	AcceptBlock(proof *pospace.Proof, farmerAddr string, farmerSig []byte) error
 	GetCurrentChallenge() ([32]byte, uint64, uint64)
 	GetStatus() (height uint64, difficulty uint64, tipHash [32]byte)
 	GetCurrentVDF() (seed []byte, iterations uint64, output []byte, hasVDF bool)
@@ -56,6 +58,8 @@ type FarmingServer struct {
 	faucetAddress string
 	faucetLimit   map[string]time.Time // IP -> last drip time
 	faucetMutex   sync.Mutex
+	timelordToken string // Bearer token required on /vdf/update
+	adminToken    string // Bearer token required on /admin routes
 	listenAddr    string
 
 	// Cached chain tip status to avoid lock contention on /chainTip endpoint
@@ -197,6 +201,12 @@ func NewFarmingServer(ws *ledger.WorldState, mp *mempool.Mempool, ns NodeState)
 			log.Printf("[submitTx] Encoded signature: R=%d bytes, S=%d bytes, V=%d",
 				len(rBytes), len(sBytes), signature[64])
 			
+			// Blocks only include transfers the ledger can verify; any other
+			// would sit in the mempool for good
+			if err := ledger.VerifyTransaction(ledgerTx); err != nil {
+				return fmt.Errorf("transaction cannot be verified by the ledger: %w", err)
+			}
+
 			// Add to mempool
 			mp.Add(ledgerTx)
 			
@@ -220,6 +230,18 @@ func NewFarmingServer(ws *ledger.WorldState, mp *mempool.Mempool, ns NodeState)
 	}
 }
 
+// SetTimelordToken sets the bearer token the timelord must present to
+// publish VDF updates. Without one, VDF updates are refused.
+func (s *FarmingServer) SetTimelordToken(token string) {
+	s.timelordToken = token
+}
+
+// SetAdminToken sets the bearer token required on /admin routes. Without
+// one, admin routes are refused.
+func (s *FarmingServer) SetAdminToken(token string) {
+	s.adminToken = token
+}
+
 // EnableFaucet enables the built-in faucet with a funding private key
 func (s *FarmingServer) EnableFaucet(privKeyHex string) error {
 	privKeyBytes, err := hex.DecodeString(privKeyHex)
@@ -257,6 +279,7 @@ func (s *FarmingServer) Start(addr string) error {
 
 	// Farming endpoints
 	http.HandleFunc("/challenge", s.wrapMetrics("/challenge", s.handleGetChallenge))
+	http.HandleFunc("/blockTemplate", s.wrapMetrics("/blockTemplate", s.handleBlockTemplate))
 	http.HandleFunc("/submitBlock", s.wrapMetrics("/submitBlock", s.handleSubmitBlock))
 
 	// VDF/Timelord endpoints
@@ -269,6 +292,7 @@ func (s *FarmingServer) Start(addr string) error {
 	http.HandleFunc("/healthz", s.wrapMetrics("/healthz", s.handleHealthz))
 	http.HandleFunc("/peers", s.wrapMetrics("/peers", s.handlePeers))
 	http.HandleFunc("/health", s.wrapMetrics("/health", s.handleHealthDetailed))
+	http.HandleFunc("/admin/bans", s.wrapMetrics("/admin/bans", s.handleAdminBans))
 	
 	// Account endpoints
 	http.HandleFunc("/accounts", s.wrapMetrics("/accounts", s.handleAllAccounts))
@@ -467,9 +491,10 @@ func (s *FarmingServer) handleSubmitBlock(w http.ResponseWriter, r *http.Request
 
 	// Decode directly to pospace.Proof to avoid interface{} issues
 	var submission struct {
-		Proof        *pospace.Proof `json:"proof"`
-		FarmerAddr   string         `json:"farmerAddr"`
-		FarmerPubKey string         `json:"farmerPubKey"`
+		Proof      *pospace.Proof `json:"proof"`
+		FarmerAddr string         `json:"farmerAddr"`
+		Hash       string         `json:"hash"`      // Block template hash, hex (replaces proof and farmerAddr)
+		Signature  string         `json:"signature"` // Farmer header or template hash signed by the plot key, hex
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&submission); err != nil {
@@ -477,15 +502,15 @@ func (s *FarmingServer) handleSubmitBlock(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// Decode farmer public key
-	farmerPubKey, err := hex.DecodeString(submission.FarmerPubKey)
+	// Decode farmer signature
+	farmerSig, err := hex.DecodeString(submission.Signature)
 	if err != nil {
-		http.Error(w, "Invalid farmer public key", http.StatusBadRequest)
+		http.Error(w, "Invalid farmer signature", http.StatusBadRequest)
 		return
 	}
 
 	// Accept the block
-	if err := s.nodeState.AcceptBlock(submission.Proof, submission.FarmerAddr, farmerPubKey); err != nil {
+	if err := s.submitBlock(submission.Hash, submission.Proof, submission.FarmerAddr, farmerSig); err != nil {
 		response := SubmitTxResponse{
 			Status:  "error",
 			Message: fmt.Sprintf("Block rejected: %v", err),
@@ -505,6 +530,65 @@ func (s *FarmingServer) handleSubmitBlock(w http.ResponseWriter, r *http.Request
 	json.NewEncoder(w).Encode(response)
 }
 
+// submitBlock hands a signed block template, or a proof for the node to
+// build the block from, to the node
+func (s *FarmingServer) submitBlock(hash string, proof *pospace.Proof, farmerAddr string, farmerSig []byte) error {
+	if hash == "" {
+		return s.nodeState.AcceptBlock(proof, farmerAddr, farmerSig)
+	}
+	templates, ok := s.nodeState.(blockTemplater)
+	if !ok {
+		return errors.New("block templates not supported")
+	}
+	raw, err := hex.DecodeString(hash)
+	if err != nil || len(raw) != 32 {
+		return errors.New("invalid block template hash")
+	}
+	return templates.SubmitSignedBlock([32]byte(raw), farmerSig)
+}
+
+// blockTemplater is implemented by nodes that build blocks for farmers to
+// sign by hash
+type blockTemplater interface {
+	BlockTemplate(proof *pospace.Proof, farmerAddr string) (height uint64, hash []byte, err error)
+	SubmitSignedBlock(hash [32]byte, farmerSig []byte) error
+}
+
+// handleBlockTemplate handles POST /blockTemplate: the node builds the block
+// a farmer's proof wins and returns the hash the farmer signs to submit it.
+// Without a hash the farmer signs its farmer header and submits the proof.
+func (s *FarmingServer) handleBlockTemplate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	templates, ok := s.nodeState.(blockTemplater)
+	if !ok {
+		http.Error(w, "Block templates not supported", http.StatusNotImplemented)
+		return
+	}
+
+	var req struct {
+		Proof      *pospace.Proof `json:"proof"`
+		FarmerAddr string         `json:"farmerAddr"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Proof == nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	height, hash, err := templates.BlockTemplate(req.Proof, req.FarmerAddr)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Block template rejected: %v", err), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"height": height,
+		"hash":   hex.EncodeToString(hash),
+	})
+}
+
 // handleBalance handles GET /balance/<addr> (reused from original server)
 func (s *FarmingServer) handleBalance(w http.ResponseWriter, r *http.Request) {
 	// Same implementation as original Server
@@ -880,6 +964,14 @@ func (s *FarmingServer) handleVDFUpdate(w http.ResponseWriter, r *http.Request)
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	if s.timelordToken == "" {
+		http.Error(w, "VDF updates disabled (node has no -timelord-token)", http.StatusForbidden)
+		return
+	}
+	if !hasBearerToken(r, s.timelordToken) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
 
 	var update VDFUpdateRequest
 	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
@@ -887,12 +979,14 @@ func (s *FarmingServer) handleVDFUpdate(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Store VDF update in node state (for /challenge to include)
-	// In full VDF mode, this would also verify and enforce VDF proofs
+	// Verify and store VDF update in node state (for /challenge to include)
 	if updater, ok := s.nodeState.(interface {
-		UpdateVDFState(seed []byte, iterations uint64, output []byte)
+		UpdateVDFState(seed []byte, iterations uint64, output []byte, checkpoints [][]byte) error
 	}); ok {
-		updater.UpdateVDFState(update.Seed, update.Iterations, update.Output)
+		if err := updater.UpdateVDFState(update.Seed, update.Iterations, update.Output, update.Checkpoints); err != nil {
+			http.Error(w, fmt.Sprintf("VDF update rejected: %v", err), http.StatusBadRequest)
+			return
+		}
 	}
 
 	seedPreview := update.Seed
@@ -916,6 +1010,12 @@ func (s *FarmingServer) handleVDFUpdate(w http.ResponseWriter, r *http.Request)
 	json.NewEncoder(w).Encode(response)
 }
 
+// hasBearerToken reports whether r carries token in its Authorization header
+func hasBearerToken(r *http.Request, token string) bool {
+	got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && token != "" && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
+
 // handleGenesisHash handles GET /genesisHash
 func (s *FarmingServer) handleGenesisHash(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -995,6 +1095,43 @@ func (s *FarmingServer) handlePeers(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// handleAdminBans handles /admin/bans, which requires the admin token: GET
+// lists banned peer hosts, DELETE lifts the ban of ?host= (or every ban
+// without it)
+func (s *FarmingServer) handleAdminBans(w http.ResponseWriter, r *http.Request) {
+	if s.adminToken == "" {
+		http.Error(w, "Admin routes disabled (node has no -admin-token)", http.StatusForbidden)
+		return
+	}
+	if !hasBearerToken(r, s.adminToken) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	bans, ok := s.nodeState.(interface {
+		ListBans() interface{}
+		ClearBans(host string) int
+	})
+	if !ok {
+		http.Error(w, "Peer bans not supported", http.StatusNotImplemented)
+		return
+	}
+
+	var response interface{}
+	switch r.Method {
+	case http.MethodGet:
+		response = map[string]interface{}{"bans": bans.ListBans()}
+	case http.MethodDelete:
+		response = map[string]interface{}{"cleared": bans.ClearBans(r.URL.Query().Get("host"))}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
 // handleAllAccounts handles GET /accounts - returns all addresses with balances
 func (s *FarmingServer) handleAllAccounts(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -2206,6 +2343,7 @@ func (s *FarmingServer) handleSubmitV1(w http.ResponseWriter, r *http.Request) {
 		Nonce:        stx.Tx.Nonce,
 		SenderPubKey: pubKeyBytes,
 		Signature:    sigBytes,
+		Memo:         stx.Tx.Memo,
 	}
 
 	// Verify sender account exists and has sufficient balance
@@ -11,9 +11,10 @@ type ChainTipResponse struct {
 
 // VDFUpdateRequest represents a VDF update from timelord
 type VDFUpdateRequest struct {
-	Seed       []byte `json:"seed"`
-	Iterations uint64 `json:"iterations"`
-	Output     []byte `json:"output"`
+	Seed        []byte   `json:"seed"`
+	Iterations  uint64   `json:"iterations"`
+	Output      []byte   `json:"output"`
+	Checkpoints [][]byte `json:"checkpoints,omitempty"` // Hash-chain outputs splitting the run into equal segments
 }
 
 // Note: BalanceResponse and SubmitTxResponse are defined in rpc.go
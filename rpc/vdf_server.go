@@ -16,7 +16,7 @@ type VDFNodeState interface {
 		vdfSeed []byte, vdfIterations uint64, vdfOutput []byte) error
 	GetCurrentChallengeVDF() ([32]byte, uint64, uint64, []byte, uint64, []byte)
 	GetChainTip() ([32]byte, uint64, uint64)
-	UpdateVDF(seed []byte, iterations uint64, output []byte) error
+	UpdateVDF(seed []byte, iterations uint64, output []byte, checkpoints [][]byte) error
 }
 
 // VDFServer extends Server with VDF capabilities
@@ -108,7 +108,7 @@ func (s *VDFServer) handleVDFUpdate(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Update VDF state
-	if err := s.nodeState.UpdateVDF(update.Seed, update.Iterations, update.Output); err != nil {
+	if err := s.nodeState.UpdateVDF(update.Seed, update.Iterations, update.Output, update.Checkpoints); err != nil {
 		response := SubmitTxResponse{
 			Status:  "error",
 			Message: fmt.Sprintf("VDF update rejected: %v", err),
@@ -2,15 +2,25 @@ package storage
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
+
+	badger "github.com/dgraph-io/badger/v3"
 )
 
 // Key prefixes for different data types
 var (
-	PrefixBlock      = []byte("blk:") // blk:<height> → block data
-	PrefixAccount    = []byte("acc:") // acc:<address> → account state
+	PrefixBlock      = []byte("blk:")  // blk:<height> → block data (legacy, before the block index)
+	PrefixBlockHash  = []byte("bh:")   // bh:<hash> → block data, for every known block
+	PrefixBlockIndex = []byte("bi:")   // bi:<hash> → BlockIndexEntry
+	PrefixHeight     = []byte("hi:")   // hi:<height> → hashes of all blocks at height
+	PrefixBest       = []byte("best:") // best:<height> → hash of the best-chain block
+	PrefixAccount    = []byte("acc:")  // acc:<address> → account state
+	PrefixUndo       = []byte("undo:") // undo:<hash> → account states before the block
 	KeyTipHeight     = []byte("meta:tip_height")
 	KeyDifficulty    = []byte("meta:difficulty")
+	KeyDiffParams    = []byte("meta:difficulty_params")
+	KeyUpgrades      = []byte("meta:upgrades")
 	KeyVDFSeed       = []byte("meta:vdf_seed")
 	KeyVDFIterations = []byte("meta:vdf_iterations")
 	KeyVDFOutput     = []byte("meta:vdf_output")
@@ -28,22 +38,94 @@ func NewBlockStorage(db *DB) *BlockStorage {
 	return &BlockStorage{db: db}
 }
 
-// SaveBlock persists a block
-func (bs *BlockStorage) SaveBlock(height uint64, blockData interface{}) error {
-	key := makeBlockKey(height)
-	return bs.db.PutJSON(key, blockData)
+// BlockIndexEntry links a stored block to its parent
+type BlockIndexEntry struct {
+	Height     uint64   `json:"height"`
+	Parent     [32]byte `json:"parent"`
+	Difficulty uint64   `json:"difficulty"`
+}
+
+// SaveBlock persists a block under its hash and indexes it, without making it
+// part of the best chain
+func (bs *BlockStorage) SaveBlock(hash [32]byte, entry BlockIndexEntry, blockData interface{}) error {
+	return bs.db.Batch(func(b *Batch) error {
+		return b.SaveBlock(hash, entry, blockData)
+	})
+}
+
+// SaveBestBlock persists a block and makes it the best-chain block at its height
+func (bs *BlockStorage) SaveBestBlock(hash [32]byte, entry BlockIndexEntry, blockData interface{}) error {
+	return bs.db.Batch(func(b *Batch) error {
+		if err := b.SaveBlock(hash, entry, blockData); err != nil {
+			return err
+		}
+		return b.SetBest(entry.Height, hash)
+	})
 }
 
-// LoadBlock retrieves a block
+// LoadBlock retrieves the best-chain block at height
 func (bs *BlockStorage) LoadBlock(height uint64, blockData interface{}) error {
-	key := makeBlockKey(height)
-	return bs.db.GetJSON(key, blockData)
+	hash, err := bs.BestHash(height)
+	if err != nil {
+		return bs.db.GetJSON(makeBlockKey(height), blockData)
+	}
+	return bs.LoadBlockByHash(hash, blockData)
 }
 
-// HasBlock checks if a block exists
+// HasBlock checks if the best chain has a block at height
 func (bs *BlockStorage) HasBlock(height uint64) bool {
-	key := makeBlockKey(height)
-	return bs.db.Has(key)
+	return bs.db.Has(makeBestKey(height)) || bs.db.Has(makeBlockKey(height))
+}
+
+// BestHash returns the hash of the best-chain block at height
+func (bs *BlockStorage) BestHash(height uint64) ([32]byte, error) {
+	var hash [32]byte
+	data, err := bs.db.Get(makeBestKey(height))
+	if err != nil {
+		return hash, err
+	}
+	if len(data) != 32 {
+		return hash, fmt.Errorf("invalid best hash at height %d", height)
+	}
+	copy(hash[:], data)
+	return hash, nil
+}
+
+// LoadBlockByHash retrieves any stored block by hash
+func (bs *BlockStorage) LoadBlockByHash(hash [32]byte, blockData interface{}) error {
+	return bs.db.GetJSON(makeHashKey(PrefixBlockHash, hash), blockData)
+}
+
+// HasBlockHash checks if a block with the given hash is stored
+func (bs *BlockStorage) HasBlockHash(hash [32]byte) bool {
+	return bs.db.Has(makeHashKey(PrefixBlockHash, hash))
+}
+
+// LoadIndex retrieves the index entry of a stored block
+func (bs *BlockStorage) LoadIndex(hash [32]byte) (BlockIndexEntry, error) {
+	var entry BlockIndexEntry
+	err := bs.db.GetJSON(makeHashKey(PrefixBlockIndex, hash), &entry)
+	return entry, err
+}
+
+// Candidates returns the hashes of every stored block at height
+func (bs *BlockStorage) Candidates(height uint64) ([][32]byte, error) {
+	var hashes [][32]byte
+	err := bs.db.GetJSON(makeHeightKey(height), &hashes)
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, nil
+	}
+	return hashes, err
+}
+
+// SaveUndo persists the undo data of a block
+func (bs *BlockStorage) SaveUndo(hash [32]byte, undo interface{}) error {
+	return bs.db.PutJSON(makeHashKey(PrefixUndo, hash), undo)
+}
+
+// LoadUndo retrieves the undo data of a block
+func (bs *BlockStorage) LoadUndo(hash [32]byte, undo interface{}) error {
+	return bs.db.GetJSON(makeHashKey(PrefixUndo, hash), undo)
 }
 
 // GetBlocksRange retrieves a range of blocks from disk
@@ -57,14 +139,13 @@ func (bs *BlockStorage) GetBlocksRange(start, limit uint64) ([]interface{}, uint
 	blocks := make([]interface{}, 0, limit)
 	
 	for h := start; h < start+limit; h++ {
-		key := makeBlockKey(h)
-		if !bs.db.Has(key) {
+		if !bs.HasBlock(h) {
 			// Reached end of available blocks
 			return blocks, h, nil
 		}
 		
 		var blockData interface{}
-		if err := bs.db.GetJSON(key, &blockData); err != nil {
+		if err := bs.LoadBlock(h, &blockData); err != nil {
 			return blocks, h, fmt.Errorf("failed to read block %d: %w", h, err)
 		}
 		
@@ -162,6 +243,26 @@ func (ms *MetadataStorage) LoadDifficulty() (uint64, error) {
 	return binary.BigEndian.Uint64(data), nil
 }
 
+// SaveDifficultyParams saves the difficulty rule parameters taken from genesis
+func (ms *MetadataStorage) SaveDifficultyParams(params interface{}) error {
+	return ms.db.PutJSON(KeyDiffParams, params)
+}
+
+// LoadDifficultyParams loads the difficulty rule parameters
+func (ms *MetadataStorage) LoadDifficultyParams(params interface{}) error {
+	return ms.db.GetJSON(KeyDiffParams, params)
+}
+
+// SaveUpgrades saves the consensus rule activation heights taken from genesis
+func (ms *MetadataStorage) SaveUpgrades(upgrades interface{}) error {
+	return ms.db.PutJSON(KeyUpgrades, upgrades)
+}
+
+// LoadUpgrades loads the consensus rule activation heights
+func (ms *MetadataStorage) LoadUpgrades(upgrades interface{}) error {
+	return ms.db.GetJSON(KeyUpgrades, upgrades)
+}
+
 // SaveVDFState saves the VDF state
 func (ms *MetadataStorage) SaveVDFState(seed []byte, iterations uint64, output []byte) error {
 	if err := ms.db.Put(KeyVDFSeed, seed); err != nil {
@@ -232,6 +333,63 @@ func (ms *MetadataStorage) LoadNetworkID() (string, error) {
 	return string(data), nil
 }
 
+// SaveBlock stages a block under its hash and adds it to the candidates at its height
+func (b *Batch) SaveBlock(hash [32]byte, entry BlockIndexEntry, blockData interface{}) error {
+	if err := b.PutJSON(makeHashKey(PrefixBlockHash, hash), blockData); err != nil {
+		return err
+	}
+	if err := b.PutJSON(makeHashKey(PrefixBlockIndex, hash), entry); err != nil {
+		return err
+	}
+
+	var hashes [][32]byte
+	if err := b.GetJSON(makeHeightKey(entry.Height), &hashes); err != nil && !errors.Is(err, badger.ErrKeyNotFound) {
+		return err
+	}
+	for _, h := range hashes {
+		if h == hash {
+			return nil
+		}
+	}
+	return b.PutJSON(makeHeightKey(entry.Height), append(hashes, hash))
+}
+
+// SetBest stages hash as the best-chain block at height
+func (b *Batch) SetBest(height uint64, hash [32]byte) error {
+	return b.Put(makeBestKey(height), hash[:])
+}
+
+// DeleteBest stages the removal of the best-chain block at height. The block
+// itself stays stored under its hash.
+func (b *Batch) DeleteBest(height uint64) error {
+	if err := b.Delete(makeBestKey(height)); err != nil {
+		return err
+	}
+	return b.Delete(makeBlockKey(height))
+}
+
+// SaveUndo stages the undo data of a block
+func (b *Batch) SaveUndo(hash [32]byte, undo interface{}) error {
+	return b.PutJSON(makeHashKey(PrefixUndo, hash), undo)
+}
+
+// SaveAccount stages an account state
+func (b *Batch) SaveAccount(address string, balance int64, nonce uint64) error {
+	return b.PutJSON(makeAccountKey(address), AccountState{Balance: balance, Nonce: nonce})
+}
+
+// DeleteAccount stages the removal of an account
+func (b *Batch) DeleteAccount(address string) error {
+	return b.Delete(makeAccountKey(address))
+}
+
+// SaveTipHeight stages the tip height
+func (b *Batch) SaveTipHeight(height uint64) error {
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint64(data, height)
+	return b.Put(KeyTipHeight, data)
+}
+
 // Helper functions to create keys
 func makeBlockKey(height uint64) []byte {
 	key := make([]byte, len(PrefixBlock)+8)
@@ -246,3 +404,24 @@ func makeAccountKey(address string) []byte {
 	copy(key[len(PrefixAccount):], []byte(address))
 	return key
 }
+
+func makeBestKey(height uint64) []byte {
+	key := make([]byte, len(PrefixBest)+8)
+	copy(key, PrefixBest)
+	binary.BigEndian.PutUint64(key[len(PrefixBest):], height)
+	return key
+}
+
+func makeHeightKey(height uint64) []byte {
+	key := make([]byte, len(PrefixHeight)+8)
+	copy(key, PrefixHeight)
+	binary.BigEndian.PutUint64(key[len(PrefixHeight):], height)
+	return key
+}
+
+func makeHashKey(prefix []byte, hash [32]byte) []byte {
+	key := make([]byte, len(prefix)+32)
+	copy(key, prefix)
+	copy(key[len(prefix):], hash[:])
+	return key
+}
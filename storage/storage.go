@@ -84,3 +84,48 @@ func (db *DB) GetJSON(key []byte, value interface{}) error {
 	}
 	return json.Unmarshal(data, value)
 }
+
+// Batch stages writes that DB.Batch commits atomically
+type Batch struct {
+	txn *badger.Txn
+}
+
+// Batch runs fn and commits every write it stages in a single transaction.
+// Nothing is written if fn returns an error.
+func (db *DB) Batch(fn func(b *Batch) error) error {
+	return db.db.Update(func(txn *badger.Txn) error {
+		return fn(&Batch{txn: txn})
+	})
+}
+
+// Put stages a key-value pair
+func (b *Batch) Put(key []byte, value []byte) error {
+	return b.txn.Set(key, value)
+}
+
+// PutJSON stages a JSON-encoded value
+func (b *Batch) PutJSON(key []byte, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+	return b.Put(key, data)
+}
+
+// GetJSON reads and decodes a value, including writes staged in the batch
+func (b *Batch) GetJSON(key []byte, value interface{}) error {
+	item, err := b.txn.Get(key)
+	if err != nil {
+		return err
+	}
+	data, err := item.ValueCopy(nil)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, value)
+}
+
+// Delete stages the removal of a key
+func (b *Batch) Delete(key []byte) error {
+	return b.txn.Delete(key)
+}
@@ -3,15 +3,32 @@ package types
 import (
 	"encoding/binary"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"math/big"
 
 	"github.com/ArchivasNetwork/archivas/address"
 	"github.com/ArchivasNetwork/archivas/pospace"
 )
 
+// Header versions
+const (
+	// HeaderVersionLegacy hashes CumulativeWork as 8 bytes, from when it was a
+	// uint64 sum of difficulties. Blocks stored before versioning decode as it.
+	HeaderVersionLegacy = uint32(0)
+	// HeaderVersion hashes CumulativeWork as 32 bytes and commits to the version
+	HeaderVersion = uint32(1)
+)
+
+// ErrWorkOverflow is returned when hashing a header whose CumulativeWork
+// doesn't fit the 32 bytes it is hashed as
+var ErrWorkOverflow = errors.New("cumulative work exceeds 256 bits")
+
 // Block represents a blockchain block with Proof-of-Space and EVM execution
 // Phase 2: Extended with EVM fields for Betanet
 type Block struct {
+	Version uint32 `json:",omitempty"` // Header version (HeaderVersion for new blocks)
+
 	// PoST Consensus fields
 	Height        uint64
 	TimestampUnix int64
@@ -22,7 +39,7 @@ type Block struct {
 	FarmerAddr    address.EVMAddress // Address to receive block reward
 
 	// Cumulative work for fork resolution
-	CumulativeWork uint64 // Total work from genesis to this block
+	CumulativeWork *big.Int // Total work from genesis to this block (expected proof trials)
 
 	// EVM Execution fields (Phase 2)
 	StateRoot    [32]byte // Root hash of the world state after executing this block
@@ -39,13 +56,14 @@ type Block struct {
 
 // BlockHeader represents just the header portion of a block
 type BlockHeader struct {
+	Version        uint32
 	Height         uint64
 	TimestampUnix  int64
 	PrevHash       [32]byte
 	Difficulty     uint64
 	Challenge      [32]byte
 	FarmerAddr     address.EVMAddress
-	CumulativeWork uint64
+	CumulativeWork *big.Int
 	StateRoot      [32]byte
 	ReceiptsRoot   [32]byte
 	GasUsed        uint64
@@ -55,7 +73,7 @@ type BlockHeader struct {
 
 // Hash computes the block hash
 // Includes all PoST fields + EVM state roots for integrity
-func (b *Block) Hash() [32]byte {
+func (b *Block) Hash() ([32]byte, error) {
 	header := b.Header()
 	return header.Hash()
 }
@@ -63,6 +81,7 @@ func (b *Block) Hash() [32]byte {
 // Header extracts the header from a full block
 func (b *Block) Header() *BlockHeader {
 	return &BlockHeader{
+		Version:        b.Version,
 		Height:         b.Height,
 		TimestampUnix:  b.TimestampUnix,
 		PrevHash:       b.PrevHash,
@@ -79,12 +98,21 @@ func (b *Block) Header() *BlockHeader {
 }
 
 // Hash computes the header hash
-func (h *BlockHeader) Hash() [32]byte {
+func (h *BlockHeader) Hash() ([32]byte, error) {
+	if h.CumulativeWork != nil && h.CumulativeWork.BitLen() > 256 {
+		return [32]byte{}, ErrWorkOverflow
+	}
+
 	// Serialize header for hashing
-	// Format: Height|Timestamp|PrevHash|Difficulty|Challenge|FarmerAddr|
+	// Format: [Version]|Height|Timestamp|PrevHash|Difficulty|Challenge|FarmerAddr|
 	//         CumulativeWork|StateRoot|ReceiptsRoot|GasUsed|GasLimit|TxRoot
 	
 	data := make([]byte, 0, 256)
+
+	// Version (4 bytes, not present in legacy headers)
+	if h.Version != HeaderVersionLegacy {
+		data = binary.BigEndian.AppendUint32(data, h.Version)
+	}
 	
 	// Height (8 bytes)
 	heightBytes := make([]byte, 8)
@@ -110,10 +138,16 @@ func (h *BlockHeader) Hash() [32]byte {
 	// FarmerAddr (20 bytes)
 	data = append(data, h.FarmerAddr.Bytes()...)
 	
-	// CumulativeWork (8 bytes)
-	workBytes := make([]byte, 8)
-	binary.BigEndian.PutUint64(workBytes, h.CumulativeWork)
-	data = append(data, workBytes...)
+	// CumulativeWork (32 bytes, big-endian; 8 bytes in legacy headers)
+	var workBytes [32]byte
+	if h.CumulativeWork != nil {
+		h.CumulativeWork.FillBytes(workBytes[:])
+	}
+	if h.Version == HeaderVersionLegacy {
+		data = append(data, workBytes[24:]...)
+	} else {
+		data = append(data, workBytes[:]...)
+	}
 	
 	// StateRoot (32 bytes)
 	data = append(data, h.StateRoot[:]...)
@@ -135,7 +169,7 @@ func (h *BlockHeader) Hash() [32]byte {
 	data = append(data, h.TxRoot[:]...)
 	
 	// Compute SHA256 hash
-	return Hash256(data)
+	return Hash256(data), nil
 }
 
 // computeTxRoot computes the merkle root of transactions
@@ -0,0 +1,20 @@
+package types
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestHeaderHashWorkOverflow(t *testing.T) {
+	header := &BlockHeader{Version: HeaderVersion, Height: 1}
+	header.CumulativeWork = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+	if _, err := header.Hash(); err != nil {
+		t.Fatalf("expected 256-bit work to hash: %v", err)
+	}
+
+	header.CumulativeWork = new(big.Int).Lsh(big.NewInt(1), 256)
+	if _, err := header.Hash(); !errors.Is(err, ErrWorkOverflow) {
+		t.Fatalf("expected ErrWorkOverflow, got %v", err)
+	}
+}
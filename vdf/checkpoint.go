@@ -0,0 +1,63 @@
+package vdf
+
+import (
+	"bytes"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// VerifyWithCheckpoints verifies a hash-chain VDF using the checkpoints emitted
+// by ComputeSequential. The checkpoints must split the chain into equal
+// segments (iterations divisible by len(checkpoints)) with the last one equal
+// to final. Each segment is recomputed independently, so verification takes
+// the sequential time divided by the number of CPUs. Without checkpoints it
+// falls back to VerifySequential.
+func VerifyWithCheckpoints(seed []byte, iterations uint64, checkpoints [][]byte, final []byte) bool {
+	n := uint64(len(checkpoints))
+	if n == 0 {
+		return VerifySequential(seed, iterations, final)
+	}
+	if n > iterations || iterations%n != 0 {
+		return false
+	}
+	if !bytes.Equal(checkpoints[n-1], final) {
+		return false
+	}
+	step := iterations / n
+
+	workers := runtime.NumCPU()
+	if uint64(workers) > n {
+		workers = int(n)
+	}
+
+	var failed atomic.Bool
+	segments := make(chan uint64)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range segments {
+				if failed.Load() {
+					continue
+				}
+				start := seed
+				if i > 0 {
+					start = checkpoints[i-1]
+				}
+				if !VerifySequential(start, step, checkpoints[i]) {
+					failed.Store(true)
+				}
+			}
+		}()
+	}
+
+	for i := uint64(0); i < n && !failed.Load(); i++ {
+		segments <- i
+	}
+	close(segments)
+	wg.Wait()
+
+	return !failed.Load()
+}
@@ -0,0 +1,290 @@
+package vdf
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math/big"
+)
+
+// Class group of an imaginary quadratic field
+//
+// Elements are reduced binary quadratic forms (a, b, c) with discriminant
+// D = b^2 - 4ac < 0. The order of the group is unknown for a large random
+// D, so nobody can shortcut repeated squaring, and unlike an RSA group no
+// trusted setup is needed: D is derived from the VDF seed.
+
+var (
+	bigOne = big.NewInt(1)
+	bigTwo = big.NewInt(2)
+)
+
+// form is a binary quadratic form ax^2 + bxy + cy^2
+type form struct {
+	a, b, c *big.Int
+}
+
+// newForm builds the form (a, b, c) of discriminant d, or returns an error if
+// no such form with integer c exists
+func newForm(a, b, d *big.Int) (*form, error) {
+	if a.Sign() <= 0 {
+		return nil, errors.New("form: a must be positive")
+	}
+	// c = (b^2 - d) / 4a
+	num := new(big.Int).Mul(b, b)
+	num.Sub(num, d)
+	den := new(big.Int).Lsh(a, 2)
+	c, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	if rem.Sign() != 0 {
+		return nil, errors.New("form: discriminant mismatch")
+	}
+	return &form{a: new(big.Int).Set(a), b: new(big.Int).Set(b), c: c}, nil
+}
+
+// identityForm returns the identity element (1, 1, (1-d)/4)
+func identityForm(d *big.Int) *form {
+	f, _ := newForm(bigOne, bigOne, d)
+	return f
+}
+
+// generatorForm returns the element (2, 1, (1-d)/8), which exists for d = 1 mod 8
+func generatorForm(d *big.Int) *form {
+	f, _ := newForm(bigTwo, bigOne, d)
+	return f
+}
+
+// equal reports whether two reduced forms are the same element
+func (f *form) equal(g *form) bool {
+	return f.a.Cmp(g.a) == 0 && f.b.Cmp(g.b) == 0
+}
+
+// isReduced reports whether f is the unique reduced representative of its class
+func (f *form) isReduced() bool {
+	negA := new(big.Int).Neg(f.a)
+	if f.b.Cmp(negA) <= 0 || f.b.Cmp(f.a) > 0 {
+		return false
+	}
+	switch f.a.Cmp(f.c) {
+	case 1:
+		return false
+	case 0:
+		return f.b.Sign() >= 0
+	}
+	return true
+}
+
+// normalize moves b into (-a, a]
+func (f *form) normalize() *form {
+	negA := new(big.Int).Neg(f.a)
+	if f.b.Cmp(negA) > 0 && f.b.Cmp(f.a) <= 0 {
+		return f
+	}
+	// r = floor((a - b) / 2a)
+	twoA := new(big.Int).Lsh(f.a, 1)
+	r := new(big.Int).Sub(f.a, f.b)
+	r.Div(r, twoA)
+
+	// c' = a r^2 + b r + c, b' = b + 2 r a
+	c := new(big.Int).Mul(f.a, r)
+	c.Add(c, f.b)
+	c.Mul(c, r)
+	c.Add(c, f.c)
+	b := new(big.Int).Mul(twoA, r)
+	b.Add(b, f.b)
+	return &form{a: f.a, b: b, c: c}
+}
+
+// reduce returns the reduced form equivalent to f
+func (f *form) reduce() *form {
+	f = f.normalize()
+	for {
+		cmp := f.a.Cmp(f.c)
+		if cmp < 0 || (cmp == 0 && f.b.Sign() >= 0) {
+			break
+		}
+		// s = floor((c + b) / 2c)
+		twoC := new(big.Int).Lsh(f.c, 1)
+		s := new(big.Int).Add(f.c, f.b)
+		s.Div(s, twoC)
+
+		// (a, b, c) = (c, -b + 2sc, cs^2 - bs + a)
+		b := new(big.Int).Mul(twoC, s)
+		b.Sub(b, f.b)
+		c := new(big.Int).Mul(f.c, s)
+		c.Sub(c, f.b)
+		c.Mul(c, s)
+		c.Add(c, f.a)
+		f = &form{a: f.c, b: b, c: c}
+	}
+	return f.normalize()
+}
+
+// solveMod solves a*x = b (mod m), returning x = mu + nu*n for any integer n
+func solveMod(a, b, m *big.Int) (mu, nu *big.Int, err error) {
+	d := new(big.Int)
+	g := new(big.Int).GCD(d, nil, a, m)
+	q, r := new(big.Int).DivMod(b, g, new(big.Int))
+	if r.Sign() != 0 {
+		return nil, nil, errors.New("form: no solution to congruence")
+	}
+	mu = q.Mul(q, d)
+	mu.Mod(mu, m)
+	nu = new(big.Int).Div(m, g)
+	return mu, nu, nil
+}
+
+// mul composes two reduced forms of the same discriminant
+func (f *form) mul(g *form) *form {
+	// h = (b2 - b1) / 2, w = gcd(a1, a2, (b1 + b2) / 2)
+	sum := new(big.Int).Add(f.b, g.b)
+	sum.Rsh(sum, 1)
+	h := new(big.Int).Sub(g.b, f.b)
+	h.Rsh(h, 1)
+	w := new(big.Int).GCD(nil, nil, f.a, g.a)
+	w.GCD(nil, nil, w, sum)
+
+	s := new(big.Int).Div(f.a, w)
+	t := new(big.Int).Div(g.a, w)
+	u := new(big.Int).Div(sum, w)
+	st := new(big.Int).Mul(s, t)
+
+	// Solve k*t - l*s = h, k*u - m*s = c2, l*u - m*t = c1 for k, l, m
+	tu := new(big.Int).Mul(t, u)
+	rhs := new(big.Int).Mul(h, u)
+	rhs.Add(rhs, new(big.Int).Mul(s, f.c))
+	kTemp, factor, err := solveMod(tu, rhs, st)
+	if err != nil {
+		panic(err) // Unreachable for forms of equal discriminant
+	}
+	rhs2 := new(big.Int).Mul(t, kTemp)
+	rhs2.Sub(h, rhs2)
+	n, _, err := solveMod(new(big.Int).Mul(t, factor), rhs2, s)
+	if err != nil {
+		panic(err)
+	}
+	k := new(big.Int).Mul(factor, n)
+	k.Add(k, kTemp)
+
+	l := new(big.Int).Mul(t, k)
+	l.Sub(l, h)
+	l.Div(l, s)
+
+	m := new(big.Int).Mul(tu, k)
+	m.Sub(m, new(big.Int).Mul(h, u))
+	m.Sub(m, new(big.Int).Mul(s, f.c))
+	m.Div(m, st)
+
+	// a3 = st, b3 = wu - (kt + ls), c3 = kl - wm
+	b3 := new(big.Int).Mul(w, u)
+	b3.Sub(b3, new(big.Int).Mul(k, t))
+	b3.Sub(b3, new(big.Int).Mul(l, s))
+	c3 := new(big.Int).Mul(k, l)
+	c3.Sub(c3, new(big.Int).Mul(w, m))
+
+	return (&form{a: st, b: b3, c: c3}).reduce()
+}
+
+// square returns f^2
+func (f *form) square() *form {
+	return f.mul(f)
+}
+
+// pow returns f^e for e >= 0
+func (f *form) pow(e *big.Int, d *big.Int) *form {
+	result := identityForm(d)
+	for i := e.BitLen() - 1; i >= 0; i-- {
+		result = result.square()
+		if e.Bit(i) == 1 {
+			result = result.mul(f)
+		}
+	}
+	return result
+}
+
+// encode serializes a reduced form as a and b (c follows from the discriminant)
+func (f *form) encode() []byte {
+	a := f.a.Bytes()
+	b := f.b.Bytes()
+	out := make([]byte, 0, 5+len(a)+len(b))
+	out = binary.BigEndian.AppendUint16(out, uint16(len(a)))
+	out = append(out, a...)
+	if f.b.Sign() < 0 {
+		out = append(out, 1)
+	} else {
+		out = append(out, 0)
+	}
+	out = binary.BigEndian.AppendUint16(out, uint16(len(b)))
+	return append(out, b...)
+}
+
+// decodeForm parses a form of discriminant d written by encode. Only reduced
+// forms are accepted so every group element has exactly one encoding.
+func decodeForm(data []byte, d *big.Int) (*form, error) {
+	readInt := func() (*big.Int, error) {
+		if len(data) < 2 {
+			return nil, errors.New("form: truncated")
+		}
+		n := int(binary.BigEndian.Uint16(data))
+		if len(data) < 2+n {
+			return nil, errors.New("form: truncated")
+		}
+		v := new(big.Int).SetBytes(data[2 : 2+n])
+		data = data[2+n:]
+		return v, nil
+	}
+
+	a, err := readInt()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 1 || data[0] > 1 {
+		return nil, errors.New("form: invalid sign")
+	}
+	negative := data[0] == 1
+	data = data[1:]
+	b, err := readInt()
+	if err != nil {
+		return nil, err
+	}
+	if negative {
+		b.Neg(b)
+	}
+	if len(data) != 0 {
+		return nil, errors.New("form: trailing data")
+	}
+
+	f, err := newForm(a, b, d)
+	if err != nil {
+		return nil, err
+	}
+	if !f.isReduced() {
+		return nil, errors.New("form: not reduced")
+	}
+	return f, nil
+}
+
+// CreateDiscriminant derives a negative prime discriminant of the given bit
+// length from a seed. D = -p with p = 7 mod 8, so D = 1 mod 8 and the form
+// (2, 1, c) exists.
+func CreateDiscriminant(seed []byte, bits int) *big.Int {
+	buf := make([]byte, 0, (bits+7)/8+sha256.Size)
+	for counter := uint32(0); len(buf)*8 < bits; counter++ {
+		h := sha256.New()
+		h.Write(seed)
+		binary.Write(h, binary.BigEndian, counter)
+		buf = h.Sum(buf)
+	}
+
+	p := new(big.Int).SetBytes(buf)
+	p.Rsh(p, uint(len(buf)*8-bits))
+	p.SetBit(p, bits-1, 1)
+
+	// p = 7 mod 8, then step by 8 to the next prime
+	p.Sub(p, new(big.Int).And(p, big.NewInt(7)))
+	p.Add(p, big.NewInt(7))
+	eight := big.NewInt(8)
+	for !p.ProbablyPrime(1) {
+		p.Add(p, eight)
+	}
+	return p.Neg(p)
+}
@@ -4,6 +4,31 @@ import (
 	"crypto/sha256"
 )
 
+// Prover evaluates a VDF and produces a proof that the output is correct
+type Prover interface {
+	Prove(seed []byte, iterations uint64) (output []byte, proof []byte, err error)
+}
+
+// Verifier checks a VDF output and proof
+type Verifier interface {
+	Verify(seed []byte, iterations uint64, output []byte, proof []byte) bool
+}
+
+// HashChain is the sequential SHA-256 VDF used on devnet. It has no proof:
+// verification re-runs every iteration, so it costs as much as evaluation.
+type HashChain struct{}
+
+// Prove runs the hash chain; the proof is always empty
+func (HashChain) Prove(seed []byte, iterations uint64) ([]byte, []byte, error) {
+	final, _ := ComputeSequential(seed, iterations, 0)
+	return final, nil, nil
+}
+
+// Verify recomputes the hash chain and compares outputs
+func (HashChain) Verify(seed []byte, iterations uint64, output []byte, proof []byte) bool {
+	return len(proof) == 0 && VerifySequential(seed, iterations, output)
+}
+
 // StepHash returns H(input) using SHA-256
 func StepHash(input []byte) []byte {
 	h := sha256.Sum256(input)
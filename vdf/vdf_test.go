@@ -0,0 +1,115 @@
+package vdf
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestClassGroupArithmetic(t *testing.T) {
+	d := CreateDiscriminant([]byte("classgroup-test"), 256)
+	if d.Sign() >= 0 || new(big.Int).Mod(d, big.NewInt(8)).Int64() != 1 {
+		t.Fatalf("discriminant %s is not negative and 1 mod 8", d)
+	}
+
+	g := generatorForm(d)
+	id := identityForm(d)
+	if !g.mul(id).equal(g) {
+		t.Fatal("identity is not neutral")
+	}
+
+	// Repeated squaring and exponentiation must agree
+	y := g
+	for i := 0; i < 50; i++ {
+		y = y.square()
+		if !y.isReduced() {
+			t.Fatalf("square %d not reduced", i)
+		}
+	}
+	if !g.pow(new(big.Int).Lsh(big.NewInt(1), 50), d).equal(y) {
+		t.Fatal("g^(2^50) differs from 50 squarings")
+	}
+
+	// g^a * g^b = g^(a+b)
+	a, b := big.NewInt(12345), big.NewInt(67890)
+	if !g.pow(a, d).mul(g.pow(b, d)).equal(g.pow(new(big.Int).Add(a, b), d)) {
+		t.Fatal("exponent addition does not hold")
+	}
+
+	decoded, err := decodeForm(y.encode(), d)
+	if err != nil || !decoded.equal(y) {
+		t.Fatalf("encode/decode round trip failed: %v", err)
+	}
+}
+
+func TestWesolowskiProveVerify(t *testing.T) {
+	w := NewWesolowski(256)
+	seed := []byte("wesolowski-test-seed")
+
+	output, proof, err := w.Prove(seed, 500)
+	if err != nil {
+		t.Fatalf("Prove: %v", err)
+	}
+	if !w.Verify(seed, 500, output, proof) {
+		t.Fatal("expected proof to verify")
+	}
+
+	if w.Verify(seed, 501, output, proof) {
+		t.Fatal("expected proof for wrong iteration count to fail")
+	}
+	if w.Verify([]byte("other-seed"), 500, output, proof) {
+		t.Fatal("expected proof for wrong seed to fail")
+	}
+	if w.Verify(seed, 500, proof, output) {
+		t.Fatal("expected swapped output and proof to fail")
+	}
+
+	tampered := append([]byte(nil), proof...)
+	tampered[len(tampered)-1] ^= 1
+	if w.Verify(seed, 500, output, tampered) {
+		t.Fatal("expected tampered proof to fail")
+	}
+}
+
+func TestHashChainVerifier(t *testing.T) {
+	var v Verifier = HashChain{}
+	var p Prover = HashChain{}
+
+	output, proof, err := p.Prove([]byte("seed"), 100)
+	if err != nil {
+		t.Fatalf("Prove: %v", err)
+	}
+	if !v.Verify([]byte("seed"), 100, output, proof) {
+		t.Fatal("expected hash chain to verify")
+	}
+	if v.Verify([]byte("seed"), 99, output, proof) {
+		t.Fatal("expected wrong iteration count to fail")
+	}
+}
+
+func TestVerifyWithCheckpoints(t *testing.T) {
+	seed := []byte("checkpoint-seed")
+	final, checkpoints := ComputeSequential(seed, 1000, 100)
+
+	if !VerifyWithCheckpoints(seed, 1000, checkpoints, final) {
+		t.Fatal("expected checkpoints to verify")
+	}
+	if !VerifyWithCheckpoints(seed, 1000, nil, final) {
+		t.Fatal("expected fallback to sequential verification")
+	}
+
+	// A corrupted checkpoint breaks two segments
+	bad := make([][]byte, len(checkpoints))
+	copy(bad, checkpoints)
+	bad[4] = StepHash(bad[4])
+	if VerifyWithCheckpoints(seed, 1000, bad, final) {
+		t.Fatal("expected corrupted checkpoint to fail")
+	}
+
+	// Checkpoints must cover the claimed iterations exactly
+	if VerifyWithCheckpoints(seed, 1100, checkpoints, final) {
+		t.Fatal("expected wrong iteration count to fail")
+	}
+	if VerifyWithCheckpoints(seed, 1000, checkpoints[:9], checkpoints[8]) {
+		t.Fatal("expected truncated checkpoints to fail")
+	}
+}